@@ -0,0 +1,83 @@
+package main
+
+import (
+	"ai-hacker/internal/backup"
+	"ai-hacker/internal/handlers"
+	"ai-hacker/internal/migrate"
+	"fmt"
+)
+
+// runBackup 生成数据备份: ai-hacker backup [-dir backups]
+// 设置了环境变量 BACKUP_PASSPHRASE 时备份会加密
+// 命令行进程无法暂停服务的写入,服务运行中请使用管理后台的立即备份或定时备份
+func runBackup(args []string) int {
+	c := newCLI("backup", "[-dir backups]")
+	dir := c.flags.String("dir", handlers.BackupDir, "备份文件目录")
+	if !c.parse(args, 0) {
+		return exitUsage
+	}
+
+	path, manifest, err := backup.CreateFile(*dir, handlers.BackupPassphrase())
+	if err != nil {
+		return c.fail(fmt.Errorf("备份失败: %v", err))
+	}
+	c.audit("backups.create", "backups", path, nil, nil, fmt.Sprintf("备份 %d 个文件", len(manifest.Files)))
+
+	c.output(map[string]interface{}{"path": path, "files": len(manifest.Files)}, func() {
+		fmt.Printf("备份完成: %s (%d 个文件)\n", path, len(manifest.Files))
+	})
+	return exitOK
+}
+
+// runRestore 从备份恢复数据: ai-hacker restore [-dry-run] <备份文件>
+// 恢复前需要停止服务,原数据目录会重命名保留
+func runRestore(args []string) int {
+	c := newCLI("restore", "[-dry-run] <备份文件>\n加密备份需要设置环境变量 BACKUP_PASSPHRASE,恢复前请先停止服务")
+	dryRun := c.flags.Bool("dry-run", false, "只校验备份,不替换数据")
+	if !c.parse(args, 1) {
+		return exitUsage
+	}
+
+	archive, err := backup.Open(c.arg(0), handlers.BackupPassphrase())
+	if err != nil {
+		return c.fail(fmt.Errorf("备份校验失败: %v", err))
+	}
+	defer archive.Close()
+
+	result := map[string]interface{}{
+		"format_version": archive.Manifest.FormatVersion,
+		"schema_version": archive.SchemaVersion,
+		"created_at":     archive.Manifest.CreatedAt,
+		"files":          len(archive.Manifest.Files),
+		"applied":        false,
+	}
+	if !c.json {
+		fmt.Printf("备份校验通过: 格式版本 %d,数据版本 %d,创建于 %s,共 %d 个文件\n",
+			archive.Manifest.FormatVersion, archive.SchemaVersion, archive.Manifest.CreatedAt.Local().Format("2006-01-02 15:04:05"), len(archive.Manifest.Files))
+		if archive.SchemaVersion < migrate.Latest() {
+			fmt.Printf("备份的数据版本低于当前版本 %d,恢复后启动服务时会自动迁移\n", migrate.Latest())
+		}
+	}
+	if *dryRun {
+		c.output(result, func() {})
+		return exitOK
+	}
+
+	previous, err := archive.Apply()
+	if err != nil {
+		archive.Close()
+		return c.fail(fmt.Errorf("恢复失败: %v", err))
+	}
+	// 恢复后的数据目录中继续记录审计日志
+	c.audit("backups.restore", "backups", c.arg(0), nil, nil, "原数据目录保留为 "+previous)
+
+	result["applied"] = true
+	result["previous"] = previous
+	c.output(result, func() {
+		fmt.Println("恢复完成")
+		if previous != "" {
+			fmt.Printf("原数据目录已保留为 %s\n", previous)
+		}
+	})
+	return exitOK
+}
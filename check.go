@@ -0,0 +1,56 @@
+package main
+
+import (
+	"ai-hacker/internal/handlers"
+	"fmt"
+)
+
+// runCheck 执行数据完整性检查: ai-hacker check [-repair]
+// 有未修复的问题时退出码为 1
+func runCheck(args []string) int {
+	c := newCLI("check", "[-repair]")
+	repair := c.flags.Bool("repair", false, "修复可以安全修复的问题")
+	if !c.parse(args, 0) {
+		return exitUsage
+	}
+
+	issues := handlers.CheckIntegrity(*repair)
+	if *repair {
+		repaired := 0
+		for _, issue := range issues {
+			if issue.Repaired {
+				repaired++
+			}
+		}
+		if repaired > 0 {
+			c.audit("data.repair", "data", "", nil, nil, fmt.Sprintf("完整性检查修复 %d 个问题", repaired))
+		}
+	}
+
+	unresolved := 0
+	for _, issue := range issues {
+		if !issue.Repaired {
+			unresolved++
+		}
+	}
+
+	c.output(map[string]interface{}{"issues": issues, "unresolved": unresolved}, func() {
+		if len(issues) == 0 {
+			fmt.Println("数据完整性检查通过,未发现问题")
+			return
+		}
+		for _, issue := range issues {
+			mark := "问题"
+			if issue.Repaired {
+				mark = "已修复"
+			}
+			fmt.Printf("[%s] %s %s: %s\n", mark, issue.Kind, issue.ID, issue.Message)
+		}
+		fmt.Printf("共发现 %d 个问题,未修复 %d 个\n", len(issues), unresolved)
+	})
+
+	if unresolved > 0 {
+		return exitError
+	}
+	return exitOK
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"ai-hacker/internal/audit"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+)
+
+// 子命令的退出码
+const (
+	exitOK    = 0
+	exitError = 1 // 执行失败
+	exitUsage = 2 // 参数错误
+)
+
+// command 子命令
+type command struct {
+	summary string
+	run     func(args []string) int
+}
+
+// commands 除 serve 外的全部子命令
+var commands = map[string]command{
+	"check":    {"检查数据完整性", runCheck},
+	"backup":   {"生成数据备份", runBackup},
+	"restore":  {"从备份恢复数据", runRestore},
+	"migrate":  {"执行数据迁移", runMigrate},
+	"user":     {"创建用户、重置密码、修改角色", runUser},
+	"product":  {"查看商品", runProduct},
+	"keys":     {"导入、导出卡密", runKeys},
+	"settings": {"查看、修改系统设置", runSettings},
+}
+
+// runCommand 执行子命令,返回退出码
+func runCommand(name string, args []string) int {
+	if name == "help" || name == "-h" || name == "--help" {
+		printUsage(os.Stdout)
+		return exitOK
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "未知的命令: %s\n\n", name)
+		printUsage(os.Stderr)
+		return exitUsage
+	}
+	return cmd.run(args)
+}
+
+// printUsage 输出全部子命令
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "用法: ai-hacker [命令] [参数]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "不带命令或使用 serve 时启动服务。命令:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(w, "  %-10s %s\n", "serve", "启动服务")
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-10s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "所有命令支持 -json 输出,执行失败退出码为 1,参数错误为 2。使用 ai-hacker <命令> -h 查看参数")
+}
+
+// runSubcommand 分发二级子命令,如 user create
+func runSubcommand(name string, args []string, subs map[string]func(args []string) int) int {
+	names := make([]string, 0, len(subs))
+	for sub := range subs {
+		names = append(names, sub)
+	}
+	sort.Strings(names)
+
+	if len(args) == 0 || subs[args[0]] == nil {
+		if len(args) > 0 && args[0] != "-h" && args[0] != "--help" {
+			fmt.Fprintf(os.Stderr, "未知的命令: %s %s\n", name, args[0])
+		}
+		fmt.Fprintf(os.Stderr, "用法: ai-hacker %s <%s> [参数]\n", name, strings.Join(names, "|"))
+		return exitUsage
+	}
+	return subs[args[0]](args[1:])
+}
+
+// cli 单个子命令的参数解析和输出
+// -json 时结果和错误都以 JSON 输出到标准输出,便于脚本处理
+type cli struct {
+	name  string
+	flags *flag.FlagSet
+	json  bool
+	args  []string // 位置参数
+}
+
+// newCLI 创建子命令,usage 为参数说明,如 "[-dry-run] <备份文件>"
+func newCLI(name, usage string) *cli {
+	c := &cli{name: name, flags: flag.NewFlagSet(name, flag.ContinueOnError)}
+	c.flags.BoolVar(&c.json, "json", false, "以 JSON 格式输出")
+	c.flags.Usage = func() {
+		fmt.Fprintf(c.flags.Output(), "用法: ai-hacker %s %s\n", name, usage)
+		c.flags.PrintDefaults()
+	}
+	return c
+}
+
+// parse 解析参数并检查位置参数的数量,nargs 小于 0 时不检查
+// 参数可以写在位置参数之后,-- 之后的内容都作为位置参数
+// 返回 false 时已输出用法,调用方应返回 exitUsage
+func (c *cli) parse(args []string, nargs int) bool {
+	for {
+		if err := c.flags.Parse(args); err != nil {
+			return false
+		}
+		rest := c.flags.Args()
+		if len(rest) == 0 {
+			break
+		}
+		if len(args) > len(rest) && args[len(args)-len(rest)-1] == "--" {
+			c.args = append(c.args, rest...)
+			break
+		}
+		c.args = append(c.args, rest[0])
+		args = rest[1:]
+	}
+
+	if nargs >= 0 && len(c.args) != nargs {
+		c.flags.Usage()
+		return false
+	}
+	return true
+}
+
+// arg 返回第 i 个位置参数,不存在时返回空字符串
+func (c *cli) arg(i int) string {
+	if i < len(c.args) {
+		return c.args[i]
+	}
+	return ""
+}
+
+// usageError 参数值错误
+func (c *cli) usageError(format string, args ...interface{}) int {
+	c.printError(fmt.Sprintf(format, args...))
+	return exitUsage
+}
+
+// fail 执行失败
+func (c *cli) fail(err error) int {
+	c.printError(err.Error())
+	return exitError
+}
+
+func (c *cli) printError(msg string) {
+	if c.json {
+		c.writeJSON(map[string]string{"error": msg})
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s: %s\n", c.name, msg)
+}
+
+// output 输出结果,-json 时输出 v,否则调用 text 输出文本
+func (c *cli) output(v interface{}, text func()) {
+	if c.json {
+		c.writeJSON(v)
+		return
+	}
+	text()
+}
+
+func (c *cli) writeJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+}
+
+// cliActor 审计日志中命令行操作的操作人
+func cliActor() string {
+	if u, err := user.Current(); err == nil {
+		return "cli:" + u.Username
+	}
+	return "cli"
+}
+
+// audit 记录命令行操作的审计日志
+func (c *cli) audit(action, entity, targetID string, before, after interface{}, detail string) {
+	e := audit.Entry{
+		Actor:    cliActor(),
+		Action:   action,
+		Entity:   entity,
+		TargetID: targetID,
+		Detail:   detail,
+		Method:   "CLI",
+		Path:     c.name,
+	}
+	if before != nil || after != nil {
+		e.Diff = audit.Diff(before, after)
+	}
+	if err := audit.Append(e); err != nil {
+		fmt.Fprintf(os.Stderr, "写入审计日志失败: %v\n", err)
+	}
+}
@@ -0,0 +1,338 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogFile 审计日志文件,每行一条 JSON 记录,只追加不修改
+const LogFile = "data/audit.log"
+
+// Change 字段变更
+type Change struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Entry 审计日志记录
+// 每条记录的 Hash 由上一条记录的 Hash 和本条内容计算得出,任何修改或删除都会使后续校验失败
+type Entry struct {
+	Seq      int64             `json:"seq"`
+	Time     time.Time         `json:"time"`
+	Actor    string            `json:"actor"`
+	ActorID  string            `json:"actor_id"`
+	Action   string            `json:"action"`
+	Entity   string            `json:"entity"`
+	TargetID string            `json:"target_id,omitempty"`
+	Diff     map[string]Change `json:"diff,omitempty"`
+	Detail   string            `json:"detail,omitempty"`
+	IP       string            `json:"ip"`
+	Method   string            `json:"method"`
+	Path     string            `json:"path"`
+	Status   int               `json:"status"`
+	PrevHash string            `json:"prev_hash"`
+	Hash     string            `json:"hash"`
+}
+
+// Filter 审计日志查询条件
+type Filter struct {
+	Actor  string
+	Entity string
+	Action string
+	From   time.Time
+	To     time.Time
+	Limit  int
+}
+
+var (
+	mu       sync.Mutex
+	lastSize int64 = -1 // 上次写入后的文件大小,与当前大小不同时说明有其他进程写入
+	lastSeq  int64
+	lastHash string
+)
+
+// computeHash 计算记录的哈希值
+func computeHash(e Entry) string {
+	e.Hash = ""
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// loadTail 读取日志末尾的序号和哈希,用于续接哈希链
+func loadTail() error {
+	f, err := os.Open(LogFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return fmt.Errorf("审计日志第 %d 条之后的记录无法解析: %v", lastSeq, err)
+		}
+		lastSeq = e.Seq
+		lastHash = e.Hash
+	}
+	return scanner.Err()
+}
+
+// Append 追加一条审计记录,自动填充序号、时间和哈希
+func Append(e Entry) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	// 命令行工具和服务可能同时写入,文件大小变化时重新读取末尾的序号和哈希
+	var size int64
+	if info, err := os.Stat(LogFile); err == nil {
+		size = info.Size()
+	}
+	if size != lastSize {
+		lastSeq, lastHash = 0, ""
+		if err := loadTail(); err != nil {
+			return err
+		}
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+	e.Seq = lastSeq + 1
+	e.PrevHash = lastHash
+	e.Hash = computeHash(e)
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(LogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+
+	lastSize = size + int64(len(data)) + 1
+	lastSeq = e.Seq
+	lastHash = e.Hash
+	return nil
+}
+
+// readAll 按顺序读取全部记录,fn 返回 false 时停止
+func readAll(path string, fn func(e Entry) bool) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("审计日志第 %d 行无法解析: %v", line, err)
+		}
+		if !fn(e) {
+			break
+		}
+	}
+	return scanner.Err()
+}
+
+// Query 按条件查询审计日志,最新的记录在前
+func Query(filter Filter) ([]Entry, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	entries := []Entry{}
+	err := readAll(LogFile, func(e Entry) bool {
+		if filter.Actor != "" && !strings.EqualFold(e.Actor, filter.Actor) && e.ActorID != filter.Actor {
+			return true
+		}
+		if filter.Entity != "" && e.Entity != filter.Entity {
+			return true
+		}
+		if filter.Action != "" && e.Action != filter.Action {
+			return true
+		}
+		if !filter.From.IsZero() && e.Time.Before(filter.From) {
+			return true
+		}
+		if !filter.To.IsZero() && e.Time.After(filter.To) {
+			return true
+		}
+		entries = append(entries, e)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[:filter.Limit]
+	}
+	return entries, nil
+}
+
+// Verify 校验哈希链,返回校验通过的记录数
+// 发现记录被修改、删除或插入时返回对应序号的错误
+func Verify() (int, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return VerifyFile(LogFile)
+}
+
+// VerifyFile 校验指定审计日志文件的哈希链,用于校验备份中的日志
+func VerifyFile(path string) (int, error) {
+	count := 0
+	prevHash := ""
+	var prevSeq int64
+	var verifyErr error
+	err := readAll(path, func(e Entry) bool {
+		switch {
+		case e.Seq != prevSeq+1:
+			verifyErr = fmt.Errorf("第 %d 条记录之后序号不连续: %d", prevSeq, e.Seq)
+		case e.PrevHash != prevHash:
+			verifyErr = fmt.Errorf("第 %d 条记录的前序哈希不匹配", e.Seq)
+		case computeHash(e) != e.Hash:
+			verifyErr = fmt.Errorf("第 %d 条记录内容已被修改", e.Seq)
+		}
+		if verifyErr != nil {
+			return false
+		}
+		count++
+		prevSeq = e.Seq
+		prevHash = e.Hash
+		return true
+	})
+	if err != nil {
+		return count, err
+	}
+	return count, verifyErr
+}
+
+// CopyTo 复制当前审计日志,复制期间暂停追加
+func CopyTo(w io.Writer) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	f, err := os.Open(LogFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// 卡密内容和密钥字段,变更内容不写入日志
+var secretFields = map[string]bool{
+	"key":                true,
+	"card_key":           true,
+	"fields":             true,
+	"card_key_fields":    true,
+	"replacements":       true,
+	"mail_api_key":       true,
+	"secret":             true,
+	"telegram_bot_token": true,
+}
+
+// sensitiveField 是否为敏感字段,变更内容不写入日志
+func sensitiveField(name string) bool {
+	return strings.Contains(strings.ToLower(name), "password") || secretFields[name]
+}
+
+// toMap 将结构体转换为字段映射
+func toMap(v interface{}) map[string]interface{} {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil
+	}
+	return m
+}
+
+// Diff 比较变更前后的记录,返回发生变化的字段
+// before 为 nil 表示新建,after 为 nil 表示删除
+func Diff(before, after interface{}) map[string]Change {
+	b := toMap(before)
+	a := toMap(after)
+
+	diff := make(map[string]Change)
+	for k, bv := range b {
+		av := a[k]
+		if jsonEqual(bv, av) {
+			continue
+		}
+		diff[k] = Change{Before: bv, After: av}
+	}
+	for k, av := range a {
+		if _, ok := b[k]; !ok {
+			diff[k] = Change{Before: nil, After: av}
+		}
+	}
+
+	for k := range diff {
+		if sensitiveField(k) {
+			diff[k] = Change{Before: "***", After: "***"}
+		}
+	}
+
+	if len(diff) == 0 {
+		return nil
+	}
+	return diff
+}
+
+// jsonEqual 比较两个 JSON 值是否相同
+func jsonEqual(a, b interface{}) bool {
+	ad, _ := json.Marshal(a)
+	bd, _ := json.Marshal(b)
+	return string(ad) == string(bd)
+}
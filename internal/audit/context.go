@@ -0,0 +1,50 @@
+package audit
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// contextKey 请求上下文中保存审计信息的键
+const contextKey = "audit_record"
+
+// Record 处理函数记录的审计信息,由中间件在请求结束后写入日志
+type Record struct {
+	Action   string
+	Entity   string
+	TargetID string
+	Diff     map[string]Change
+	Detail   string
+}
+
+// Set 记录本次请求的操作和目标,before/after 用于生成变更内容
+// 变更内容在调用时生成,调用方之后修改数据不影响记录
+func Set(c *gin.Context, action, entity, targetID string, before, after interface{}) {
+	rec := Record{
+		Action:   action,
+		Entity:   entity,
+		TargetID: targetID,
+	}
+	if before != nil || after != nil {
+		rec.Diff = Diff(before, after)
+	}
+	c.Set(contextKey, &rec)
+}
+
+// SetDetail 为本次请求的审计记录补充说明
+func SetDetail(c *gin.Context, detail string) {
+	if rec := Get(c); rec != nil {
+		rec.Detail = detail
+		return
+	}
+	c.Set(contextKey, &Record{Detail: detail})
+}
+
+// Get 获取处理函数记录的审计信息
+func Get(c *gin.Context) *Record {
+	if v, ok := c.Get(contextKey); ok {
+		if rec, ok := v.(*Record); ok {
+			return rec
+		}
+	}
+	return nil
+}
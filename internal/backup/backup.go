@@ -0,0 +1,313 @@
+package backup
+
+import (
+	"ai-hacker/internal/audit"
+	"ai-hacker/internal/utils"
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FormatVersion 备份格式版本,格式变化时递增,恢复时拒绝更高版本的备份
+const FormatVersion = 1
+
+// 备份的数据目录和配置文件
+const (
+	DataDir    = "data"
+	ConfigFile = "config.json"
+)
+
+// 备份文件名
+const (
+	filePrefix   = "backup-"
+	fileSuffix   = ".tar.gz"
+	encSuffix    = ".enc"
+	manifestName = "manifest.json"
+)
+
+// FileEntry 备份中的单个文件
+type FileEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest 备份清单,作为归档的第一个文件
+type Manifest struct {
+	FormatVersion int         `json:"format_version"`
+	CreatedAt     time.Time   `json:"created_at"`
+	Files         []FileEntry `json:"files"`
+}
+
+// Info 备份文件信息
+type Info struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	Encrypted bool      `json:"encrypted"`
+}
+
+// Create 生成备份写入 w,passphrase 不为空时加密
+// 复制数据期间暂停所有数据写入,压缩和加密在恢复写入后进行
+func Create(w io.Writer, passphrase string) (*Manifest, error) {
+	tmp, err := os.MkdirTemp("", "ai-hacker-backup-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	manifest, err := snapshot(tmp)
+	if err != nil {
+		return nil, err
+	}
+
+	out := w
+	var enc *encryptWriter
+	if passphrase != "" {
+		if enc, err = newEncryptWriter(w, passphrase); err != nil {
+			return nil, err
+		}
+		out = enc
+	}
+
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: manifestName, Mode: 0600, Size: int64(len(data)), ModTime: manifest.CreatedAt}); err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return nil, err
+	}
+
+	for _, entry := range manifest.Files {
+		if err := addFile(tw, filepath.Join(tmp, filepath.FromSlash(entry.Path)), entry, manifest.CreatedAt); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	if enc != nil {
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return manifest, nil
+}
+
+// addFile 将快照中的文件写入归档
+func addFile(tw *tar.Writer, path string, entry FileEntry, modTime time.Time) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := tw.WriteHeader(&tar.Header{Name: entry.Path, Mode: 0600, Size: entry.Size, ModTime: modTime}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// snapshot 暂停数据写入,将数据目录和配置文件复制到临时目录并计算校验和
+func snapshot(tmp string) (*Manifest, error) {
+	defer utils.FreezeData()()
+
+	manifest := &Manifest{
+		FormatVersion: FormatVersion,
+		CreatedAt:     time.Now().UTC(),
+		Files:         []FileEntry{},
+	}
+
+	err := filepath.WalkDir(DataDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		name := filepath.ToSlash(path)
+		entry, err := copyFile(tmp, name, func(w io.Writer) error {
+			// 审计日志由审计模块单独加锁追加
+			if name == audit.LogFile {
+				return audit.CopyTo(w)
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = io.Copy(w, f)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(ConfigFile); err == nil {
+		entry, err := copyFile(tmp, ConfigFile, func(w io.Writer) error {
+			data, err := os.ReadFile(ConfigFile)
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(data)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		manifest.Files = append(manifest.Files, entry)
+	}
+
+	return manifest, nil
+}
+
+// copyFile 将 write 输出的内容保存到临时目录,返回文件大小和校验和
+func copyFile(tmp, name string, write func(w io.Writer) error) (FileEntry, error) {
+	dst := filepath.Join(tmp, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return FileEntry{}, err
+	}
+	f, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return FileEntry{}, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	counter := &countWriter{w: io.MultiWriter(f, hash)}
+	if err := write(counter); err != nil {
+		return FileEntry{}, fmt.Errorf("复制 %s 失败: %v", name, err)
+	}
+	return FileEntry{Path: name, Size: counter.n, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// countWriter 统计写入的字节数
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// CreateFile 在 dir 目录生成备份文件,返回文件路径
+// 先写入临时文件,完成后再重命名,未完成的备份不会出现在列表中
+func CreateFile(dir, passphrase string) (string, *Manifest, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", nil, err
+	}
+
+	name := filePrefix + time.Now().Format("20060102-150405") + fileSuffix
+	if passphrase != "" {
+		name += encSuffix
+	}
+	path := filepath.Join(dir, name)
+
+	f, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", nil, err
+	}
+	manifest, err := Create(f, passphrase)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return "", nil, err
+	}
+
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return "", nil, err
+	}
+	return path, manifest, nil
+}
+
+// List 列出 dir 目录中的备份文件,最新的在前
+func List(dir string) ([]Info, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []Info{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []Info{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, filePrefix) {
+			continue
+		}
+		if !strings.HasSuffix(name, fileSuffix) && !strings.HasSuffix(name, fileSuffix+encSuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, Info{
+			Name:      name,
+			Size:      info.Size(),
+			CreatedAt: info.ModTime(),
+			Encrypted: strings.HasSuffix(name, encSuffix),
+		})
+	}
+
+	// 文件名包含时间,按文件名倒序即按时间倒序
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Name > backups[j].Name
+	})
+	return backups, nil
+}
+
+// Rotate 只保留最新的 keep 个备份,返回删除的文件名
+func Rotate(dir string, keep int) ([]string, error) {
+	if keep <= 0 {
+		return nil, nil
+	}
+
+	backups, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	removed := []string{}
+	for i := keep; i < len(backups); i++ {
+		if err := os.Remove(filepath.Join(dir, backups[i].Name)); err != nil {
+			return removed, err
+		}
+		removed = append(removed, backups[i].Name)
+	}
+	return removed, nil
+}
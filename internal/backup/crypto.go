@@ -0,0 +1,209 @@
+package backup
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// 加密备份格式:
+//
+//	magic | salt (16) | nonce 前缀 (4) | 分块...
+//
+// 每个分块为 4 字节长度 + AES-256-GCM 密文,长度最高位标记最后一块。
+// nonce 由前缀和分块序号组成,最后一块标记同时作为附加数据参与认证,
+// 分块被删除、重排或文件被截断都会导致解密失败。
+const (
+	encMagic      = "AIHBAK1\n"
+	encSaltSize   = 16
+	encPrefixSize = 4
+	encChunkSize  = 64 * 1024
+	encFinalFlag  = 1 << 31
+)
+
+// scrypt 参数
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+var errBadPassphrase = errors.New("备份密码错误或文件已损坏")
+
+// newAEAD 由密码和盐派生密钥
+func newAEAD(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce 返回分块的 nonce
+func chunkNonce(prefix []byte, seq uint64) []byte {
+	nonce := make([]byte, encPrefixSize+8)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint64(nonce[encPrefixSize:], seq)
+	return nonce
+}
+
+// chunkAD 返回分块的附加数据
+func chunkAD(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// encryptWriter 分块加密写入
+type encryptWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	prefix []byte
+	seq    uint64
+	buf    []byte
+}
+
+// newEncryptWriter 写入文件头并返回加密写入器,Close 时写入最后一块
+func newEncryptWriter(w io.Writer, passphrase string) (*encryptWriter, error) {
+	header := make([]byte, len(encMagic)+encSaltSize+encPrefixSize)
+	copy(header, encMagic)
+	if _, err := rand.Read(header[len(encMagic):]); err != nil {
+		return nil, err
+	}
+	salt := header[len(encMagic) : len(encMagic)+encSaltSize]
+	prefix := header[len(encMagic)+encSaltSize:]
+
+	aead, err := newAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, aead: aead, prefix: prefix, buf: make([]byte, 0, encChunkSize)}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := copy(e.buf[len(e.buf):cap(e.buf)], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+		if len(e.buf) == cap(e.buf) {
+			if err := e.writeChunk(false); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close 写入最后一块,不关闭底层写入器
+func (e *encryptWriter) Close() error {
+	return e.writeChunk(true)
+}
+
+func (e *encryptWriter) writeChunk(final bool) error {
+	sealed := e.aead.Seal(nil, chunkNonce(e.prefix, e.seq), e.buf, chunkAD(final))
+	e.seq++
+	e.buf = e.buf[:0]
+
+	length := uint32(len(sealed))
+	if final {
+		length |= encFinalFlag
+	}
+	var head [4]byte
+	binary.BigEndian.PutUint32(head[:], length)
+	if _, err := e.w.Write(head[:]); err != nil {
+		return err
+	}
+	_, err := e.w.Write(sealed)
+	return err
+}
+
+// isEncrypted 检查文件头是否为加密备份
+func isEncrypted(r *bufio.Reader) bool {
+	head, err := r.Peek(len(encMagic))
+	return err == nil && string(head) == encMagic
+}
+
+// decryptReader 分块解密读取
+type decryptReader struct {
+	r      io.Reader
+	aead   cipher.AEAD
+	prefix []byte
+	seq    uint64
+	plain  []byte
+	done   bool
+}
+
+// newDecryptReader 读取文件头并返回解密读取器
+func newDecryptReader(r io.Reader, passphrase string) (*decryptReader, error) {
+	header := make([]byte, len(encMagic)+encSaltSize+encPrefixSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, errors.New("备份文件头不完整")
+	}
+	if string(header[:len(encMagic)]) != encMagic {
+		return nil, errors.New("不是加密备份文件")
+	}
+	salt := header[len(encMagic) : len(encMagic)+encSaltSize]
+	prefix := header[len(encMagic)+encSaltSize:]
+
+	aead, err := newAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{r: r, aead: aead, prefix: prefix}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.readChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+func (d *decryptReader) readChunk() error {
+	var head [4]byte
+	if _, err := io.ReadFull(d.r, head[:]); err != nil {
+		return errors.New("备份文件不完整")
+	}
+	length := binary.BigEndian.Uint32(head[:])
+	final := length&encFinalFlag != 0
+	length &^= encFinalFlag
+	if length > encChunkSize+uint32(d.aead.Overhead()) {
+		return errBadPassphrase
+	}
+
+	sealed := make([]byte, length)
+	if _, err := io.ReadFull(d.r, sealed); err != nil {
+		return errors.New("备份文件不完整")
+	}
+	plain, err := d.aead.Open(nil, chunkNonce(d.prefix, d.seq), sealed, chunkAD(final))
+	if err != nil {
+		return errBadPassphrase
+	}
+	d.seq++
+	d.plain = plain
+	d.done = final
+	return nil
+}
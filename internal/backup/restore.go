@@ -0,0 +1,294 @@
+package backup
+
+import (
+	"ai-hacker/internal/audit"
+	"ai-hacker/internal/migrate"
+	"ai-hacker/internal/models"
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 数据文件的结构,恢复前按对应类型解析以确认备份内容可用
+var schemas = map[string]func() interface{}{
+	"data/products.json":            func() interface{} { return &[]models.Product{} },
+	"data/orders.json":              func() interface{} { return &[]models.Order{} },
+	"data/users.json":               func() interface{} { return &[]models.User{} },
+	"data/roles.json":               func() interface{} { return &[]models.Role{} },
+	"data/card_keys.json":           func() interface{} { return &[]models.CardKey{} },
+	"data/settings.json":            func() interface{} { return &[]models.Setting{} },
+	"data/files.json":               func() interface{} { return &[]models.DeliveryFile{} },
+	"data/expiry_reports.json":      func() interface{} { return &[]models.ExpiryReport{} },
+	"data/stock_subscriptions.json": func() interface{} { return &[]models.StockSubscription{} },
+	"data/key_reveals.json":         func() interface{} { return &[]models.KeyReveal{} },
+	"data/outbox.json":              func() interface{} { return &[]models.OutboxMessage{} },
+	"data/email_log.json":           func() interface{} { return &[]models.EmailLog{} },
+	"data/webhooks.json":            func() interface{} { return &[]models.Webhook{} },
+	"data/webhook_deliveries.json":  func() interface{} { return &[]models.WebhookDelivery{} },
+}
+
+// 恢复时必须包含的文件
+var requiredFiles = []string{"data/users.json", "data/products.json", "data/orders.json"}
+
+// Archive 已解开并校验通过的备份
+type Archive struct {
+	Manifest      Manifest
+	SchemaVersion int // 备份数据的结构版本,低于当前版本时启动服务会自动迁移
+	dir           string
+}
+
+// Open 解开备份到临时目录并校验清单、校验和与数据结构
+// 加密备份需要提供密码,使用完毕后调用 Close 删除临时目录
+func Open(archivePath, passphrase string) (*Archive, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	var r io.Reader = br
+	if isEncrypted(br) {
+		if passphrase == "" {
+			return nil, errors.New("备份已加密,需要提供备份密码")
+		}
+		if r, err = newDecryptReader(r, passphrase); err != nil {
+			return nil, err
+		}
+	}
+
+	gz, err := gzip.NewReader(r)
+	if errors.Is(err, errBadPassphrase) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("备份文件格式错误: %v", err)
+	}
+	defer gz.Close()
+
+	// 解开到数据目录所在的目录,恢复时可以直接重命名
+	dir, err := os.MkdirTemp(filepath.Dir(filepath.Clean(DataDir)), ".restore-")
+	if err != nil {
+		return nil, err
+	}
+	a := &Archive{dir: dir}
+
+	if err := a.extract(tar.NewReader(gz)); err != nil {
+		a.Close()
+		return nil, err
+	}
+	if err := a.validate(); err != nil {
+		a.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+// Close 删除临时目录
+func (a *Archive) Close() error {
+	return os.RemoveAll(a.dir)
+}
+
+// extract 解开归档,读取清单并校验每个文件的大小和校验和
+func (a *Archive) extract(tr *tar.Reader) error {
+	var manifest *Manifest
+	seen := make(map[string]FileEntry)
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("备份文件格式错误: %v", err)
+		}
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+		if header.Typeflag != tar.TypeReg {
+			return fmt.Errorf("备份中包含不支持的文件类型: %s", header.Name)
+		}
+
+		name := path.Clean(header.Name)
+		if name == manifestName {
+			if manifest != nil {
+				return errors.New("备份中包含多个清单")
+			}
+			manifest = &Manifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return fmt.Errorf("备份清单无法解析: %v", err)
+			}
+			continue
+		}
+		if name != ConfigFile && !strings.HasPrefix(name, DataDir+"/") {
+			return fmt.Errorf("备份中包含不允许的路径: %s", header.Name)
+		}
+
+		dst := filepath.Join(a.dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+			return err
+		}
+		out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		hash := sha256.New()
+		size, err := io.Copy(io.MultiWriter(out, hash), tr)
+		out.Close()
+		if err != nil {
+			return fmt.Errorf("读取 %s 失败: %v", name, err)
+		}
+		seen[name] = FileEntry{Path: name, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}
+	}
+
+	if manifest == nil {
+		return errors.New("备份中缺少清单")
+	}
+	if manifest.FormatVersion < 1 || manifest.FormatVersion > FormatVersion {
+		return fmt.Errorf("不支持的备份格式版本: %d", manifest.FormatVersion)
+	}
+
+	for _, entry := range manifest.Files {
+		got, ok := seen[entry.Path]
+		if !ok {
+			return fmt.Errorf("备份中缺少文件: %s", entry.Path)
+		}
+		if got.Size != entry.Size || got.SHA256 != entry.SHA256 {
+			return fmt.Errorf("文件校验和不匹配: %s", entry.Path)
+		}
+		delete(seen, entry.Path)
+	}
+	if len(seen) > 0 {
+		names := make([]string, 0, len(seen))
+		for name := range seen {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("备份中包含清单外的文件: %s", strings.Join(names, ", "))
+	}
+
+	a.Manifest = *manifest
+	return nil
+}
+
+// validate 检查必需文件并按数据结构解析
+func (a *Archive) validate() error {
+	files := make(map[string]bool)
+	for _, entry := range a.Manifest.Files {
+		files[entry.Path] = true
+	}
+	for _, name := range requiredFiles {
+		if !files[name] {
+			return fmt.Errorf("备份中缺少必需的数据文件: %s", name)
+		}
+	}
+
+	version, err := a.schemaVersion(files)
+	if err != nil {
+		return err
+	}
+	if version > migrate.Latest() {
+		return fmt.Errorf("备份的数据版本 %d 高于程序支持的版本 %d,请升级程序后再恢复", version, migrate.Latest())
+	}
+	a.SchemaVersion = version
+
+	for _, entry := range a.Manifest.Files {
+		local := filepath.Join(a.dir, filepath.FromSlash(entry.Path))
+
+		if entry.Path == audit.LogFile {
+			if _, err := audit.VerifyFile(local); err != nil {
+				return fmt.Errorf("审计日志校验失败: %v", err)
+			}
+			continue
+		}
+
+		newValue, known := schemas[entry.Path]
+		if !known && !strings.HasSuffix(entry.Path, ".json") {
+			continue
+		}
+
+		data, err := os.ReadFile(local)
+		if err != nil {
+			return err
+		}
+		// 旧版本的数据可能无法按当前结构解析,恢复后启动时会迁移
+		if !known || version < migrate.Latest() {
+			if !json.Valid(data) {
+				return fmt.Errorf("%s 不是有效的 JSON", entry.Path)
+			}
+			continue
+		}
+		if err := json.Unmarshal(data, newValue()); err != nil {
+			return fmt.Errorf("%s 数据结构错误: %v", entry.Path, err)
+		}
+	}
+	return nil
+}
+
+// schemaVersion 读取备份中的数据结构版本,没有版本文件时为 0
+func (a *Archive) schemaVersion(files map[string]bool) (int, error) {
+	if !files[migrate.VersionFile] {
+		return 0, nil
+	}
+	var state migrate.State
+	data, err := os.ReadFile(filepath.Join(a.dir, filepath.FromSlash(migrate.VersionFile)))
+	if err != nil {
+		return 0, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return 0, fmt.Errorf("%s 数据结构错误: %v", migrate.VersionFile, err)
+	}
+	return state.Version, nil
+}
+
+// Apply 用备份替换数据目录和配置文件,原有内容重命名保留
+// 返回原数据目录的新位置,恢复前需要先停止服务
+func (a *Archive) Apply() (string, error) {
+	suffix := ".before-restore-" + time.Now().Format("20060102-150405")
+
+	previous := ""
+	if _, err := os.Stat(DataDir); err == nil {
+		previous = DataDir + suffix
+		if err := os.Rename(DataDir, previous); err != nil {
+			return "", err
+		}
+	}
+
+	restored := filepath.Join(a.dir, DataDir)
+	if err := os.MkdirAll(restored, 0755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(restored, DataDir); err != nil {
+		// 放回原数据目录
+		if previous != "" {
+			os.Rename(previous, DataDir)
+		}
+		return "", err
+	}
+
+	config := filepath.Join(a.dir, ConfigFile)
+	if _, err := os.Stat(config); err == nil {
+		if _, err := os.Stat(ConfigFile); err == nil {
+			if err := os.Rename(ConfigFile, ConfigFile+suffix); err != nil {
+				return previous, err
+			}
+		}
+		if err := os.Rename(config, ConfigFile); err != nil {
+			return previous, err
+		}
+	}
+
+	return previous, nil
+}
@@ -3,6 +3,8 @@ package config
 import (
 	"encoding/json"
 	"os"
+	"strconv"
+	"time"
 )
 
 // Config 应用配置结构
@@ -17,20 +19,36 @@ type ServerConfig struct {
 	Port   string `json:"port"`
 	Mode   string `json:"mode"`
 	Domain string `json:"domain"`
+	// 关闭服务时等待请求和后台任务完成的秒数,为 0 时使用默认值
+	ShutdownTimeout int `json:"shutdown_timeout"`
 }
 
+// 默认关闭超时
+const defaultShutdownTimeout = 30 * time.Second
+
 // EmailConfig 邮件配置
 type EmailConfig struct {
-	SMTPHost string `json:"smtp_host"`
-	SMTPPort int    `json:"smtp_port"`
-	Username string `json:"username"`
-	Password string `json:"password"`
-	From     string `json:"from"`
+	Transport string `json:"transport"` // 发送方式: smtp (默认)、file 或 http
+	SMTPHost  string `json:"smtp_host"`
+	SMTPPort  int    `json:"smtp_port"`
+	Security  string `json:"security"` // SMTP 加密方式: starttls、tls 或 none,为空时 465 端口使用 tls,其他端口使用 starttls
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	From      string `json:"from"`
+	// file 方式的保存位置,以 .mbox 结尾时追加到 mbox 文件,否则每封邮件保存为目录中的 .eml 文件
+	FilePath string `json:"file_path"`
+	// http 方式的服务商 (sendgrid 或 mailgun)、API 密钥、接口地址和 Mailgun 域名
+	APIProvider string `json:"api_provider"`
+	APIKey      string `json:"api_key"`
+	APIBaseURL  string `json:"api_base_url"`
+	APIDomain   string `json:"api_domain"`
 }
 
 // SecurityConfig 安全配置
 type SecurityConfig struct {
 	JWTSecret string `json:"jwt_secret"`
+	// 文件下载链接的签名密钥,为空时自动生成并保存在 data/download_secret
+	DownloadSecret string `json:"download_secret"`
 }
 
 var globalConfig *Config
@@ -75,6 +93,11 @@ func overrideWithEnv(config *Config) {
 	if mode := os.Getenv("SERVER_MODE"); mode != "" {
 		config.Server.Mode = mode
 	}
+	if timeout := os.Getenv("SHUTDOWN_TIMEOUT"); timeout != "" {
+		if seconds, err := strconv.Atoi(timeout); err == nil {
+			config.Server.ShutdownTimeout = seconds
+		}
+	}
 
 	// 邮件配置
 	if smtpHost := os.Getenv("SMTP_HOST"); smtpHost != "" {
@@ -93,11 +116,35 @@ func overrideWithEnv(config *Config) {
 	if from := os.Getenv("SMTP_FROM"); from != "" {
 		config.Email.From = from
 	}
+	if security := os.Getenv("SMTP_SECURITY"); security != "" {
+		config.Email.Security = security
+	}
+	if transport := os.Getenv("MAIL_TRANSPORT"); transport != "" {
+		config.Email.Transport = transport
+	}
+	if filePath := os.Getenv("MAIL_FILE_PATH"); filePath != "" {
+		config.Email.FilePath = filePath
+	}
+	if provider := os.Getenv("MAIL_API_PROVIDER"); provider != "" {
+		config.Email.APIProvider = provider
+	}
+	if apiKey := os.Getenv("MAIL_API_KEY"); apiKey != "" {
+		config.Email.APIKey = apiKey
+	}
+	if baseURL := os.Getenv("MAIL_API_BASE_URL"); baseURL != "" {
+		config.Email.APIBaseURL = baseURL
+	}
+	if domain := os.Getenv("MAIL_API_DOMAIN"); domain != "" {
+		config.Email.APIDomain = domain
+	}
 
 	// 安全配置
 	if jwtSecret := os.Getenv("JWT_SECRET"); jwtSecret != "" {
 		config.Security.JWTSecret = jwtSecret
 	}
+	if downloadSecret := os.Getenv("DOWNLOAD_SECRET"); downloadSecret != "" {
+		config.Security.DownloadSecret = downloadSecret
+	}
 }
 
 // getDefaultConfig 获取默认配置
@@ -123,7 +170,18 @@ func getDefaultConfig() *Config {
 
 // IsEmailConfigured 检查邮件是否已配置
 func (c *Config) IsEmailConfigured() bool {
+	if c.Email.Transport == "file" || c.Email.Transport == "http" {
+		return true
+	}
 	return c.Email.SMTPHost != "smtp.example.com" &&
 		c.Email.Username != "your-email@example.com" &&
 		c.Email.Password != "your-password"
 }
+
+// GetShutdownTimeout 获取关闭服务的超时时间
+func (c *Config) GetShutdownTimeout() time.Duration {
+	if c.Server.ShutdownTimeout <= 0 {
+		return defaultShutdownTimeout
+	}
+	return time.Duration(c.Server.ShutdownTimeout) * time.Second
+}
@@ -0,0 +1,61 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+)
+
+// csvWriter CSV 导出
+type csvWriter struct {
+	w *csv.Writer
+}
+
+// newCSVWriter 创建 CSV 导出,写入 UTF-8 BOM 以便 Excel 正确识别中文
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	if _, err := io.WriteString(w, "\xEF\xBB\xBF"); err != nil {
+		return nil, err
+	}
+	return &csvWriter{w: csv.NewWriter(w)}, nil
+}
+
+// WriteRow 写入一行
+func (cw *csvWriter) WriteRow(cells ...interface{}) error {
+	record := make([]string, len(cells))
+	for i, cell := range cells {
+		text, numeric := formatCell(cell)
+		if !numeric {
+			text = escapeFormula(text)
+		}
+		record[i] = text
+	}
+	return cw.w.Write(record)
+}
+
+// Close 结束导出
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// escapeFormula 防止以公式字符开头的文本在表格软件中被当作公式执行
+// 以 + 或 - 开头的数字和卡密 (只含字母、数字和 -_.) 不会调用函数,原样保留
+func escapeFormula(text string) string {
+	if text == "" || !strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return text
+	}
+	if (text[0] == '+' || text[0] == '-') && isPlainValue(text[1:]) {
+		return text
+	}
+	return "'" + text
+}
+
+// isPlainValue 判断文本是否只包含字母、数字和 -_.
+func isPlainValue(text string) bool {
+	for _, r := range text {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
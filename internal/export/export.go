@@ -0,0 +1,80 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// 导出格式
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// timeLayout 导出文件中的时间格式
+const timeLayout = "2006-01-02 15:04:05"
+
+// Writer 表格导出,逐行写入输出流,不在内存中保留已写入的行
+// 单元格支持 string、int、float64 和 time.Time,数值在 XLSX 中写为数字单元格
+type Writer interface {
+	WriteRow(cells ...interface{}) error
+	Close() error
+}
+
+// Supported 是否为支持的导出格式
+func Supported(format string) bool {
+	return format == FormatCSV || format == FormatXLSX
+}
+
+// ContentType 返回导出格式对应的 Content-Type
+func ContentType(format string) string {
+	if format == FormatXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// New 创建指定格式的导出
+func New(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w)
+	case FormatXLSX:
+		return newXLSXWriter(w)
+	}
+	return nil, fmt.Errorf("不支持的导出格式: %s", format)
+}
+
+// formatCell 将单元格转换为文本,返回是否为数值
+func formatCell(cell interface{}) (string, bool) {
+	switch v := cell.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, false
+	case int:
+		return strconv.Itoa(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case time.Time:
+		if v.IsZero() {
+			return "", false
+		}
+		return v.Local().Format(timeLayout), false
+	case *time.Time:
+		if v == nil || v.IsZero() {
+			return "", false
+		}
+		return v.Local().Format(timeLayout), false
+	case bool:
+		if v {
+			return "是", false
+		}
+		return "否", false
+	}
+	return fmt.Sprint(cell), false
+}
@@ -1,42 +1,112 @@
 package handlers
 
 import (
+	"ai-hacker/internal/audit"
 	"ai-hacker/internal/models"
 	"ai-hacker/internal/utils"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// OrderResponse 订单列表项,附带最近一封发货邮件的发送状态
+type OrderResponse struct {
+	models.Order
+	EmailDelivery *models.EmailLog `json:"email_delivery,omitempty"`
+}
+
+// 订单列表排序字段
+var orderListSpec = listSpec[OrderResponse]{
+	sorts: map[string]func(a, b *OrderResponse) int{
+		"id":         func(a, b *OrderResponse) int { return compareStrings(a.ID, b.ID) },
+		"email":      func(a, b *OrderResponse) int { return compareStrings(a.Email, b.Email) },
+		"status":     func(a, b *OrderResponse) int { return compareStrings(a.Status, b.Status) },
+		"amount":     func(a, b *OrderResponse) int { return compareFloats(a.Amount, b.Amount) },
+		"created_at": func(a, b *OrderResponse) int { return compareTimes(a.CreatedAt, b.CreatedAt) },
+	},
+	defaultSort: "created_at",
+	defaultDesc: true,
+	id:          func(o *OrderResponse) string { return o.ID },
+}
+
 // GetAllOrders 获取所有订单（管理员）
+// 支持按订单号、状态、邮箱、商品和下单时间筛选,每个订单附带发货邮件的发送状态 (email_delivery)
 func GetAllOrders(c *gin.Context) {
+	q, ok := parseListQuery(c)
+	if !ok {
+		return
+	}
+
 	var orders []models.Order
 	utils.LoadFromFile(ordersFile, &orders)
-	c.JSON(http.StatusOK, orders)
+
+	// 附带最近一封发货邮件的发送状态
+	deliveries := utils.OrderEmailDeliveries()
+	response := make([]OrderResponse, 0, len(orders))
+	for _, order := range orders {
+		item := OrderResponse{Order: order}
+		if d, ok := deliveries[order.ID]; ok {
+			item.EmailDelivery = &d
+		}
+		response = append(response, item)
+	}
+
+	// 不返回回收站中的订单
+	respondList(c, q, response, orderListSpec, func(o *OrderResponse) bool {
+		return !o.IsDeleted() && q.matchID(o.ID) && q.matchStatus(o.Status) &&
+			q.matchEmail(o.Email) && q.matchProduct(o.ProductID) && q.matchTime(o.CreatedAt)
+	})
+}
+
+// UserResponse 用户列表项,不包含密码
+type UserResponse struct {
+	ID        string    `json:"id"`
+	Email     string    `json:"email"`
+	Role      int       `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// 用户列表排序字段
+var userListSpec = listSpec[UserResponse]{
+	sorts: map[string]func(a, b *UserResponse) int{
+		"id":         func(a, b *UserResponse) int { return compareStrings(a.ID, b.ID) },
+		"email":      func(a, b *UserResponse) int { return compareStrings(a.Email, b.Email) },
+		"role":       func(a, b *UserResponse) int { return a.Role - b.Role },
+		"created_at": func(a, b *UserResponse) int { return compareTimes(a.CreatedAt, b.CreatedAt) },
+	},
+	id: func(u *UserResponse) string { return u.ID },
 }
 
 // GetAllUsers 获取所有用户（管理员）
+// 支持按 ID、邮箱和角色 (role) 筛选
 func GetAllUsers(c *gin.Context) {
+	q, ok := parseListQuery(c)
+	if !ok {
+		return
+	}
+	role := c.Query("role")
+
 	var users []models.User
 	utils.LoadFromFile(usersFile, &users)
 	
-	// 不返回密码
-	type UserResponse struct {
-		ID    string `json:"id"`
-		Email string `json:"email"`
-		Role  int    `json:"role"`
-	}
-	
-	var response []UserResponse
+	response := []UserResponse{}
 	for _, user := range users {
+		if user.IsDeleted() {
+			continue
+		}
 		response = append(response, UserResponse{
-			ID:    user.ID,
-			Email: user.Email,
-			Role:  user.Role,
+			ID:        user.ID,
+			Email:     user.Email,
+			Role:      user.Role,
+			CreatedAt: user.CreatedAt,
 		})
 	}
 	
-	c.JSON(http.StatusOK, response)
+	respondList(c, q, response, userListSpec, func(u *UserResponse) bool {
+		return q.matchID(u.ID) && q.matchEmail(u.Email) && (role == "" || strconv.Itoa(u.Role) == role)
+	})
 }
 
 // DeleteUser 删除用户（超级管理员）
@@ -46,30 +116,30 @@ func DeleteUser(c *gin.Context) {
 	var users []models.User
 	utils.LoadFromFile(usersFile, &users)
 
-	found := false
-	var deletedUser models.User
-	newUsers := []models.User{}
-	
-	for _, user := range users {
-		if user.ID == userID {
-			found = true
-			deletedUser = user
-			// 不能删除超级管理员
-			if user.Role == 3 {
-				c.JSON(http.StatusForbidden, gin.H{"error": "不能删除超级管理员"})
-				return
-			}
-			continue
+	var deletedUser *models.User
+	for i := range users {
+		if users[i].ID == userID && !users[i].IsDeleted() {
+			deletedUser = &users[i]
+			break
 		}
-		newUsers = append(newUsers, user)
 	}
 
-	if !found {
+	if deletedUser == nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
 		return
 	}
 
-	utils.SaveToFile(usersFile, newUsers)
+	// 不能删除超级管理员
+	if deletedUser.Role == 3 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "不能删除超级管理员"})
+		return
+	}
+
+	// 移入回收站
+	before := *deletedUser
+	deletedUser.MarkDeleted(c.GetString("email"), time.Now())
+	utils.SaveToFile(usersFile, users)
+	audit.Set(c, "users.delete", "users", userID, before, *deletedUser)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "用户删除成功",
@@ -86,13 +156,15 @@ func DeleteOrder(c *gin.Context) {
 	utils.LoadFromFile(ordersFile, &orders)
 
 	found := false
-	newOrders := []models.Order{}
-	for _, order := range orders {
-		if order.ID == orderID {
+	for i := range orders {
+		if orders[i].ID == orderID && !orders[i].IsDeleted() {
+			// 移入回收站
+			before := orders[i]
+			orders[i].MarkDeleted(c.GetString("email"), time.Now())
+			audit.Set(c, "orders.delete", "orders", orderID, before, orders[i])
 			found = true
-			continue
+			break
 		}
-		newOrders = append(newOrders, order)
 	}
 
 	if !found {
@@ -100,7 +172,7 @@ func DeleteOrder(c *gin.Context) {
 		return
 	}
 
-	utils.SaveToFile(ordersFile, newOrders)
+	utils.SaveToFile(ordersFile, orders)
 
 	c.JSON(http.StatusOK, gin.H{"message": "订单删除成功"})
 }
@@ -119,12 +191,17 @@ func CreateUser(c *gin.Context) {
 
 	// 检查邮箱是否已存在
 	for _, user := range users {
-		if user.Email == newUser.Email {
+		if user.Email == newUser.Email && !user.IsDeleted() {
 			c.JSON(http.StatusConflict, gin.H{"error": "邮箱已被注册"})
 			return
 		}
 	}
 
+	if !utils.RoleExists(newUser.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "角色不存在"})
+		return
+	}
+
 	// 加密密码
 	hashedPassword, err := utils.HashPassword(newUser.Password)
 	if err != nil {
@@ -132,9 +209,12 @@ func CreateUser(c *gin.Context) {
 		return
 	}
 	newUser.Password = hashedPassword
+	newUser.CreatedAt = time.Now()
+	newUser.SoftDelete = models.SoftDelete{}
 
 	users = append(users, newUser)
 	utils.SaveToFile(usersFile, users)
+	audit.Set(c, "users.create", "users", newUser.ID, nil, newUser)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "用户创建成功",
@@ -162,12 +242,19 @@ func UpdateUser(c *gin.Context) {
 		return
 	}
 
+	if !utils.RoleExists(updateData.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "角色不存在"})
+		return
+	}
+
 	var users []models.User
 	utils.LoadFromFile(usersFile, &users)
 
 	found := false
 	for i := range users {
-		if users[i].ID == userID {
+		if users[i].ID == userID && !users[i].IsDeleted() {
+			before := users[i]
+
 			// 更新邮箱
 			if updateData.Email != "" {
 				users[i].Email = updateData.Email
@@ -185,6 +272,7 @@ func UpdateUser(c *gin.Context) {
 
 			// 更新角色
 			users[i].Role = updateData.Role
+			audit.Set(c, "users.update", "users", userID, before, users[i])
 
 			found = true
 			break
@@ -220,17 +308,33 @@ func UpdateOrder(c *gin.Context) {
 	utils.LoadFromFile(ordersFile, &orders)
 
 	found := false
+	var paid *models.Order
 	for i := range orders {
-		if orders[i].ID == orderID {
-			// 更新状态
-			if updateData.Status != "" {
+		if orders[i].ID == orderID && !orders[i].IsDeleted() {
+			before := orders[i]
+
+			// 更新状态,退款和取消需通过专门的操作完成
+			if updateData.Status != "" && updateData.Status != orders[i].Status {
+				if updateData.Status != models.OrderStatusPending && updateData.Status != models.OrderStatusCompleted {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "退款和取消请使用对应的订单操作"})
+					return
+				}
+				if !canTransition(orders[i].Status, updateData.Status) {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "订单状态为" + orders[i].Status + "，不能变更为" + updateData.Status})
+					return
+				}
 				orders[i].Status = updateData.Status
+				// 处理中的订单确认完成视为已支付
+				if updateData.Status == models.OrderStatusCompleted {
+					paid = &orders[i]
+				}
 			}
 
 			// 更新卡密
 			if updateData.CardKey != "" {
 				orders[i].CardKey = updateData.CardKey
 			}
+			audit.Set(c, "orders.update", "orders", orderID, before, orders[i])
 
 			found = true
 			break
@@ -243,6 +347,11 @@ func UpdateOrder(c *gin.Context) {
 	}
 
 	utils.SaveToFile(ordersFile, orders)
+	if paid != nil {
+		utils.PublishWebhookEvent(models.WebhookEventOrderPaid, orderWebhookData(*paid))
+		utils.PublishAdminEvent(utils.AdminEventOrderPaid, orderWebhookData(*paid))
+		notifyOrderPaid(*paid)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "订单更新成功"})
 }
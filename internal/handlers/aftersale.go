@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"ai-hacker/internal/audit"
+	"ai-hacker/internal/models"
+	"ai-hacker/internal/utils"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReplaceOrderKey 售后更换卡密（管理员）
+// 原卡密标记为失效,从同一商品分配新卡密并重新发送发货邮件
+func ReplaceOrderKey(c *gin.Context) {
+	orderID := c.Param("id")
+
+	var req struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请填写换卡原因"})
+		return
+	}
+
+	var orders []models.Order
+	utils.LoadFromFile(ordersFile, &orders)
+
+	var order *models.Order
+	for i := range orders {
+		if orders[i].ID == orderID && !orders[i].IsDeleted() {
+			order = &orders[i]
+			break
+		}
+	}
+
+	if order == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
+		return
+	}
+
+	if order.Status != models.OrderStatusCompleted && order.Status != models.OrderStatusPartialRefunded {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "订单状态为" + order.Status + "，不能更换卡密"})
+		return
+	}
+
+	product := orderProduct(order)
+	if product == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "订单对应的商品不存在"})
+		return
+	}
+
+	stock := GetProductStock(product.ID)
+	newCardKey := GetAvailableCardKey(product.ID)
+	if newCardKey == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "暂无可用卡密"})
+		return
+	}
+
+	// 原卡密标记为失效
+	oldCardKeyID := order.CardKeyID
+	if oldCardKeyID == "" {
+		oldCardKeyID = findOrderCardKeyID(order.ID, order.CardKey)
+	}
+	if oldCardKeyID != "" {
+		markCardKeyDefective(oldCardKeyID)
+	}
+
+	MarkCardKeyAsUsed(newCardKey.ID, order.ID)
+
+	replacement := models.KeyReplacement{
+		OldCardKeyID: oldCardKeyID,
+		OldKey:       order.CardKey,
+		NewCardKeyID: newCardKey.ID,
+		NewKey:       newCardKey.Key,
+		Reason:       req.Reason,
+		Operator:     c.GetString("email"),
+		CreatedAt:    time.Now(),
+	}
+	applyCardKey(order, product, newCardKey)
+	order.Replacements = append(order.Replacements, replacement)
+	audit.Set(c, "orders.replace_key", "orders", order.ID, gin.H{"card_key_id": oldCardKeyID}, gin.H{"card_key_id": newCardKey.ID})
+	audit.SetDetail(c, "原因: "+req.Reason)
+
+	utils.SaveToFile(ordersFile, orders)
+
+	checkLowStock(product, stock)
+
+	// 重新发送发货邮件
+	resent := *order
+	if _, err := utils.QueueOrderEmail(resent); err != nil {
+		log.Printf("换卡邮件加入发送队列失败: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "卡密更换成功",
+		"order":   resent,
+	})
+}
+
+// orderProduct 获取订单对应的商品,兼容只记录了商品名称的旧订单
+func orderProduct(order *models.Order) *models.Product {
+	if order.ProductID != "" {
+		return findProduct(order.ProductID)
+	}
+
+	var products []models.Product
+	utils.LoadFromFile(productsFile, &products)
+
+	for i := range products {
+		if products[i].Name == order.ProductName && !products[i].IsDeleted() {
+			return &products[i]
+		}
+	}
+	return nil
+}
+
+// findOrderCardKeyID 按订单号查找已发放的卡密,用于未记录卡密 ID 的旧订单
+func findOrderCardKeyID(orderID, key string) string {
+	var cardKeys []models.CardKey
+	utils.LoadFromFile(cardKeysFile, &cardKeys)
+
+	for _, ck := range cardKeys {
+		if ck.OrderID == orderID && ck.Key == key {
+			return ck.ID
+		}
+	}
+	return ""
+}
+
+// markCardKeyDefective 标记卡密为失效
+func markCardKeyDefective(cardKeyID string) {
+	var cardKeys []models.CardKey
+	utils.LoadFromFile(cardKeysFile, &cardKeys)
+
+	for i := range cardKeys {
+		if cardKeys[i].ID == cardKeyID {
+			cardKeys[i].Status = "defective"
+			utils.SaveToFile(cardKeysFile, cardKeys)
+			return
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"ai-hacker/internal/audit"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 审计日志列表排序字段
+var auditListSpec = listSpec[audit.Entry]{
+	sorts: map[string]func(a, b *audit.Entry) int{
+		"seq":  func(a, b *audit.Entry) int { return int(a.Seq - b.Seq) },
+		"time": func(a, b *audit.Entry) int { return compareTimes(a.Time, b.Time) },
+	},
+	defaultSort: "seq",
+	defaultDesc: true,
+	id:          func(e *audit.Entry) string { return strconv.FormatInt(e.Seq, 10) },
+}
+
+// GetAuditLogs 查询审计日志（管理员）
+// 支持按操作人 (actor)、对象 (entity)、操作 (action) 和时间范围筛选
+func GetAuditLogs(c *gin.Context) {
+	q, ok := parseListQuery(c)
+	if !ok {
+		return
+	}
+
+	entries, err := audit.Query(audit.Filter{
+		Actor:  c.Query("actor"),
+		Entity: c.Query("entity"),
+		Action: c.Query("action"),
+		From:   q.From,
+		To:     q.To,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取审计日志失败: " + err.Error()})
+		return
+	}
+
+	respondList(c, q, entries, auditListSpec, func(e *audit.Entry) bool {
+		return q.matchID(e.TargetID)
+	})
+}
+
+// VerifyAuditLog 校验审计日志哈希链是否完整（管理员）
+func VerifyAuditLog(c *gin.Context) {
+	count, err := audit.Verify()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"valid":    false,
+			"verified": count,
+			"error":    err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"valid":    true,
+		"verified": count,
+	})
+}
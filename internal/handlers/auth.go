@@ -4,6 +4,7 @@ import (
 	"ai-hacker/internal/models"
 	"ai-hacker/internal/utils"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -26,7 +27,7 @@ func SendVerifyCode(c *gin.Context) {
 
 	// 检查邮箱是否已注册
 	for _, user := range users {
-		if user.Email == req.Email {
+		if user.Email == req.Email && !user.IsDeleted() {
 			c.JSON(http.StatusConflict, gin.H{"error": "该邮箱已被注册"})
 			return
 		}
@@ -69,7 +70,7 @@ func Register(c *gin.Context) {
 
 	// 检查邮箱是否已存在
 	for _, user := range users {
-		if user.Email == req.Email {
+		if user.Email == req.Email && !user.IsDeleted() {
 			c.JSON(http.StatusConflict, gin.H{"error": "邮箱已被注册"})
 			return
 		}
@@ -84,10 +85,11 @@ func Register(c *gin.Context) {
 
 	// 创建新用户
 	newUser := models.User{
-		ID:       "U" + utils.GenerateID(),
-		Email:    req.Email,
-		Password: hashedPassword,
-		Role:     1, // 默认为普通用户
+		ID:        "U" + utils.GenerateID(),
+		Email:     req.Email,
+		Password:  hashedPassword,
+		Role:      1, // 默认为普通用户
+		CreatedAt: time.Now(),
 	}
 
 	users = append(users, newUser)
@@ -96,6 +98,12 @@ func Register(c *gin.Context) {
 	// 删除已使用的验证码
 	utils.DeleteVerifyCode(req.Email)
 
+	utils.PublishWebhookEvent(models.WebhookEventUserRegistered, gin.H{
+		"user_id":    newUser.ID,
+		"email":      newUser.Email,
+		"created_at": newUser.CreatedAt,
+	})
+
 	// 生成 JWT Token
 	token, err := utils.GenerateToken(newUser.ID, newUser.Email, newUser.Role)
 	if err != nil {
@@ -127,7 +135,7 @@ func Login(c *gin.Context) {
 
 	// 验证用户
 	for _, user := range users {
-		if user.Email == loginData.Email {
+		if user.Email == loginData.Email && !user.IsDeleted() {
 			// 验证密码
 			if !utils.CheckPassword(loginData.Password, user.Password) {
 				c.JSON(http.StatusUnauthorized, gin.H{"error": "邮箱或密码错误"})
@@ -172,15 +180,15 @@ func ForgotPassword(c *gin.Context) {
 	utils.LoadFromFile(usersFile, &users)
 
 	// 检查邮箱是否存在
-	found := false
+	userID := ""
 	for _, user := range users {
-		if user.Email == req.Email {
-			found = true
+		if user.Email == req.Email && !user.IsDeleted() {
+			userID = user.ID
 			break
 		}
 	}
 
-	if !found {
+	if userID == "" {
 		c.JSON(http.StatusNotFound, gin.H{"error": "该邮箱未注册"})
 		return
 	}
@@ -193,7 +201,7 @@ func ForgotPassword(c *gin.Context) {
 	}
 
 	// 发送重置密码邮件
-	if err := utils.SendResetPasswordEmail(req.Email, token); err != nil {
+	if err := utils.SendResetPasswordEmail(userID, req.Email, token); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "发送邮件失败"})
 		return
 	}
@@ -226,7 +234,7 @@ func ResetPassword(c *gin.Context) {
 	// 更新密码
 	found := false
 	for i := range users {
-		if users[i].Email == email {
+		if users[i].Email == email && !users[i].IsDeleted() {
 			hashedPassword, err := utils.HashPassword(req.NewPassword)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "密码加密失败"})
@@ -274,7 +282,7 @@ func ChangePassword(c *gin.Context) {
 	// 查找用户并验证旧密码
 	found := false
 	for i := range users {
-		if users[i].Email == email.(string) {
+		if users[i].Email == email.(string) && !users[i].IsDeleted() {
 			// 验证旧密码
 			if !utils.CheckPassword(req.OldPassword, users[i].Password) {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "旧密码错误"})
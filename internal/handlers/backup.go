@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"ai-hacker/internal/audit"
+	"ai-hacker/internal/backup"
+	"ai-hacker/internal/models"
+	"ai-hacker/internal/utils"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BackupDir 备份文件目录,位于数据目录之外
+const BackupDir = "backups"
+
+// 定时备份默认值
+const (
+	defaultBackupIntervalHours = 24
+	defaultBackupRetention     = 7
+)
+
+// backupMu 避免定时备份和手动备份同时进行
+var backupMu sync.Mutex
+
+// BackupPassphrase 备份密码,通过环境变量 BACKUP_PASSPHRASE 设置,为空时不加密
+// 密码不保存在数据目录中,否则会被一起备份
+func BackupPassphrase() string {
+	return os.Getenv("BACKUP_PASSPHRASE")
+}
+
+// GetBackupSettings 获取定时备份间隔 (小时,0 表示关闭) 和保留的备份数量
+func GetBackupSettings() (int, int) {
+	var settings []models.Setting
+	utils.LoadFromFile(settingsFile, &settings)
+
+	interval := defaultBackupIntervalHours
+	retention := defaultBackupRetention
+	for _, s := range settings {
+		if s.Value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s.Value)
+		if err != nil || n < 0 {
+			continue
+		}
+		switch s.Key {
+		case "backup_interval_hours":
+			interval = n
+		case "backup_retention":
+			if n > 0 {
+				retention = n
+			}
+		}
+	}
+	return interval, retention
+}
+
+// RunBackup 生成一次备份并按保留数量清理旧备份
+func RunBackup() (string, *backup.Manifest, error) {
+	backupMu.Lock()
+	defer backupMu.Unlock()
+
+	path, manifest, err := backup.CreateFile(BackupDir, BackupPassphrase())
+	if err != nil {
+		return "", nil, err
+	}
+
+	_, retention := GetBackupSettings()
+	removed, err := backup.Rotate(BackupDir, retention)
+	if err != nil {
+		log.Printf("清理旧备份失败: %v", err)
+	}
+	if len(removed) > 0 {
+		log.Printf("清理旧备份 %d 个", len(removed))
+	}
+
+	return path, manifest, nil
+}
+
+// StartBackupJob 启动定时备份任务,每小时检查一次,距上次备份超过设置的间隔时执行
+// ctx 结束时退出,正在进行的备份会先完成
+func StartBackupJob(ctx context.Context) {
+	utils.Go(func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			interval, _ := GetBackupSettings()
+			if interval == 0 {
+				continue
+			}
+
+			backups, err := backup.List(BackupDir)
+			if err != nil {
+				log.Printf("读取备份列表失败: %v", err)
+				continue
+			}
+			if len(backups) > 0 && time.Since(backups[0].CreatedAt) < time.Duration(interval)*time.Hour {
+				continue
+			}
+
+			path, _, err := RunBackup()
+			if err != nil {
+				log.Printf("定时备份失败: %v", err)
+				utils.NotifyAdmins("backup.failed", "定时备份失败", "定时备份失败: "+err.Error(), map[string]interface{}{
+					"error": err.Error(),
+				})
+				continue
+			}
+			log.Printf("定时备份完成: %s", path)
+		}
+	})
+}
+
+// GetBackups 获取备份列表（管理员）
+func GetBackups(c *gin.Context) {
+	backups, err := backup.List(BackupDir)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取备份列表失败"})
+		return
+	}
+
+	interval, retention := GetBackupSettings()
+	c.JSON(http.StatusOK, gin.H{
+		"backups":        backups,
+		"interval_hours": interval,
+		"retention":      retention,
+		"encrypted":      BackupPassphrase() != "",
+	})
+}
+
+// CreateBackup 立即生成备份（管理员）
+func CreateBackup(c *gin.Context) {
+	path, manifest, err := RunBackup()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "备份失败: " + err.Error()})
+		return
+	}
+
+	name := filepath.Base(path)
+	audit.Set(c, "backups.create", "backups", name, nil, nil)
+	audit.SetDetail(c, fmt.Sprintf("备份 %d 个文件", len(manifest.Files)))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "备份成功",
+		"name":    name,
+		"files":   len(manifest.Files),
+	})
+}
+
+// DownloadBackup 下载备份文件（管理员）
+func DownloadBackup(c *gin.Context) {
+	name := c.Param("name")
+
+	// 只允许下载备份列表中的文件
+	backups, err := backup.List(BackupDir)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取备份列表失败"})
+		return
+	}
+	found := false
+	for _, b := range backups {
+		if b.Name == name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "备份不存在"})
+		return
+	}
+
+	audit.Set(c, "backups.download", "backups", name, nil, nil)
+	c.FileAttachment(filepath.Join(BackupDir, name), name)
+}
@@ -1,9 +1,15 @@
 package handlers
 
 import (
+	"ai-hacker/internal/audit"
 	"ai-hacker/internal/models"
 	"ai-hacker/internal/utils"
+	"encoding/csv"
+	"fmt"
+	"io"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -11,25 +17,50 @@ import (
 const cardKeysFile = "data/card_keys.json"
 
 // GetCardKeys 获取卡密列表（管理员）
+// 支持按 ID、商品、状态和使用时间筛选
 func GetCardKeys(c *gin.Context) {
-	productID := c.Query("product_id")
+	q, ok := parseListQuery(c)
+	if !ok {
+		return
+	}
 
 	var cardKeys []models.CardKey
 	utils.LoadFromFile(cardKeysFile, &cardKeys)
 
-	// 如果指定了商品ID,只返回该商品的卡密
-	if productID != "" {
-		filtered := []models.CardKey{}
-		for _, ck := range cardKeys {
-			if ck.ProductID == productID {
-				filtered = append(filtered, ck)
-			}
-		}
-		c.JSON(http.StatusOK, filtered)
+	// 不返回回收站中的卡密,时间范围按使用时间筛选
+	page, err := paginate(cardKeys, q, cardKeyListSpec, func(ck *models.CardKey) bool {
+		return !ck.IsDeleted() && q.matchID(ck.ID) && q.matchProduct(ck.ProductID) &&
+			q.matchStatus(ck.Status) && q.matchTimeString(ck.UsedAt)
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, cardKeys)
+	// 默认返回脱敏后的卡密,明文需通过查看接口获取
+	for i := range page.Items {
+		page.Items[i] = maskCardKey(page.Items[i])
+	}
+
+	// 查看卡密需要留痕
+	audit.Set(c, "cardkeys.view", "cardkeys", "", nil, nil)
+	if q.ProductID != "" {
+		audit.SetDetail(c, "商品 "+q.ProductID)
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// 卡密列表排序字段,默认按导入顺序
+var cardKeyListSpec = listSpec[models.CardKey]{
+	sorts: map[string]func(a, b *models.CardKey) int{
+		"id":         func(a, b *models.CardKey) int { return compareStrings(a.ID, b.ID) },
+		"product_id": func(a, b *models.CardKey) int { return compareStrings(a.ProductID, b.ProductID) },
+		"status":     func(a, b *models.CardKey) int { return compareStrings(a.Status, b.Status) },
+		"used_at":    func(a, b *models.CardKey) int { return compareStrings(a.UsedAt, b.UsedAt) },
+		"expires_at": func(a, b *models.CardKey) int { return compareStrings(a.ExpiresAt, b.ExpiresAt) },
+	},
+	id: func(ck *models.CardKey) string { return ck.ID },
 }
 
 // CreateCardKey 创建卡密（管理员）
@@ -39,6 +70,22 @@ func CreateCardKey(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// 新建的卡密不能直接位于回收站
+	newCardKey.SoftDelete = models.SoftDelete{}
+
+	product := findProduct(newCardKey.ProductID)
+	if product == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "商品不存在"})
+		return
+	}
+
+	// 按商品字段定义校验卡密内容
+	if msg := normalizeCardKey(&newCardKey, product); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	stockBefore := GetProductStock(newCardKey.ProductID)
 
 	var cardKeys []models.CardKey
 	utils.LoadFromFile(cardKeysFile, &cardKeys)
@@ -48,6 +95,10 @@ func CreateCardKey(c *gin.Context) {
 
 	cardKeys = append(cardKeys, newCardKey)
 	utils.SaveToFile(cardKeysFile, cardKeys)
+	audit.Set(c, "cardkeys.create", "cardkeys", newCardKey.ID, nil, newCardKey)
+
+	// 到货通知
+	checkRestock(newCardKey.ProductID, stockBefore)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "卡密创建成功",
@@ -55,6 +106,185 @@ func CreateCardKey(c *gin.Context) {
 	})
 }
 
+// ImportCardKeys 批量导入卡密（管理员）
+// 支持 JSON 提交 CSV 文本,或 multipart 表单上传 CSV 文件
+func ImportCardKeys(c *gin.Context) {
+	var req struct {
+		ProductID string   `json:"product_id" form:"product_id" binding:"required"`
+		CSV       string   `json:"csv" form:"csv"`
+		Columns   []string `json:"columns" form:"columns"`       // 每列对应的字段名,空字符串表示忽略该列
+		HasHeader bool     `json:"has_header" form:"has_header"` // 首行为表头
+	}
+
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	// 上传文件优先于表单中的 CSV 文本
+	if file, err := c.FormFile("file"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "读取上传文件失败"})
+			return
+		}
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "读取上传文件失败"})
+			return
+		}
+		req.CSV = string(data)
+	}
+
+	if strings.TrimSpace(req.CSV) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "导入内容为空"})
+		return
+	}
+
+	product := findProduct(req.ProductID)
+	if product == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "商品不存在"})
+		return
+	}
+
+	columns := req.Columns
+	if len(columns) == 1 && strings.Contains(columns[0], ",") {
+		// 表单提交时 columns 为逗号分隔的字符串
+		columns = strings.Split(columns[0], ",")
+	}
+
+	result, err := ImportCardKeysCSV(product, req.CSV, columns, req.HasHeader)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	audit.Set(c, "cardkeys.import", "cardkeys", "", nil, nil)
+	audit.SetDetail(c, fmt.Sprintf("商品 %s 导入 %d 个卡密,失败 %d 个", product.ID, result.Imported, result.Failed))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  fmt.Sprintf("成功导入 %d 个卡密", result.Imported),
+		"imported": result.Imported,
+		"failed":   result.Failed,
+		"errors":   result.Errors,
+	})
+}
+
+// CardKeyImportError 导入失败的行
+type CardKeyImportError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// CardKeyImportResult 卡密导入结果
+type CardKeyImportResult struct {
+	Imported int                  `json:"imported"`
+	Failed   int                  `json:"failed"`
+	Errors   []CardKeyImportError `json:"errors"`
+}
+
+// ImportCardKeysCSV 按列映射导入 CSV 中的卡密,管理后台和命令行共用
+// columns 为空时按表头匹配或使用默认列,CSV 格式错误或列映射无效时返回错误,单行错误记录在结果中
+func ImportCardKeysCSV(product *models.Product, text string, columns []string, hasHeader bool) (*CardKeyImportResult, error) {
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("CSV 格式错误: %v", err)
+	}
+
+	if hasHeader && len(records) > 0 {
+		if len(columns) == 0 {
+			columns = matchImportHeader(records[0], product)
+		}
+		records = records[1:]
+	}
+	if len(columns) == 0 {
+		columns = defaultImportColumns(product)
+	}
+
+	// 校验列映射
+	for _, col := range columns {
+		if col != "" && !isImportColumn(col, product) {
+			return nil, fmt.Errorf("未知的字段: %s", col)
+		}
+	}
+
+	stockBefore := GetProductStock(product.ID)
+
+	var cardKeys []models.CardKey
+	utils.LoadFromFile(cardKeysFile, &cardKeys)
+
+	// 已存在的卡密,用于去重
+	existing := make(map[string]bool)
+	for _, ck := range cardKeys {
+		if ck.ProductID == product.ID && !ck.IsDeleted() {
+			existing[ck.Key] = true
+		}
+	}
+
+	var imported []models.CardKey
+	var errors []CardKeyImportError
+	baseID := utils.GenerateID()
+	for i, record := range records {
+		line := i + 1
+		if hasHeader {
+			line++
+		}
+
+		ck := models.CardKey{
+			ID:        fmt.Sprintf("CK%s_%d", baseID, i),
+			ProductID: product.ID,
+		}
+		empty := true
+		for j, value := range record {
+			value = strings.TrimSpace(value)
+			if j >= len(columns) || columns[j] == "" || value == "" {
+				continue
+			}
+			empty = false
+			if columns[j] == "key" {
+				ck.Key = value
+				continue
+			}
+			if columns[j] == "expires_at" {
+				ck.ExpiresAt = value
+				continue
+			}
+			if ck.Fields == nil {
+				ck.Fields = make(map[string]string)
+			}
+			ck.Fields[columns[j]] = value
+		}
+		if empty {
+			continue
+		}
+
+		if msg := normalizeCardKey(&ck, product); msg != "" {
+			errors = append(errors, CardKeyImportError{Line: line, Error: msg})
+			continue
+		}
+		if existing[ck.Key] {
+			errors = append(errors, CardKeyImportError{Line: line, Error: "卡密重复"})
+			continue
+		}
+		existing[ck.Key] = true
+
+		ck.Status = "unused"
+		imported = append(imported, ck)
+	}
+
+	if len(imported) > 0 {
+		cardKeys = append(cardKeys, imported...)
+		utils.SaveToFile(cardKeysFile, cardKeys)
+		checkRestock(product.ID, stockBefore)
+		publishCardKeysImported(product.ID, len(imported), "csv")
+	}
+
+	return &CardKeyImportResult{Imported: len(imported), Failed: len(errors), Errors: errors}, nil
+}
+
 // DeleteCardKey 删除卡密（管理员）
 func DeleteCardKey(c *gin.Context) {
 	cardKeyID := c.Param("id")
@@ -63,13 +293,17 @@ func DeleteCardKey(c *gin.Context) {
 	utils.LoadFromFile(cardKeysFile, &cardKeys)
 
 	found := false
-	newCardKeys := []models.CardKey{}
-	for _, ck := range cardKeys {
-		if ck.ID == cardKeyID {
+	productID, stockBefore := "", 0
+	for i := range cardKeys {
+		if cardKeys[i].ID == cardKeyID && !cardKeys[i].IsDeleted() {
+			// 移入回收站,文件类卡密的文件在彻底清除时删除
+			before := cardKeys[i]
+			productID, stockBefore = before.ProductID, GetProductStock(before.ProductID)
+			cardKeys[i].MarkDeleted(c.GetString("email"), time.Now())
+			audit.Set(c, "cardkeys.delete", "cardkeys", cardKeyID, before, cardKeys[i])
 			found = true
-			continue
+			break
 		}
-		newCardKeys = append(newCardKeys, ck)
 	}
 
 	if !found {
@@ -77,23 +311,40 @@ func DeleteCardKey(c *gin.Context) {
 		return
 	}
 
-	utils.SaveToFile(cardKeysFile, newCardKeys)
+	utils.SaveToFile(cardKeysFile, cardKeys)
+	publishStockChanged(productID, stockBefore)
 
 	c.JSON(http.StatusOK, gin.H{"message": "卡密删除成功"})
 }
 
 // GetAvailableCardKey 获取可用卡密
+// 优先分配最早过期的卡密,无有效期的卡密排在最后,同等条件下按导入顺序分配
 func GetAvailableCardKey(productID string) *models.CardKey {
 	var cardKeys []models.CardKey
 	utils.LoadFromFile(cardKeysFile, &cardKeys)
 
+	now := time.Now()
+	var selected *models.CardKey
+	var selectedExpiry time.Time
 	for i := range cardKeys {
-		if cardKeys[i].ProductID == productID && cardKeys[i].Status == "unused" {
-			return &cardKeys[i]
+		ck := &cardKeys[i]
+		if ck.ProductID != productID || ck.Status != "unused" || ck.IsDeleted() || isCardKeyExpired(ck, now) {
+			continue
+		}
+
+		expiry, hasExpiry := cardKeyExpiry(ck)
+		if selected == nil {
+			selected, selectedExpiry = ck, expiry
+			continue
+		}
+
+		_, selectedHasExpiry := cardKeyExpiry(selected)
+		if hasExpiry && (!selectedHasExpiry || expiry.Before(selectedExpiry)) {
+			selected, selectedExpiry = ck, expiry
 		}
 	}
 
-	return nil
+	return selected
 }
 
 // MarkCardKeyAsUsed 标记卡密为已使用
@@ -114,17 +365,147 @@ func MarkCardKeyAsUsed(cardKeyID, orderID string) error {
 	return nil
 }
 
+// countUnsoldCardKeys 统计商品下未售出的卡密数量,包括已过期未处理的
+func countUnsoldCardKeys(productID string) int {
+	var cardKeys []models.CardKey
+	utils.LoadFromFile(cardKeysFile, &cardKeys)
+
+	count := 0
+	for _, ck := range cardKeys {
+		if ck.ProductID == productID && ck.Status == "unused" && !ck.IsDeleted() {
+			count++
+		}
+	}
+	return count
+}
+
 // GetProductStock 获取商品库存（未使用的卡密数量）
 func GetProductStock(productID string) int {
 	var cardKeys []models.CardKey
 	utils.LoadFromFile(cardKeysFile, &cardKeys)
 
+	now := time.Now()
 	count := 0
-	for _, ck := range cardKeys {
-		if ck.ProductID == productID && ck.Status == "unused" {
+	for i := range cardKeys {
+		ck := &cardKeys[i]
+		if ck.ProductID == productID && ck.Status == "unused" && !ck.IsDeleted() && !isCardKeyExpired(ck, now) {
 			count++
 		}
 	}
 
 	return count
 }
+
+// cardKeyExpiry 获取卡密有效期,未设置或格式错误时返回 false
+func cardKeyExpiry(ck *models.CardKey) (time.Time, bool) {
+	if ck.ExpiresAt == "" {
+		return time.Time{}, false
+	}
+	t, err := utils.ParseTime(ck.ExpiresAt)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// isCardKeyExpired 检查卡密是否已过期
+func isCardKeyExpired(ck *models.CardKey, now time.Time) bool {
+	expiry, ok := cardKeyExpiry(ck)
+	return ok && !now.Before(expiry)
+}
+
+// normalizeCardKey 按商品字段定义校验卡密,返回错误信息
+// 结构化卡密未提供 Key 时,由各字段拼接生成
+func normalizeCardKey(ck *models.CardKey, product *models.Product) string {
+	// 有效期统一为标准时间格式
+	if ck.ExpiresAt != "" {
+		t, err := utils.ParseTime(ck.ExpiresAt)
+		if err != nil {
+			return "有效期格式错误: " + ck.ExpiresAt
+		}
+		ck.ExpiresAt = t.Format(utils.TimeLayout)
+	}
+
+	if product == nil || len(product.KeyFields) == 0 {
+		if len(ck.Fields) > 0 {
+			return "该商品未定义卡密字段"
+		}
+		if strings.TrimSpace(ck.Key) == "" {
+			return "卡密不能为空"
+		}
+		return ""
+	}
+
+	if len(ck.Fields) == 0 {
+		return "卡密字段不能为空"
+	}
+	for name := range ck.Fields {
+		if !hasKeyField(product, name) {
+			return "未知的卡密字段: " + name
+		}
+	}
+
+	if ck.Key == "" {
+		ck.Key = utils.JoinCardKeyFields(utils.CardKeyFieldValues(product.KeyFields, ck.Fields))
+	}
+	return ""
+}
+
+// hasKeyField 商品是否定义了指定卡密字段
+func hasKeyField(product *models.Product, name string) bool {
+	for _, f := range product.KeyFields {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isImportColumn 检查导入列名是否有效
+func isImportColumn(col string, product *models.Product) bool {
+	return col == "key" || col == "expires_at" || hasKeyField(product, col)
+}
+
+// defaultImportColumns 未指定列映射时按商品字段定义顺序导入
+func defaultImportColumns(product *models.Product) []string {
+	if len(product.KeyFields) == 0 {
+		return []string{"key"}
+	}
+	columns := make([]string, 0, len(product.KeyFields))
+	for _, f := range product.KeyFields {
+		columns = append(columns, f.Name)
+	}
+	return columns
+}
+
+// builtinImportColumn 返回表头对应的内置列 (单行卡密 key 或有效期 expires_at),不是内置列时返回空
+// 内置列优先于商品字段,商品字段的标识和标签不能使用这些名称
+func builtinImportColumn(h string) string {
+	h = strings.TrimSpace(h)
+	if strings.EqualFold(h, "key") || h == "卡密" {
+		return "key"
+	}
+	if strings.EqualFold(h, "expires_at") || h == "有效期" {
+		return "expires_at"
+	}
+	return ""
+}
+
+// matchImportHeader 按表头匹配字段名或标签,无法匹配的列将被忽略
+func matchImportHeader(header []string, product *models.Product) []string {
+	columns := make([]string, len(header))
+	for i, h := range header {
+		h = strings.TrimSpace(h)
+		if col := builtinImportColumn(h); col != "" {
+			columns[i] = col
+			continue
+		}
+		for _, f := range product.KeyFields {
+			if strings.EqualFold(h, f.Name) || h == f.Label {
+				columns[i] = f.Name
+				break
+			}
+		}
+	}
+	return columns
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"ai-hacker/internal/models"
+	"ai-hacker/internal/utils"
+	"context"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const expiryReportsFile = "data/expiry_reports.json"
+
+// ExpireCardKeys 将已过期的未使用卡密标记为 expired,并生成损失报告
+func ExpireCardKeys() models.ExpiryReport {
+	var cardKeys []models.CardKey
+	utils.LoadFromFile(cardKeysFile, &cardKeys)
+
+	var products []models.Product
+	utils.LoadFromFile(productsFile, &products)
+
+	productMap := make(map[string]models.Product)
+	for _, p := range products {
+		productMap[p.ID] = p
+	}
+
+	now := time.Now()
+	report := models.ExpiryReport{
+		ID:       "EXP" + utils.GenerateID(),
+		RunAt:    now,
+		Products: []models.ExpiryProductLoss{},
+	}
+	losses := make(map[string]*models.ExpiryProductLoss)
+
+	for i := range cardKeys {
+		ck := &cardKeys[i]
+		if ck.Status != "unused" || ck.IsDeleted() || !isCardKeyExpired(ck, now) {
+			continue
+		}
+
+		ck.Status = "expired"
+		product := productMap[ck.ProductID]
+
+		loss, ok := losses[ck.ProductID]
+		if !ok {
+			loss = &models.ExpiryProductLoss{
+				ProductID:   ck.ProductID,
+				ProductName: product.Name,
+			}
+			losses[ck.ProductID] = loss
+		}
+		loss.Count++
+		loss.Value += product.Price
+
+		report.ExpiredCount++
+		report.LostValue += product.Price
+	}
+
+	if report.ExpiredCount == 0 {
+		return report
+	}
+
+	utils.SaveToFile(cardKeysFile, cardKeys)
+
+	for _, loss := range losses {
+		report.Products = append(report.Products, *loss)
+	}
+
+	var reports []models.ExpiryReport
+	utils.LoadFromFile(expiryReportsFile, &reports)
+	reports = append(reports, report)
+	utils.SaveToFile(expiryReportsFile, reports)
+
+	log.Printf("卡密过期处理: %d 个卡密已过期,库存损失 ￥%.2f", report.ExpiredCount, report.LostValue)
+	return report
+}
+
+// StartCardKeyExpiryJob 启动卡密过期处理任务,启动时执行一次,之后每天执行,ctx 结束时退出
+func StartCardKeyExpiryJob(ctx context.Context) {
+	utils.Go(func() {
+		ExpireCardKeys()
+
+		ticker := time.NewTicker(24 * time.Hour)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				ExpireCardKeys()
+			}
+		}
+	})
+}
+
+// 过期报告列表排序字段
+var expiryReportListSpec = listSpec[models.ExpiryReport]{
+	sorts: map[string]func(a, b *models.ExpiryReport) int{
+		"run_at":     func(a, b *models.ExpiryReport) int { return compareTimes(a.RunAt, b.RunAt) },
+		"lost_value": func(a, b *models.ExpiryReport) int { return compareFloats(a.LostValue, b.LostValue) },
+	},
+	defaultSort: "run_at",
+	defaultDesc: true,
+	id:          func(r *models.ExpiryReport) string { return r.ID },
+}
+
+// GetExpiryReports 获取卡密过期报告（管理员）
+// 默认最新的报告在前,时间范围按执行时间筛选
+func GetExpiryReports(c *gin.Context) {
+	q, ok := parseListQuery(c)
+	if !ok {
+		return
+	}
+
+	var reports []models.ExpiryReport
+	utils.LoadFromFile(expiryReportsFile, &reports)
+
+	respondList(c, q, reports, expiryReportListSpec, func(r *models.ExpiryReport) bool {
+		return q.matchID(r.ID) && q.matchTime(r.RunAt)
+	})
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"ai-hacker/internal/audit"
+	"ai-hacker/internal/models"
+	"ai-hacker/internal/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// emailTemplateRequest 修改或预览模板的内容,为空的部分使用默认内容
+type emailTemplateRequest struct {
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Text    string `json:"text"`
+}
+
+// GetEmailTemplates 获取邮件模板列表（管理员）
+func GetEmailTemplates(c *gin.Context) {
+	templates := []utils.EmailTemplate{}
+	for _, name := range utils.EmailTemplateNames() {
+		tpl, _ := utils.GetEmailTemplate(name)
+		templates = append(templates, tpl)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"templates": templates})
+}
+
+// UpdateEmailTemplate 修改邮件模板（管理员）
+// 保存前使用示例数据渲染,模板有错误时不保存
+func UpdateEmailTemplate(c *gin.Context) {
+	name := c.Param("name")
+	before, ok := utils.GetEmailTemplate(name)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "邮件模板不存在"})
+		return
+	}
+
+	var req emailTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	tpl := mergeEmailTemplate(name, req)
+	if _, err := utils.RenderEmailTemplate(tpl, utils.SampleEmailData(name)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 与默认内容相同的部分不保存,默认模板更新后随之更新
+	defaults, _ := utils.DefaultEmailTemplate(name)
+	values := map[string]string{
+		"subject": customPart(tpl.Subject, defaults.Subject),
+		"html":    customPart(tpl.HTML, defaults.HTML),
+		"text":    customPart(tpl.Text, defaults.Text),
+	}
+	if err := saveEmailTemplate(name, values); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存模板失败"})
+		return
+	}
+
+	after, _ := utils.GetEmailTemplate(name)
+	audit.Set(c, "email_templates.update", "email-templates", name, emailTemplateSnapshot(before), emailTemplateSnapshot(after))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "邮件模板已保存",
+		"template": after,
+	})
+}
+
+// PreviewEmailTemplate 使用示例数据预览邮件模板（管理员）
+// 请求中的内容为空时使用当前保存的模板
+func PreviewEmailTemplate(c *gin.Context) {
+	name := c.Param("name")
+	tpl, ok := utils.GetEmailTemplate(name)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "邮件模板不存在"})
+		return
+	}
+
+	var req emailTemplateRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+			return
+		}
+	}
+	if req.Subject != "" {
+		tpl.Subject = req.Subject
+	}
+	if req.HTML != "" {
+		tpl.HTML = req.HTML
+	}
+	if req.Text != "" {
+		tpl.Text = req.Text
+	}
+
+	audit.Set(c, "email_templates.preview", "email-templates", name, nil, nil)
+
+	email, err := utils.RenderEmailTemplate(tpl, utils.SampleEmailData(name))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, email)
+}
+
+// ResetEmailTemplate 恢复默认邮件模板（管理员）
+func ResetEmailTemplate(c *gin.Context) {
+	name := c.Param("name")
+	before, ok := utils.GetEmailTemplate(name)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "邮件模板不存在"})
+		return
+	}
+
+	if err := saveEmailTemplate(name, map[string]string{"subject": "", "html": "", "text": ""}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存模板失败"})
+		return
+	}
+
+	after, _ := utils.GetEmailTemplate(name)
+	audit.Set(c, "email_templates.reset", "email-templates", name, emailTemplateSnapshot(before), emailTemplateSnapshot(after))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "已恢复默认模板",
+		"template": after,
+	})
+}
+
+// mergeEmailTemplate 用请求内容覆盖默认模板,为空的部分使用默认内容
+func mergeEmailTemplate(name string, req emailTemplateRequest) utils.EmailTemplate {
+	tpl, _ := utils.DefaultEmailTemplate(name)
+	if req.Subject != "" {
+		tpl.Subject = req.Subject
+	}
+	if req.HTML != "" {
+		tpl.HTML = req.HTML
+	}
+	if req.Text != "" {
+		tpl.Text = req.Text
+	}
+	return tpl
+}
+
+// customPart 与默认内容相同时返回空值
+func customPart(value, def string) string {
+	if value == def {
+		return ""
+	}
+	return value
+}
+
+// saveEmailTemplate 保存模板各部分到系统设置,空值表示使用默认内容
+func saveEmailTemplate(name string, values map[string]string) error {
+	var settings []models.Setting
+	utils.LoadFromFile(settingsFile, &settings)
+
+	for _, part := range []string{"subject", "html", "text"} {
+		updateSetting(&settings, utils.EmailTemplateSettingKey(name, part), values[part])
+	}
+	return utils.SaveToFile(settingsFile, settings)
+}
+
+// emailTemplateSnapshot 模板内容,用于记录审计日志
+func emailTemplateSnapshot(tpl utils.EmailTemplate) map[string]string {
+	return map[string]string{
+		"subject": tpl.Subject,
+		"html":    tpl.HTML,
+		"text":    tpl.Text,
+	}
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"ai-hacker/internal/utils"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// eventStreamHeartbeat 心跳间隔,防止代理断开空闲连接
+	eventStreamHeartbeat = 25 * time.Second
+	// eventStreamRetry 建议客户端断线后重连的间隔 (毫秒)
+	eventStreamRetry = 3000
+)
+
+// StreamAdminEvents 以 Server-Sent Events 推送订单、库存和邮件发送失败等实时事件（管理员）
+// 重连时通过 Last-Event-ID 请求头 (或 last_event_id 参数) 补发断线期间的事件,
+// 无法补发时先发送 resync 事件,客户端应重新加载列表
+func StreamAdminEvents(c *gin.Context) {
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+
+	replay, events, cancel := utils.SubscribeAdminEvents(lastEventID)
+	defer cancel()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // 关闭 Nginx 的响应缓冲
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	fmt.Fprintf(w, "retry: %d\n\n", eventStreamRetry)
+	for _, event := range replay {
+		writeAdminEvent(w, event)
+	}
+	w.Flush()
+
+	heartbeat := time.NewTicker(eventStreamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			writeAdminEvent(w, event)
+			w.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			w.Flush()
+		}
+	}
+}
+
+// writeAdminEvent 按 SSE 格式写入一个事件,data 为 JSON
+func writeAdminEvent(w io.Writer, event utils.AdminEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+}
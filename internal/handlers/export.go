@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"ai-hacker/internal/audit"
+	"ai-hacker/internal/export"
+	"ai-hacker/internal/models"
+	"ai-hacker/internal/utils"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 每导出多少行向客户端刷新一次
+const exportFlushRows = 500
+
+// 卡密导出的脱敏方式
+const (
+	ExportMaskPartial = "partial" // 只保留末尾几位
+	ExportMaskFull    = "full"    // 完全隐藏
+	ExportMaskNone    = "none"    // 明文,需要 cardkey:reveal 权限
+)
+
+// CardKeyExportHeader 卡密导出的表头
+var CardKeyExportHeader = []interface{}{"ID", "商品ID", "卡密", "状态", "订单号", "使用时间", "有效期至"}
+
+// CardKeyExportRow 按脱敏方式生成卡密导出的一行
+func CardKeyExportRow(ck *models.CardKey, mask string) []interface{} {
+	key := ck.Key
+	switch mask {
+	case ExportMaskPartial:
+		key = maskCardKey(*ck).Key
+	case ExportMaskFull:
+		key = "******"
+	}
+	return []interface{}{ck.ID, ck.ProductID, key, cardKeyStatusName(ck.Status), ck.OrderID, ck.UsedAt, ck.ExpiresAt}
+}
+
+// 卡密状态名称
+var cardKeyStatusNames = map[string]string{
+	"unused":    "未使用",
+	"used":      "已使用",
+	"expired":   "已过期",
+	"defective": "已失效",
+	"void":      "已作废",
+}
+
+// cardKeyStatusName 返回卡密状态名称,未知状态原样返回
+func cardKeyStatusName(status string) string {
+	if name, ok := cardKeyStatusNames[status]; ok {
+		return name
+	}
+	return status
+}
+
+// exportRun 一次导出的输出流和统计
+type exportRun struct {
+	c      *gin.Context
+	format string
+	w      export.Writer
+	rows   int
+}
+
+// startExport 校验导出格式并写出响应头
+// 返回 false 时已输出错误响应
+func startExport(c *gin.Context, name string) (*exportRun, bool) {
+	format := c.DefaultQuery("format", export.FormatCSV)
+	if !export.Supported(format) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format 只能是 csv 或 xlsx"})
+		return nil, false
+	}
+
+	filename := fmt.Sprintf("%s-%s.%s", name, time.Now().Format("20060102-150405"), format)
+	c.Header("Content-Type", export.ContentType(format))
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+
+	w, err := export.New(format, c.Writer)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return &exportRun{c: c, format: format, w: w}, true
+}
+
+// header 写入表头,不计入导出行数
+func (r *exportRun) header(cells ...interface{}) error {
+	return r.w.WriteRow(cells...)
+}
+
+// row 写入一行数据,定期刷新到客户端
+func (r *exportRun) row(cells ...interface{}) error {
+	if err := r.w.WriteRow(cells...); err != nil {
+		return err
+	}
+	r.rows++
+	if r.rows%exportFlushRows == 0 {
+		r.c.Writer.Flush()
+	}
+	return nil
+}
+
+// finish 结束导出并记录审计日志
+// 响应头已经发出,中途出错只能记录日志,客户端会收到不完整的文件
+func (r *exportRun) finish(action, entity string, err error) {
+	if err == nil {
+		err = r.w.Close()
+	}
+	if err != nil {
+		log.Printf("导出 %s 失败: %v", entity, err)
+	}
+
+	audit.Set(r.c, action, entity, "", nil, nil)
+	detail := fmt.Sprintf("格式 %s,导出 %d 条", r.format, r.rows)
+	if query := r.c.Request.URL.RawQuery; query != "" {
+		detail += ",条件 " + query
+	}
+	if err != nil {
+		detail += ",导出中断: " + err.Error()
+	}
+	audit.SetDetail(r.c, detail)
+}
+
+// ExportOrders 导出订单（管理员）
+// 参数 format 为 csv 或 xlsx,筛选条件与订单列表相同
+func ExportOrders(c *gin.Context) {
+	q, ok := parseListQuery(c)
+	if !ok {
+		return
+	}
+
+	run, ok := startExport(c, "orders")
+	if !ok {
+		return
+	}
+
+	err := run.header("订单号", "商品ID", "商品名称", "邮箱", "金额", "已退款", "状态", "支付方式", "创建时间")
+	if err == nil {
+		err = utils.StreamFromFile(ordersFile, func(order *models.Order) error {
+			if order.IsDeleted() || !q.matchID(order.ID) || !q.matchStatus(order.Status) || !q.matchEmail(order.Email) || !q.matchProduct(order.ProductID) || !q.matchTime(order.CreatedAt) {
+				return nil
+			}
+			return run.row(order.ID, order.ProductID, order.ProductName, order.Email, order.Amount, order.RefundedAmount, order.Status, order.PaymentMethod, order.CreatedAt)
+		})
+	}
+	run.finish("orders.export", "orders", err)
+}
+
+// ExportCardKeys 导出卡密（管理员）
+// 参数 mask 为 partial (默认) / full / none,明文导出需要 cardkey:reveal 权限和 reason 参数,
+// 导出的每个卡密都记录为一次查看并计入每日查看配额
+func ExportCardKeys(c *gin.Context) {
+	q, ok := parseListQuery(c)
+	if !ok {
+		return
+	}
+	match := func(ck *models.CardKey) bool {
+		return !ck.IsDeleted() && q.matchID(ck.ID) && q.matchStatus(ck.Status) && q.matchProduct(ck.ProductID) && q.matchTimeString(ck.UsedAt)
+	}
+
+	mask := c.DefaultQuery("mask", ExportMaskPartial)
+	switch mask {
+	case ExportMaskPartial, ExportMaskFull:
+	case ExportMaskNone:
+		if !utils.HasPermission(c.GetInt("role"), "cardkey:reveal") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "明文导出卡密需要查看卡密权限"})
+			return
+		}
+		reason := strings.TrimSpace(c.Query("reason"))
+		if reason == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "明文导出请填写查看原因"})
+			return
+		}
+		ids, err := RevealCardKeysForExport(c.GetString("email"), reason, q.ProductID, match)
+		if err != nil {
+			audit.Set(c, "cardkeys.export", "cardkeys", "", nil, nil)
+			audit.SetDetail(c, "明文导出超出每日查看配额被拒绝,原因: "+reason)
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		}
+		// 只导出已记录查看的卡密,两次读取之间新增的卡密不导出
+		match = func(ck *models.CardKey) bool { return ids[ck.ID] }
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mask 只能是 partial、full 或 none"})
+		return
+	}
+
+	run, ok := startExport(c, "cardkeys")
+	if !ok {
+		return
+	}
+
+	err := run.header(CardKeyExportHeader...)
+	if err == nil {
+		err = utils.StreamFromFile(cardKeysFile, func(ck *models.CardKey) error {
+			if !match(ck) {
+				return nil
+			}
+			return run.row(CardKeyExportRow(ck, mask)...)
+		})
+	}
+	run.finish("cardkeys.export", "cardkeys", err)
+}
+
+// RevealCardKeysForExport 明文导出前记录查看,返回本次允许导出的卡密 ID
+// 匹配的卡密全部计入操作人的每日查看配额,超出时整批拒绝并返回 *RevealQuotaError
+func RevealCardKeysForExport(operator, reason, productID string, match func(ck *models.CardKey) bool) (map[string]bool, error) {
+	ids := make(map[string]bool)
+	var list []string
+	err := utils.StreamFromFile(cardKeysFile, func(ck *models.CardKey) error {
+		if match(ck) {
+			ids[ck.ID] = true
+			list = append(list, ck.ID)
+		}
+		return nil
+	})
+	if err != nil || len(list) == 0 {
+		return ids, err
+	}
+
+	_, err = RecordKeyReveal(models.KeyReveal{
+		ProductID:  productID,
+		Operator:   operator,
+		Reason:     "明文导出: " + reason,
+		CardKeyIDs: list,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// ExportUsers 导出用户（需要 user:manage 权限）,不包含密码
+func ExportUsers(c *gin.Context) {
+	q, ok := parseListQuery(c)
+	if !ok {
+		return
+	}
+	role := c.Query("role")
+
+	roleNames := make(map[int]string)
+	var roles []models.Role
+	utils.LoadFromFile(rolesFile, &roles)
+	for _, r := range roles {
+		roleNames[r.ID] = r.Name
+	}
+
+	run, ok := startExport(c, "users")
+	if !ok {
+		return
+	}
+
+	err := run.header("ID", "邮箱", "角色", "注册时间")
+	if err == nil {
+		err = utils.StreamFromFile(usersFile, func(user *models.User) error {
+			if user.IsDeleted() || !q.matchID(user.ID) || !q.matchEmail(user.Email) || !q.matchTime(user.CreatedAt) || (role != "" && strconv.Itoa(user.Role) != role) {
+				return nil
+			}
+			name := roleNames[user.Role]
+			if name == "" {
+				name = strconv.Itoa(user.Role)
+			}
+			return run.row(user.ID, user.Email, name, user.CreatedAt)
+		})
+	}
+	run.finish("users.export", "users", err)
+}
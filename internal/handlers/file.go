@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"ai-hacker/internal/audit"
+	"ai-hacker/internal/models"
+	"ai-hacker/internal/utils"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	filesFile = "data/files.json"
+	filesDir  = "data/files"
+)
+
+// UploadCardKeyFiles 上传文件类卡密（管理员）
+// 每个上传的文件生成一个卡密,文件私有存储,仅能通过订单签名链接下载
+func UploadCardKeyFiles(c *gin.Context) {
+	productID := c.PostForm("product_id")
+	if findProduct(productID) == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "商品不存在"})
+		return
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["file"]) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请选择要上传的文件"})
+		return
+	}
+
+	if err := os.MkdirAll(filesDir, 0700); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建文件目录失败"})
+		return
+	}
+
+	stockBefore := GetProductStock(productID)
+
+	var files []models.DeliveryFile
+	utils.LoadFromFile(filesFile, &files)
+
+	var cardKeys []models.CardKey
+	utils.LoadFromFile(cardKeysFile, &cardKeys)
+
+	var created []models.CardKey
+	baseID := utils.GenerateID()
+	for i, header := range form.File["file"] {
+		file := models.DeliveryFile{
+			ID:          fmt.Sprintf("F%s_%d", baseID, i),
+			Name:        filepath.Base(header.Filename),
+			Size:        header.Size,
+			ContentType: header.Header.Get("Content-Type"),
+			CreatedAt:   time.Now(),
+		}
+
+		endWrite := utils.BeginDataWrite()
+		err := c.SaveUploadedFile(header, filepath.Join(filesDir, file.ID))
+		endWrite()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存文件失败: " + header.Filename})
+			return
+		}
+		files = append(files, file)
+
+		created = append(created, models.CardKey{
+			ID:        fmt.Sprintf("CK%s_%d", baseID, i),
+			ProductID: productID,
+			Key:       file.Name,
+			FileID:    file.ID,
+			Status:    "unused",
+		})
+	}
+
+	utils.SaveToFile(filesFile, files)
+	cardKeys = append(cardKeys, created...)
+	utils.SaveToFile(cardKeysFile, cardKeys)
+	checkRestock(productID, stockBefore)
+	publishCardKeysImported(productID, len(created), "upload")
+	audit.Set(c, "cardkeys.upload", "cardkeys", "", nil, nil)
+	audit.SetDetail(c, fmt.Sprintf("商品 %s 上传 %d 个文件", productID, len(created)))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  fmt.Sprintf("成功上传 %d 个文件", len(created)),
+		"cardkeys": created,
+	})
+}
+
+// DownloadOrderFile 通过签名链接下载订单文件
+func DownloadOrderFile(c *gin.Context) {
+	orderID := c.Param("id")
+
+	if !utils.VerifyDownload(orderID, c.Query("expires"), c.Query("sig")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "下载链接无效或已过期"})
+		return
+	}
+
+	var orders []models.Order
+	utils.LoadFromFile(ordersFile, &orders)
+
+	var order *models.Order
+	for i := range orders {
+		if orders[i].ID == orderID && !orders[i].IsDeleted() {
+			order = &orders[i]
+			break
+		}
+	}
+
+	if order == nil || order.FileID == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+		return
+	}
+
+	// 检查下载次数限制,商品已移入回收站时同样适用
+	if product := findProductIncludingDeleted(order.ProductID); product != nil && product.MaxDownloads > 0 {
+		if order.DownloadCount >= product.MaxDownloads {
+			c.JSON(http.StatusForbidden, gin.H{"error": "已达到最大下载次数"})
+			return
+		}
+	}
+
+	file := findDeliveryFile(order.FileID)
+	if file == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+		return
+	}
+
+	order.DownloadCount++
+	utils.SaveToFile(ordersFile, orders)
+
+	c.FileAttachment(filepath.Join(filesDir, file.ID), file.Name)
+}
+
+// findDeliveryFile 按 ID 查找文件信息
+func findDeliveryFile(fileID string) *models.DeliveryFile {
+	var files []models.DeliveryFile
+	utils.LoadFromFile(filesFile, &files)
+
+	for i := range files {
+		if files[i].ID == fileID {
+			return &files[i]
+		}
+	}
+	return nil
+}
+
+// deleteDeliveryFile 删除文件及其信息
+func deleteDeliveryFile(fileID string) {
+	var files []models.DeliveryFile
+	utils.LoadFromFile(filesFile, &files)
+
+	newFiles := []models.DeliveryFile{}
+	for _, f := range files {
+		if f.ID == fileID {
+			continue
+		}
+		newFiles = append(newFiles, f)
+	}
+	utils.SaveToFile(filesFile, newFiles)
+
+	defer utils.BeginDataWrite()()
+	os.Remove(filepath.Join(filesDir, fileID))
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"ai-hacker/internal/models"
+	"ai-hacker/internal/utils"
+	"fmt"
+	"time"
+)
+
+// 删除策略
+const (
+	DeletePolicyRestrict = "restrict" // 存在关联数据时拒绝删除
+	DeletePolicyCascade  = "cascade"  // 关联数据随之处理
+)
+
+// 完整性检查修复时使用的操作人
+const integrityOperator = "system:check"
+
+// GetDeletePolicy 获取删除策略,默认级联
+func GetDeletePolicy() string {
+	var settings []models.Setting
+	utils.LoadFromFile(settingsFile, &settings)
+
+	for _, s := range settings {
+		if s.Key == "delete_policy" && s.Value == DeletePolicyRestrict {
+			return DeletePolicyRestrict
+		}
+	}
+
+	return DeletePolicyCascade
+}
+
+// IntegrityIssue 数据完整性问题
+type IntegrityIssue struct {
+	Kind     string `json:"kind"`
+	ID       string `json:"id"`
+	Message  string `json:"message"`
+	Repaired bool   `json:"repaired"`
+}
+
+// CheckIntegrity 扫描数据目录中的孤立记录和无效引用
+// repair 为 true 时修复可以安全修复的问题,其余只报告
+func CheckIntegrity(repair bool) []IntegrityIssue {
+	var products []models.Product
+	var orders []models.Order
+	var users []models.User
+	var cardKeys []models.CardKey
+	var files []models.DeliveryFile
+	var subscriptions []models.StockSubscription
+	utils.LoadFromFile(productsFile, &products)
+	utils.LoadFromFile(ordersFile, &orders)
+	utils.LoadFromFile(usersFile, &users)
+	utils.LoadFromFile(cardKeysFile, &cardKeys)
+	utils.LoadFromFile(filesFile, &files)
+	utils.LoadFromFile(stockSubscriptionsFile, &subscriptions)
+
+	productMap := make(map[string]*models.Product)
+	productByName := make(map[string]*models.Product)
+	for i := range products {
+		productMap[products[i].ID] = &products[i]
+		if !products[i].IsDeleted() {
+			productByName[products[i].Name] = &products[i]
+		}
+	}
+	orderMap := make(map[string]bool)
+	fileRefs := make(map[string]bool)
+	for _, o := range orders {
+		orderMap[o.ID] = true
+		if o.FileID != "" {
+			fileRefs[o.FileID] = true
+		}
+	}
+	cardKeyMap := make(map[string]bool)
+	for _, ck := range cardKeys {
+		cardKeyMap[ck.ID] = true
+		if ck.FileID != "" {
+			fileRefs[ck.FileID] = true
+		}
+	}
+	fileMap := make(map[string]bool)
+	for _, f := range files {
+		fileMap[f.ID] = true
+	}
+
+	issues := []IntegrityIssue{}
+	now := time.Now()
+
+	// 卡密
+	cardKeysChanged := false
+	for i := range cardKeys {
+		ck := &cardKeys[i]
+		product := productMap[ck.ProductID]
+
+		if product == nil && !ck.IsDeleted() {
+			issue := IntegrityIssue{Kind: "cardkey_product", ID: ck.ID, Message: "卡密所属商品不存在: " + ck.ProductID}
+			if repair {
+				ck.MarkDeleted(integrityOperator, now)
+				issue.Repaired = true
+				cardKeysChanged = true
+			}
+			issues = append(issues, issue)
+		} else if product != nil && product.IsDeleted() && ck.Status == "unused" && !ck.IsDeleted() {
+			// 与商品使用相同的删除时间,恢复商品时一并恢复
+			issue := IntegrityIssue{Kind: "cardkey_product", ID: ck.ID, Message: "卡密所属商品已删除: " + ck.ProductID}
+			if repair {
+				ck.MarkDeleted(integrityOperator, *product.DeletedAt)
+				issue.Repaired = true
+				cardKeysChanged = true
+			}
+			issues = append(issues, issue)
+		}
+
+		if ck.Status == "used" && ck.OrderID != "" && !orderMap[ck.OrderID] {
+			issues = append(issues, IntegrityIssue{Kind: "cardkey_order", ID: ck.ID, Message: "卡密关联的订单不存在: " + ck.OrderID})
+		}
+
+		if ck.FileID != "" && !fileMap[ck.FileID] {
+			issue := IntegrityIssue{Kind: "cardkey_file", ID: ck.ID, Message: "卡密关联的文件不存在: " + ck.FileID}
+			if repair && ck.Status == "unused" {
+				// 文件丢失的卡密无法发货,作废处理
+				ck.Status = "void"
+				issue.Repaired = true
+				cardKeysChanged = true
+			}
+			issues = append(issues, issue)
+		}
+	}
+	if cardKeysChanged {
+		utils.SaveToFile(cardKeysFile, cardKeys)
+	}
+
+	// 订单
+	ordersChanged := false
+	for i := range orders {
+		o := &orders[i]
+		if productMap[o.ProductID] == nil {
+			issue := IntegrityIssue{Kind: "order_product", ID: o.ID, Message: fmt.Sprintf("订单关联的商品不存在: %q", o.ProductID)}
+			// 早期订单只记录了商品名称,按名称补全商品 ID
+			if p := productByName[o.ProductName]; repair && p != nil {
+				o.ProductID = p.ID
+				issue.Repaired = true
+				ordersChanged = true
+			}
+			issues = append(issues, issue)
+		}
+
+		if o.CardKeyID != "" && !cardKeyMap[o.CardKeyID] {
+			issues = append(issues, IntegrityIssue{Kind: "order_cardkey", ID: o.ID, Message: "订单关联的卡密不存在: " + o.CardKeyID})
+		}
+	}
+	if ordersChanged {
+		utils.SaveToFile(ordersFile, orders)
+	}
+
+	// 用户
+	usersChanged := false
+	for i := range users {
+		u := &users[i]
+		if !utils.RoleExists(u.Role) {
+			issue := IntegrityIssue{Kind: "user_role", ID: u.ID, Message: fmt.Sprintf("用户角色不存在: %d", u.Role)}
+			if repair {
+				u.Role = 1
+				issue.Repaired = true
+				usersChanged = true
+			}
+			issues = append(issues, issue)
+		}
+	}
+	if usersChanged {
+		utils.SaveToFile(usersFile, users)
+	}
+
+	// 到货通知订阅
+	keptSubscriptions := []models.StockSubscription{}
+	for _, s := range subscriptions {
+		if productMap[s.ProductID] == nil {
+			issues = append(issues, IntegrityIssue{Kind: "subscription_product", ID: s.ID, Message: "订阅的商品不存在: " + s.ProductID, Repaired: repair})
+			if repair {
+				continue
+			}
+		}
+		keptSubscriptions = append(keptSubscriptions, s)
+	}
+	if repair && len(keptSubscriptions) != len(subscriptions) {
+		utils.SaveToFile(stockSubscriptionsFile, keptSubscriptions)
+	}
+
+	// 未被任何卡密或订单引用的文件
+	for _, f := range files {
+		if !fileRefs[f.ID] {
+			issues = append(issues, IntegrityIssue{Kind: "file_orphan", ID: f.ID, Message: "文件未被任何卡密或订单引用: " + f.Name, Repaired: repair})
+			if repair {
+				deleteDeliveryFile(f.ID)
+			}
+		}
+	}
+
+	return issues
+}
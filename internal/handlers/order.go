@@ -4,6 +4,7 @@ import (
 	"ai-hacker/internal/models"
 	"ai-hacker/internal/utils"
 	"fmt"
+	"log"
 	"net/http"
 	"time"
 
@@ -25,19 +26,26 @@ func GetOrders(c *gin.Context) {
 	// 如果提供了订单号和邮箱，精确匹配
 	if orderID != "" && email != "" {
 		for _, order := range orders {
-			if order.Email == email && order.ID == orderID {
+			if order.Email == email && order.ID == orderID && !order.IsDeleted() {
 				filteredOrders = append(filteredOrders, order)
 			}
 		}
 	} else if email != "" {
 		// 如果只提供了邮箱，返回该邮箱的所有订单
 		for _, order := range orders {
-			if order.Email == email {
+			if order.Email == email && !order.IsDeleted() {
 				filteredOrders = append(filteredOrders, order)
 			}
 		}
 	}
 
+	// 文件类订单生成新的限时下载链接
+	for i := range filteredOrders {
+		if filteredOrders[i].FileID != "" {
+			filteredOrders[i].DownloadURL = utils.DownloadURL(filteredOrders[i].ID)
+		}
+	}
+
 	c.JSON(http.StatusOK, filteredOrders)
 }
 
@@ -59,7 +67,7 @@ func CreateOrder(c *gin.Context) {
 
 	var product *models.Product
 	for i := range products {
-		if products[i].ID == req.ProductID {
+		if products[i].ID == req.ProductID && !products[i].IsDeleted() {
 			product = &products[i]
 			break
 		}
@@ -114,25 +122,34 @@ func CreateOrder(c *gin.Context) {
 	// 创建订单
 	newOrder := models.Order{
 		ID:          orderID,
+		ProductID:   product.ID,
 		ProductName: product.Name,
 		Email:       req.Email,
 		Amount:      product.Price,
-		Status:      "已完成",
-		CardKey:     cardKey.Key,
+		Status:      models.OrderStatusCompleted,
 		CreatedAt:   time.Now(),
 	}
+	applyCardKey(&newOrder, product, cardKey)
 
 	// 保存订单
 	orders = append(orders, newOrder)
 	utils.SaveToFile(ordersFile, orders)
 
-	// 发送邮件通知（异步）
-	go func() {
-		if err := utils.SendOrderEmail(req.Email, orderID, product.Name, cardKey.Key, product.Price); err != nil {
-			// 记录错误但不影响订单创建
-			fmt.Printf("发送邮件失败: %v\n", err)
-		}
-	}()
+	// 检查库存告警
+	checkLowStock(product, stock)
+
+	// 订单创建时即完成支付和发货
+	utils.PublishWebhookEvent(models.WebhookEventOrderCreated, orderWebhookData(newOrder))
+	utils.PublishWebhookEvent(models.WebhookEventOrderPaid, orderWebhookData(newOrder))
+	utils.PublishAdminEvent(utils.AdminEventOrderCreated, orderWebhookData(newOrder))
+	utils.PublishAdminEvent(utils.AdminEventOrderPaid, orderWebhookData(newOrder))
+	notifyOrderPaid(newOrder)
+
+	// 发货邮件加入发送队列,由后台任务发送和重试
+	if _, err := utils.QueueOrderEmail(newOrder); err != nil {
+		// 记录错误但不影响订单创建
+		log.Printf("订单 %s 的邮件加入发送队列失败: %v", orderID, err)
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":  "购买成功",
@@ -140,3 +157,31 @@ func CreateOrder(c *gin.Context) {
 		"order":    newOrder,
 	})
 }
+
+// notifyOrderPaid 向管理员发送新订单通知,不包含卡密
+func notifyOrderPaid(order models.Order) {
+	message := fmt.Sprintf("订单 %s\n商品: %s\n金额: %.2f\n邮箱: %s",
+		order.ID, order.ProductName, order.Amount, order.Email)
+	if order.PaymentMethod != "" {
+		message += "\n支付方式: " + order.PaymentMethod
+	}
+	payload := map[string]interface{}(orderWebhookData(order))
+	utils.Go(func() {
+		utils.NotifyAdmins("order.paid", "新订单: "+order.ProductName, message, payload)
+	})
+}
+
+// applyCardKey 将卡密发放到订单,并按商品配置整理结构化字段和发货说明
+func applyCardKey(order *models.Order, product *models.Product, cardKey *models.CardKey) {
+	order.CardKey = cardKey.Key
+	order.CardKeyID = cardKey.ID
+	order.CardKeyFields = utils.CardKeyFieldValues(product.KeyFields, cardKey.Fields)
+	order.FileID = cardKey.FileID
+	order.DownloadCount = 0
+	order.Instructions = utils.RenderDeliveryTemplate(product.DeliveryTemplate, utils.DeliveryVars{
+		OrderID:     order.ID,
+		CardKey:     cardKey.Key,
+		ProductName: product.Name,
+		Date:        order.CreatedAt,
+	})
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"ai-hacker/internal/audit"
+	"ai-hacker/internal/models"
+	"ai-hacker/internal/utils"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 邮件队列列表排序字段
+var outboxListSpec = listSpec[models.OutboxMessage]{
+	sorts: map[string]func(a, b *models.OutboxMessage) int{
+		"created_at":      func(a, b *models.OutboxMessage) int { return compareTimes(a.CreatedAt, b.CreatedAt) },
+		"next_attempt_at": func(a, b *models.OutboxMessage) int { return compareTimes(a.NextAttemptAt, b.NextAttemptAt) },
+		"attempts":        func(a, b *models.OutboxMessage) int { return a.Attempts - b.Attempts },
+	},
+	defaultSort: "created_at",
+	defaultDesc: true,
+	id:          func(m *models.OutboxMessage) string { return m.ID },
+}
+
+// GetOutbox 查询邮件发送队列（管理员）
+// 支持按状态、收件人 (email)、订单 (order_id)、类型 (type) 和创建时间筛选
+// 邮件正文可能包含卡密,不在列表中返回
+func GetOutbox(c *gin.Context) {
+	q, ok := parseListQuery(c)
+	if !ok {
+		return
+	}
+
+	messages, err := utils.ListOutbox()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取邮件队列失败: " + err.Error()})
+		return
+	}
+	for i := range messages {
+		messages[i].Body = ""
+		messages[i].Text = ""
+	}
+
+	orderID := c.Query("order_id")
+	msgType := c.Query("type")
+	respondList(c, q, messages, outboxListSpec, func(m *models.OutboxMessage) bool {
+		return q.matchID(m.ID) &&
+			q.matchStatus(m.Status) &&
+			q.matchEmail(m.To) &&
+			(orderID == "" || m.OrderID == orderID) &&
+			(msgType == "" || m.Type == msgType) &&
+			q.matchTime(m.CreatedAt)
+	})
+}
+
+// RetryOutboxMessage 立即重试等待重试或已停止重试的邮件（管理员）
+// 发货邮件按订单当前的卡密重新生成,文件类卡密的下载链接重新计算有效期
+func RetryOutboxMessage(c *gin.Context) {
+	msg, err := utils.RetryOutbox(c.Param("id"), renderOutboxOrderEmail)
+	if errors.Is(err, utils.ErrOutboxNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	audit.Set(c, "outbox.retry", "outbox", msg.ID, nil, nil)
+
+	msg.Body = ""
+	msg.Text = ""
+	c.JSON(http.StatusOK, gin.H{
+		"message": "已重新加入发送队列",
+		"email":   msg,
+	})
+}
+
+// renderOutboxOrderEmail 重试发货邮件时按订单重新生成邮件内容,其他邮件保持不变
+func renderOutboxOrderEmail(m *models.OutboxMessage) error {
+	if m.Type != models.OutboxTypeOrder {
+		return nil
+	}
+
+	var orders []models.Order
+	utils.LoadFromFile(ordersFile, &orders)
+
+	for i := range orders {
+		if orders[i].ID != m.OrderID || orders[i].IsDeleted() {
+			continue
+		}
+		if orders[i].Status != models.OrderStatusCompleted && orders[i].Status != models.OrderStatusPartialRefunded {
+			return errors.New("订单状态为" + orders[i].Status + "，不能重发邮件")
+		}
+		fresh, err := utils.OrderEmailMessage(orders[i])
+		if err != nil {
+			return errors.New("生成邮件失败: " + err.Error())
+		}
+		m.To = fresh.To
+		m.Subject = fresh.Subject
+		m.Body = fresh.Body
+		m.Text = fresh.Text
+		return nil
+	}
+	return errors.New("订单不存在")
+}
+
+// ResendOrderEmail 重新发送订单发货邮件（管理员）
+// 按订单当前的卡密重新生成邮件加入发送队列
+func ResendOrderEmail(c *gin.Context) {
+	var orders []models.Order
+	utils.LoadFromFile(ordersFile, &orders)
+
+	var order *models.Order
+	for i := range orders {
+		if orders[i].ID == c.Param("id") && !orders[i].IsDeleted() {
+			order = &orders[i]
+			break
+		}
+	}
+	if order == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
+		return
+	}
+	if order.Status != models.OrderStatusCompleted && order.Status != models.OrderStatusPartialRefunded {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "订单状态为" + order.Status + "，不能重发邮件"})
+		return
+	}
+
+	msg, err := utils.QueueOrderEmail(*order)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "加入发送队列失败: " + err.Error()})
+		return
+	}
+	audit.Set(c, "orders.resend_email", "orders", order.ID, nil, nil)
+
+	msg.Body = ""
+	msg.Text = ""
+	c.JSON(http.StatusOK, gin.H{
+		"message": "邮件已加入发送队列",
+		"email":   msg,
+	})
+}
+
+// 邮件发送日志排序字段
+var emailLogListSpec = listSpec[models.EmailLog]{
+	sorts: map[string]func(a, b *models.EmailLog) int{
+		"created_at": func(a, b *models.EmailLog) int { return compareTimes(a.CreatedAt, b.CreatedAt) },
+		"updated_at": func(a, b *models.EmailLog) int { return compareTimes(a.UpdatedAt, b.UpdatedAt) },
+		"to":         func(a, b *models.EmailLog) int { return compareStrings(a.To, b.To) },
+	},
+	defaultSort: "created_at",
+	defaultDesc: true,
+	id:          func(l *models.EmailLog) string { return l.ID },
+}
+
+// GetEmailLogs 查询邮件发送日志（管理员）
+// 支持按状态、收件人 (email)、订单 (order_id)、用户 (user_id)、类型 (type) 和创建时间筛选
+func GetEmailLogs(c *gin.Context) {
+	q, ok := parseListQuery(c)
+	if !ok {
+		return
+	}
+
+	logs, err := utils.ListEmailLogs()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取邮件发送日志失败: " + err.Error()})
+		return
+	}
+
+	orderID := c.Query("order_id")
+	userID := c.Query("user_id")
+	logType := c.Query("type")
+	respondList(c, q, logs, emailLogListSpec, func(l *models.EmailLog) bool {
+		return q.matchID(l.ID) &&
+			q.matchStatus(l.Status) &&
+			q.matchEmail(l.To) &&
+			(orderID == "" || l.OrderID == orderID) &&
+			(userID == "" || l.UserID == userID) &&
+			(logType == "" || l.Type == logType) &&
+			q.matchTime(l.CreatedAt)
+	})
+}
@@ -1,9 +1,14 @@
 package handlers
 
 import (
+	"ai-hacker/internal/audit"
 	"ai-hacker/internal/models"
 	"ai-hacker/internal/utils"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -15,12 +20,17 @@ func GetProducts(c *gin.Context) {
 	var products []models.Product
 	utils.LoadFromFile(productsFile, &products)
 	
-	// 动态计算库存
+	// 动态计算库存,不返回回收站中的商品
+	result := []models.Product{}
 	for i := range products {
+		if products[i].IsDeleted() {
+			continue
+		}
 		products[i].Stock = GetProductStock(products[i].ID)
+		result = append(result, products[i])
 	}
 	
-	c.JSON(http.StatusOK, products)
+	c.JSON(http.StatusOK, result)
 }
 
 // CreateProduct 创建商品（管理员）
@@ -30,6 +40,13 @@ func CreateProduct(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// 新建的商品不能直接位于回收站
+	newProduct.SoftDelete = models.SoftDelete{}
+
+	if msg := validateKeyFields(newProduct.KeyFields); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
 
 	var products []models.Product
 	utils.LoadFromFile(productsFile, &products)
@@ -44,6 +61,7 @@ func CreateProduct(c *gin.Context) {
 
 	products = append(products, newProduct)
 	utils.SaveToFile(productsFile, products)
+	audit.Set(c, "products.create", "products", newProduct.ID, nil, newProduct)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "商品创建成功",
@@ -61,14 +79,21 @@ func UpdateProduct(c *gin.Context) {
 		return
 	}
 
+	if msg := validateKeyFields(updateData.KeyFields); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
 	var products []models.Product
 	utils.LoadFromFile(productsFile, &products)
 
 	found := false
 	for i := range products {
-		if products[i].ID == productID {
+		if products[i].ID == productID && !products[i].IsDeleted() {
 			// 保持 ID 不变
 			updateData.ID = productID
+			updateData.SoftDelete = models.SoftDelete{}
+			audit.Set(c, "products.update", "products", productID, products[i], updateData)
 			products[i] = updateData
 			found = true
 			break
@@ -95,14 +120,27 @@ func DeleteProduct(c *gin.Context) {
 	var products []models.Product
 	utils.LoadFromFile(productsFile, &products)
 
+	// 限制策略下,存在未售出卡密的商品不允许删除
+	if GetDeletePolicy() == DeletePolicyRestrict {
+		if stock := countUnsoldCardKeys(productID); stock > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("该商品下还有 %d 个未售出的卡密,无法删除", stock)})
+			return
+		}
+	}
+
+	now := time.Now()
+	operator := c.GetString("email")
+
 	found := false
-	newProducts := []models.Product{}
-	for _, product := range products {
-		if product.ID == productID {
+	for i := range products {
+		if products[i].ID == productID && !products[i].IsDeleted() {
+			// 移入回收站
+			before := products[i]
+			products[i].MarkDeleted(operator, now)
+			audit.Set(c, "products.delete", "products", productID, before, products[i])
 			found = true
-			continue
+			break
 		}
-		newProducts = append(newProducts, product)
 	}
 
 	if !found {
@@ -110,7 +148,113 @@ func DeleteProduct(c *gin.Context) {
 		return
 	}
 
-	utils.SaveToFile(productsFile, newProducts)
+	utils.SaveToFile(productsFile, products)
+
+	// 未售出的卡密随商品一起移入回收站,恢复商品时一并恢复
+	var cardKeys []models.CardKey
+	utils.LoadFromFile(cardKeysFile, &cardKeys)
+	cascaded := 0
+	for i := range cardKeys {
+		if cardKeys[i].ProductID == productID && cardKeys[i].Status == "unused" && !cardKeys[i].IsDeleted() {
+			cardKeys[i].MarkDeleted(operator, now)
+			cascaded++
+		}
+	}
+	utils.SaveToFile(cardKeysFile, cardKeys)
+	audit.SetDetail(c, fmt.Sprintf("未售出卡密 %d 个一并移入回收站", cascaded))
 
 	c.JSON(http.StatusOK, gin.H{"message": "商品删除成功"})
 }
+
+// PreviewDeliveryTemplate 预览发货说明模板（管理员）
+// 未提供 template 时使用商品当前保存的模板
+func PreviewDeliveryTemplate(c *gin.Context) {
+	productID := c.Param("id")
+
+	var req struct {
+		Template string `json:"template"`
+	}
+	// 请求体可以为空
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	product := findProduct(productID)
+	if product == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "商品不存在"})
+		return
+	}
+
+	tpl := req.Template
+	if tpl == "" {
+		tpl = product.DeliveryTemplate
+	}
+
+	// 使用示例数据渲染
+	rendered := utils.RenderDeliveryTemplate(tpl, utils.DeliveryVars{
+		OrderID:     "ORD1700000000000000000",
+		CardKey:     "XXXX-XXXX-XXXX-XXXX",
+		ProductName: product.Name,
+		Date:        time.Now(),
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"text":         rendered,
+		"html":         utils.DeliveryInstructionsHTML(rendered),
+		"placeholders": utils.DeliveryPlaceholders,
+	})
+}
+
+// findProduct 按 ID 查找商品
+func findProduct(productID string) *models.Product {
+	var products []models.Product
+	utils.LoadFromFile(productsFile, &products)
+
+	for i := range products {
+		if products[i].ID == productID && !products[i].IsDeleted() {
+			return &products[i]
+		}
+	}
+	return nil
+}
+
+// findProductIncludingDeleted 按 ID 查找商品,包括回收站中的商品
+// 用于已售出订单的限制,商品删除后仍然有效
+func findProductIncludingDeleted(productID string) *models.Product {
+	if product := findProduct(productID); product != nil {
+		return product
+	}
+
+	var products []models.Product
+	utils.LoadFromFile(productsFile, &products)
+
+	for i := range products {
+		if products[i].ID == productID {
+			return &products[i]
+		}
+	}
+	return nil
+}
+
+// validateKeyFields 校验卡密字段定义,返回错误信息
+func validateKeyFields(fields []models.KeyField) string {
+	seen := make(map[string]bool)
+	for _, f := range fields {
+		if f.Name == "" {
+			return "卡密字段标识不能为空"
+		}
+		// key、expires_at 及其中文表头保留给导入时的单行卡密列和有效期列
+		if builtinImportColumn(f.Name) != "" {
+			return "卡密字段标识不能为 " + f.Name + "，该名称保留给导入的卡密或有效期列"
+		}
+		if f.Label != "" && builtinImportColumn(f.Label) != "" {
+			return "卡密字段名称不能为 " + f.Label + "，该名称保留给导入的卡密或有效期列"
+		}
+		if seen[f.Name] {
+			return "卡密字段标识重复: " + f.Name
+		}
+		seen[f.Name] = true
+	}
+	return ""
+}
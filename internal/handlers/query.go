@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"ai-hacker/internal/utils"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 列表分页的默认和最大条数
+const (
+	defaultPageSize = 20
+	maxPageSize     = 200
+)
+
+// listQuery 管理后台列表的分页、排序和筛选参数
+//
+//	page, page_size  页码分页,page 从 1 开始
+//	cursor           游标分页,取上一页响应中的 next_cursor,优先于 page
+//	sort, order      排序字段和方向 (asc / desc)
+//	id, status, email, product_id, from, to  筛选条件,email 为不区分大小写的子串匹配
+type listQuery struct {
+	Page      int
+	PageSize  int
+	Cursor    string
+	Sort      string
+	Order     string
+	ID        string
+	Status    string
+	Email     string
+	ProductID string
+	From      time.Time
+	To        time.Time
+}
+
+// listPage 列表响应
+type listPage[T any] struct {
+	Items      []T    `json:"items"`
+	Total      int    `json:"total"`
+	Page       int    `json:"page"`
+	PageSize   int    `json:"page_size"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// listSpec 列表支持的排序字段和记录 ID
+type listSpec[T any] struct {
+	sorts       map[string]func(a, b *T) int
+	defaultSort string
+	defaultDesc bool
+	id          func(*T) string
+}
+
+// parseListQuery 解析列表参数,出错时直接返回 400
+func parseListQuery(c *gin.Context) (listQuery, bool) {
+	q := listQuery{
+		Page:      1,
+		PageSize:  defaultPageSize,
+		Cursor:    c.Query("cursor"),
+		Sort:      c.Query("sort"),
+		Order:     strings.ToLower(c.Query("order")),
+		ID:        c.Query("id"),
+		Status:    c.Query("status"),
+		Email:     strings.ToLower(strings.TrimSpace(c.Query("email"))),
+		ProductID: c.Query("product_id"),
+	}
+
+	fail := func(msg string) (listQuery, bool) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return q, false
+	}
+
+	if v := c.Query("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return fail("page 参数错误")
+		}
+		q.Page = n
+	}
+	if v := c.Query("page_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return fail("page_size 参数错误")
+		}
+		if n > maxPageSize {
+			n = maxPageSize
+		}
+		q.PageSize = n
+	}
+	if q.Order != "" && q.Order != "asc" && q.Order != "desc" {
+		return fail("order 只能是 asc 或 desc")
+	}
+	if v := c.Query("from"); v != "" {
+		t, err := utils.ParseTime(v)
+		if err != nil {
+			return fail("开始时间格式错误")
+		}
+		// 仅日期时从当天开始
+		if len(v) == len("2006-01-02") {
+			t = t.Add(-24*time.Hour + time.Second)
+		}
+		q.From = t
+	}
+	if v := c.Query("to"); v != "" {
+		t, err := utils.ParseTime(v)
+		if err != nil {
+			return fail("结束时间格式错误")
+		}
+		q.To = t
+	}
+
+	return q, true
+}
+
+// matchID 按 ID 精确筛选
+func (q listQuery) matchID(id string) bool {
+	return q.ID == "" || id == q.ID
+}
+
+// matchStatus 按状态筛选
+func (q listQuery) matchStatus(status string) bool {
+	return q.Status == "" || status == q.Status
+}
+
+// matchEmail 按邮箱子串筛选
+func (q listQuery) matchEmail(email string) bool {
+	return q.Email == "" || strings.Contains(strings.ToLower(email), q.Email)
+}
+
+// matchProduct 按商品筛选
+func (q listQuery) matchProduct(productID string) bool {
+	return q.ProductID == "" || productID == q.ProductID
+}
+
+// matchTime 按时间范围筛选,设置了范围时零值时间不匹配
+func (q listQuery) matchTime(t time.Time) bool {
+	if q.From.IsZero() && q.To.IsZero() {
+		return true
+	}
+	if t.IsZero() {
+		return false
+	}
+	return (q.From.IsZero() || !t.Before(q.From)) && (q.To.IsZero() || !t.After(q.To))
+}
+
+// matchTimeString 按时间范围筛选字符串时间
+func (q listQuery) matchTimeString(value string) bool {
+	if q.From.IsZero() && q.To.IsZero() {
+		return true
+	}
+	t, err := utils.ParseTime(value)
+	if err != nil {
+		return false
+	}
+	return q.matchTime(t)
+}
+
+// paginate 按参数筛选、排序并分页
+func paginate[T any](items []T, q listQuery, spec listSpec[T], match func(*T) bool) (listPage[T], error) {
+	filtered := []T{}
+	for i := range items {
+		if match == nil || match(&items[i]) {
+			filtered = append(filtered, items[i])
+		}
+	}
+
+	// 排序,未指定方向时使用字段的默认方向
+	key := q.Sort
+	desc := q.Order == "desc"
+	if key == "" {
+		key = spec.defaultSort
+		if q.Order == "" {
+			desc = spec.defaultDesc
+		}
+	}
+	if key != "" {
+		cmp, ok := spec.sorts[key]
+		if !ok {
+			return listPage[T]{}, errors.New("不支持的排序字段: " + key)
+		}
+		sort.SliceStable(filtered, func(i, j int) bool {
+			if desc {
+				return cmp(&filtered[j], &filtered[i]) < 0
+			}
+			return cmp(&filtered[i], &filtered[j]) < 0
+		})
+	} else if desc {
+		for i, j := 0, len(filtered)-1; i < j; i, j = i+1, j-1 {
+			filtered[i], filtered[j] = filtered[j], filtered[i]
+		}
+	}
+
+	page := listPage[T]{
+		Total:    len(filtered),
+		Page:     q.Page,
+		PageSize: q.PageSize,
+	}
+
+	start := (q.Page - 1) * q.PageSize
+	if q.Cursor != "" {
+		data, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+		if err != nil {
+			return listPage[T]{}, errors.New("cursor 无效")
+		}
+		start = -1
+		for i := range filtered {
+			if spec.id(&filtered[i]) == string(data) {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			return listPage[T]{}, errors.New("cursor 无效")
+		}
+		page.Page = start/q.PageSize + 1
+	}
+
+	if start > len(filtered) {
+		start = len(filtered)
+	}
+	end := start + q.PageSize
+	if end > len(filtered) {
+		end = len(filtered)
+	}
+	page.Items = filtered[start:end]
+	if end < len(filtered) && end > 0 {
+		page.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(spec.id(&filtered[end-1])))
+	}
+
+	return page, nil
+}
+
+// respondList 输出分页列表,参数错误时返回 400
+func respondList[T any](c *gin.Context, q listQuery, items []T, spec listSpec[T], match func(*T) bool) {
+	page, err := paginate(items, q, spec, match)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// compareStrings 字符串比较
+func compareStrings(a, b string) int {
+	return strings.Compare(a, b)
+}
+
+// compareFloats 数值比较
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareTimes 时间比较
+func compareTimes(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+// compareDeletedAt 按删除时间比较,用于回收站列表
+func compareDeletedAt(a, b *time.Time) int {
+	var ta, tb time.Time
+	if a != nil {
+		ta = *a
+	}
+	if b != nil {
+		tb = *b
+	}
+	return compareTimes(ta, tb)
+}
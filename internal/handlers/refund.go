@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"ai-hacker/internal/audit"
+	"ai-hacker/internal/models"
+	"ai-hacker/internal/payment"
+	"ai-hacker/internal/utils"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// orderTransitions 订单状态允许的流转
+var orderTransitions = map[string][]string{
+	models.OrderStatusPending:         {models.OrderStatusCompleted, models.OrderStatusCancelled},
+	models.OrderStatusCompleted:       {models.OrderStatusPartialRefunded, models.OrderStatusRefunded, models.OrderStatusCancelled},
+	models.OrderStatusPartialRefunded: {models.OrderStatusPartialRefunded, models.OrderStatusRefunded},
+}
+
+// canTransition 检查订单状态能否从 from 变更为 to
+// from 为迁移后仍无法识别的早期状态时允许变更,以便管理员修正
+func canTransition(from, to string) bool {
+	if !isOrderStatus(from) {
+		return true
+	}
+	for _, s := range orderTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// isOrderStatus 是否为当前版本的订单状态
+func isOrderStatus(status string) bool {
+	switch status {
+	case models.OrderStatusPending, models.OrderStatusCompleted, models.OrderStatusPartialRefunded,
+		models.OrderStatusRefunded, models.OrderStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// RefundOrder 订单退款（管理员）
+// 未指定金额或金额为 0 时退还剩余全部金额,负数和不足 0.01 的金额拒绝;全额退款时按 key_action 处理卡密,部分退款保留卡密
+func RefundOrder(c *gin.Context) {
+	var req struct {
+		Amount    float64 `json:"amount"`
+		Reason    string  `json:"reason" binding:"required"`
+		KeyAction string  `json:"key_action"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请填写退款原因"})
+		return
+	}
+
+	settleOrder(c, "refund", req.Amount, req.Reason, req.KeyAction)
+}
+
+// CancelOrder 取消订单（管理员）
+// 取消时退还剩余全部金额,并按 key_action 处理卡密
+func CancelOrder(c *gin.Context) {
+	var req struct {
+		Reason    string `json:"reason" binding:"required"`
+		KeyAction string `json:"key_action"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请填写取消原因"})
+		return
+	}
+
+	settleOrder(c, "cancel", 0, req.Reason, req.KeyAction)
+}
+
+// settleOrder 执行退款或取消
+func settleOrder(c *gin.Context, refundType string, amount float64, reason, keyAction string) {
+	orderID := c.Param("id")
+
+	var orders []models.Order
+	utils.LoadFromFile(ordersFile, &orders)
+
+	var order *models.Order
+	for i := range orders {
+		if orders[i].ID == orderID && !orders[i].IsDeleted() {
+			order = &orders[i]
+			break
+		}
+	}
+
+	if order == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
+		return
+	}
+
+	remaining := roundAmount(order.Amount - order.RefundedAmount)
+	if amount < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "退款金额不能为负数"})
+		return
+	}
+	// 取消和未填写金额的退款退还剩余全部金额
+	if amount == 0 || refundType == "cancel" {
+		amount = remaining
+	} else if amount = roundAmount(amount); amount == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "退款金额至少为 ￥0.01"})
+		return
+	}
+	if amount > remaining {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("退款金额超过可退金额 ￥%.2f", remaining)})
+		return
+	}
+
+	// 计算目标状态
+	newStatus := models.OrderStatusRefunded
+	if refundType == "cancel" {
+		newStatus = models.OrderStatusCancelled
+	} else if amount < remaining {
+		newStatus = models.OrderStatusPartialRefunded
+	}
+
+	if !canTransition(order.Status, newStatus) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("订单状态为%s，不能变更为%s", order.Status, newStatus)})
+		return
+	}
+
+	// 部分退款保留卡密,全额退款和取消必须指定卡密处理方式
+	if newStatus == models.OrderStatusPartialRefunded {
+		keyAction = models.KeyActionKeep
+	} else if keyAction != models.KeyActionRestock && keyAction != models.KeyActionVoid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请选择卡密处理方式: restock 或 void"})
+		return
+	}
+
+	// 调用支付渠道退款,失败时不修改订单
+	providerRef := ""
+	if provider, ok := payment.Get(order.PaymentMethod); ok && amount > 0 {
+		ref, err := provider.Refund(*order, amount, reason)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "支付渠道退款失败: " + err.Error()})
+			return
+		}
+		providerRef = ref
+	}
+
+	// 处理卡密
+	if keyAction != models.KeyActionKeep {
+		cardKeyID := order.CardKeyID
+		if cardKeyID == "" {
+			cardKeyID = findOrderCardKeyID(order.ID, order.CardKey)
+		}
+		if cardKeyID != "" {
+			releaseCardKey(cardKeyID, keyAction)
+		}
+	}
+
+	before := gin.H{"status": order.Status, "refunded_amount": order.RefundedAmount}
+	order.Status = newStatus
+	order.RefundedAmount = roundAmount(order.RefundedAmount + amount)
+	audit.Set(c, "orders."+refundType, "orders", order.ID, before, gin.H{"status": order.Status, "refunded_amount": order.RefundedAmount})
+	audit.SetDetail(c, fmt.Sprintf("金额 %.2f,卡密处理 %s,原因: %s", amount, keyAction, reason))
+	order.Refunds = append(order.Refunds, models.OrderRefund{
+		ID:          "RF" + utils.GenerateID(),
+		Type:        refundType,
+		Amount:      amount,
+		Reason:      reason,
+		Operator:    c.GetString("email"),
+		KeyAction:   keyAction,
+		ProviderRef: providerRef,
+		CreatedAt:   time.Now(),
+	})
+
+	utils.SaveToFile(ordersFile, orders)
+	if amount > 0 {
+		data := orderWebhookData(*order)
+		data["refund_type"] = refundType
+		data["refund_amount"] = amount
+		data["reason"] = reason
+		utils.PublishWebhookEvent(models.WebhookEventOrderRefunded, data)
+	}
+
+	message := "退款成功"
+	if refundType == "cancel" {
+		message = "订单已取消"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"order":   order,
+	})
+}
+
+// releaseCardKey 退款后处理卡密: 退回库存或作废
+func releaseCardKey(cardKeyID, keyAction string) {
+	var cardKeys []models.CardKey
+	utils.LoadFromFile(cardKeysFile, &cardKeys)
+
+	for i := range cardKeys {
+		if cardKeys[i].ID != cardKeyID {
+			continue
+		}
+
+		productID := cardKeys[i].ProductID
+		if keyAction == models.KeyActionRestock {
+			stockBefore := GetProductStock(productID)
+			cardKeys[i].Status = "unused"
+			cardKeys[i].OrderID = ""
+			cardKeys[i].UsedAt = ""
+			utils.SaveToFile(cardKeysFile, cardKeys)
+			checkRestock(productID, stockBefore)
+			return
+		}
+
+		cardKeys[i].Status = "void"
+		utils.SaveToFile(cardKeysFile, cardKeys)
+		return
+	}
+}
+
+// roundAmount 金额保留两位小数
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
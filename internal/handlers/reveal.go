@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"ai-hacker/internal/audit"
+	"ai-hacker/internal/models"
+	"ai-hacker/internal/utils"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const keyRevealsFile = "data/key_reveals.json"
+
+// keyRevealMu 保护查看记录的读改写,同时进行的查看和导出不能绕过配额或覆盖彼此的记录
+var keyRevealMu sync.Mutex
+
+// maskVisibleSuffix 脱敏后最多保留的末尾字符数
+const maskVisibleSuffix = 4
+
+// maskSecret 脱敏显示卡密,只保留末尾最多 4 个字符且不超过长度的四分之一,
+// 列表中看到的部分不足以还原卡密,查看明文需要经过 RevealCardKey 记录和配额
+func maskSecret(s string) string {
+	runes := []rune(s)
+	visible := min(len(runes)/4, maskVisibleSuffix)
+	return strings.Repeat("*", len(runes)-visible) + string(runes[len(runes)-visible:])
+}
+
+// maskCardKey 返回脱敏后的卡密,文件类卡密的文件名不脱敏
+func maskCardKey(ck models.CardKey) models.CardKey {
+	if ck.FileID != "" {
+		return ck
+	}
+	ck.Key = maskSecret(ck.Key)
+	if len(ck.Fields) > 0 {
+		fields := make(map[string]string, len(ck.Fields))
+		for name, value := range ck.Fields {
+			fields[name] = maskSecret(value)
+		}
+		ck.Fields = fields
+	}
+	return ck
+}
+
+// GetRevealDailyQuota 获取每个管理员每日可查看的卡密数量,0 表示不限制
+func GetRevealDailyQuota() int {
+	var settings []models.Setting
+	utils.LoadFromFile(settingsFile, &settings)
+
+	for _, s := range settings {
+		if s.Key == "reveal_daily_quota" && s.Value != "" {
+			if quota, err := strconv.Atoi(s.Value); err == nil && quota >= 0 {
+				return quota
+			}
+		}
+	}
+
+	return 0
+}
+
+// RevealCardKey 查看卡密明文（管理员）
+// 必须填写原因,每次查看都会记录;超出每日配额时拒绝并告警
+func RevealCardKey(c *gin.Context) {
+	cardKeyID := c.Param("id")
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Reason) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请填写查看原因"})
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+
+	var cardKeys []models.CardKey
+	utils.LoadFromFile(cardKeysFile, &cardKeys)
+
+	var cardKey *models.CardKey
+	for i := range cardKeys {
+		if cardKeys[i].ID == cardKeyID {
+			cardKey = &cardKeys[i]
+			break
+		}
+	}
+
+	if cardKey == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "卡密不存在"})
+		return
+	}
+
+	reveal := models.KeyReveal{
+		CardKeyID: cardKey.ID,
+		ProductID: cardKey.ProductID,
+		Operator:  c.GetString("email"),
+		Reason:    req.Reason,
+	}
+	remaining, err := RecordKeyReveal(reveal)
+	audit.Set(c, "cardkeys.reveal", "cardkeys", cardKey.ID, nil, nil)
+	if err != nil {
+		audit.SetDetail(c, "超出每日配额被拒绝,原因: "+req.Reason)
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	}
+	audit.SetDetail(c, "原因: "+req.Reason)
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":        cardKey.ID,
+		"key":       cardKey.Key,
+		"fields":    cardKey.Fields,
+		"remaining": remaining,
+	})
+}
+
+// RevealQuotaError 查看卡密超出每日配额
+type RevealQuotaError struct {
+	Quota     int // 每日配额
+	Used      int // 当天已查看的卡密数量
+	Requested int // 本次要查看的卡密数量
+}
+
+func (e *RevealQuotaError) Error() string {
+	if e.Requested > 1 {
+		return fmt.Sprintf("今日还可查看 %d 个卡密，本次导出 %d 个超出每日 %d 个的上限", max(e.Quota-e.Used, 0), e.Requested, e.Quota)
+	}
+	return fmt.Sprintf("今日查看卡密已达 %d 次上限", e.Quota)
+}
+
+// RecordKeyReveal 检查操作人当天的查看配额并记录一次卡密明文查看
+// 单个查看填写 CardKeyID,明文导出填写 CardKeyIDs,每个卡密都计入配额。
+// 超出配额时记录被拒绝的查看、告警并返回 *RevealQuotaError;
+// 返回当天剩余可查看的数量,-1 表示不限制
+func RecordKeyReveal(reveal models.KeyReveal) (int, error) {
+	now := time.Now()
+	reveal.ID = "RV" + utils.GenerateID()
+	reveal.CreatedAt = now
+
+	keyRevealMu.Lock()
+	defer keyRevealMu.Unlock()
+
+	var reveals []models.KeyReveal
+	utils.LoadFromFile(keyRevealsFile, &reveals)
+
+	// 统计当天已查看的卡密数量
+	today := now.Format("2006-01-02")
+	used := 0
+	alerted := false
+	for i := range reveals {
+		r := &reveals[i]
+		if r.Operator != reveal.Operator || r.CreatedAt.Format("2006-01-02") != today {
+			continue
+		}
+		if r.Blocked {
+			alerted = true
+		} else {
+			used += r.KeyCount()
+		}
+	}
+
+	requested := reveal.KeyCount()
+	quota := GetRevealDailyQuota()
+	if quota > 0 && used+requested > quota {
+		reveal.Blocked = true
+		reveals = append(reveals, reveal)
+		utils.SaveToFile(keyRevealsFile, reveals)
+
+		// 同一管理员每天只告警一次
+		if !alerted {
+			attempt := "查看卡密 " + reveal.CardKeyID
+			if reveal.CardKeyID == "" {
+				attempt = fmt.Sprintf("明文导出 %d 个卡密", requested)
+			}
+			message := fmt.Sprintf("管理员 %s 今日查看卡密已达 %d 次上限，仍在尝试%s。", reveal.Operator, quota, attempt)
+			payload := map[string]interface{}{
+				"operator":    reveal.Operator,
+				"quota":       quota,
+				"card_key_id": reveal.CardKeyID,
+				"count":       requested,
+				"reason":      reveal.Reason,
+			}
+			utils.Go(func() {
+				utils.NotifyAdmins("cardkey.reveal_quota", "卡密查看次数超限告警", message, payload)
+			})
+		}
+		return 0, &RevealQuotaError{Quota: quota, Used: used, Requested: requested}
+	}
+
+	reveals = append(reveals, reveal)
+	utils.SaveToFile(keyRevealsFile, reveals)
+
+	if quota > 0 {
+		return quota - used - requested, nil
+	}
+	return -1, nil
+}
+
+// 卡密查看记录排序字段
+var keyRevealListSpec = listSpec[models.KeyReveal]{
+	sorts: map[string]func(a, b *models.KeyReveal) int{
+		"created_at": func(a, b *models.KeyReveal) int { return compareTimes(a.CreatedAt, b.CreatedAt) },
+		"operator":   func(a, b *models.KeyReveal) int { return compareStrings(a.Operator, b.Operator) },
+	},
+	defaultSort: "created_at",
+	defaultDesc: true,
+	id:          func(r *models.KeyReveal) string { return r.ID },
+}
+
+// GetKeyReveals 获取卡密查看记录（管理员）
+// 默认最新的记录在前,id 按卡密筛选,email 按操作人筛选
+func GetKeyReveals(c *gin.Context) {
+	q, ok := parseListQuery(c)
+	if !ok {
+		return
+	}
+
+	var reveals []models.KeyReveal
+	utils.LoadFromFile(keyRevealsFile, &reveals)
+
+	respondList(c, q, reveals, keyRevealListSpec, func(r *models.KeyReveal) bool {
+		return q.matchID(r.CardKeyID) && q.matchEmail(r.Operator) && q.matchProduct(r.ProductID) && q.matchTime(r.CreatedAt)
+	})
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestMaskSecretVisibleChars(t *testing.T) {
+	tests := []struct {
+		length  int
+		visible int
+	}{
+		{0, 0},
+		{3, 0},
+		{4, 1},
+		{8, 2},
+		{12, 3},
+		{16, 4},
+		{32, 4},
+	}
+	for _, tt := range tests {
+		secret := strings.Repeat("A", tt.length)
+		masked := maskSecret(secret)
+
+		if got := utf8.RuneCountInString(masked); got != tt.length {
+			t.Errorf("长度 %d: 脱敏后长度为 %d", tt.length, got)
+		}
+		if got := tt.length - strings.Count(masked, "*"); got != tt.visible {
+			t.Errorf("长度 %d: 保留 %d 个字符,应为 %d", tt.length, got, tt.visible)
+		}
+	}
+}
+
+func TestMaskSecretKeepsSuffix(t *testing.T) {
+	if got := maskSecret("ABCD-EFGH-IJKL"); got != "***********JKL" {
+		t.Errorf("maskSecret 返回 %q", got)
+	}
+	// 按字符而不是字节计算
+	if got := maskSecret("卡密一二三四五六"); got != "******五六" {
+		t.Errorf("maskSecret 返回 %q", got)
+	}
+}
@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"ai-hacker/internal/audit"
 	"ai-hacker/internal/models"
 	"ai-hacker/internal/utils"
+	"fmt"
 	"net/http"
 	"strconv"
 
@@ -47,6 +49,7 @@ func CreateRole(c *gin.Context) {
 
 	roles = append(roles, newRole)
 	utils.SaveToFile(rolesFile, roles)
+	audit.Set(c, "roles.create", "roles", strconv.Itoa(newRole.ID), nil, newRole)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "角色创建成功",
@@ -78,7 +81,9 @@ func UpdateRole(c *gin.Context) {
 	found := false
 	for i := range roles {
 		if roles[i].ID == roleID {
+			before := roles[i]
 			roles[i].Permissions = updateData.Permissions
+			audit.Set(c, "roles.update", "roles", roleIDStr, before, roles[i])
 			found = true
 			break
 		}
@@ -111,15 +116,22 @@ func DeleteRole(c *gin.Context) {
 		return
 	}
 
-	// 检查是否有用户使用该角色
+	// 检查是否有用户使用该角色,级联策略下改为普通用户
 	var users []models.User
 	utils.LoadFromFile(usersFile, &users)
 
-	for _, user := range users {
-		if user.Role == roleID {
+	policy := GetDeletePolicy()
+	reassigned := 0
+	for i := range users {
+		if users[i].Role != roleID {
+			continue
+		}
+		if policy == DeletePolicyRestrict {
 			c.JSON(http.StatusConflict, gin.H{"error": "该角色下还有用户,无法删除"})
 			return
 		}
+		users[i].Role = 1
+		reassigned++
 	}
 
 	var roles []models.Role
@@ -129,6 +141,7 @@ func DeleteRole(c *gin.Context) {
 	newRoles := []models.Role{}
 	for _, role := range roles {
 		if role.ID == roleID {
+			audit.Set(c, "roles.delete", "roles", roleIDStr, role, nil)
 			found = true
 			continue
 		}
@@ -141,6 +154,13 @@ func DeleteRole(c *gin.Context) {
 	}
 
 	utils.SaveToFile(rolesFile, newRoles)
+	if reassigned > 0 {
+		utils.SaveToFile(usersFile, users)
+		audit.SetDetail(c, fmt.Sprintf("%d 个用户改为普通用户", reassigned))
+	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "角色删除成功"})
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "角色删除成功",
+		"reassigned_users": reassigned,
+	})
 }
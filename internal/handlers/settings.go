@@ -1,11 +1,16 @@
 package handlers
 
 import (
+	"ai-hacker/internal/audit"
 	"ai-hacker/internal/config"
 	"ai-hacker/internal/models"
 	"ai-hacker/internal/utils"
+	"errors"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -30,7 +35,7 @@ func GetSettings(c *gin.Context) {
 		settingsMap["smtp_host"] = cfg.Email.SMTPHost
 	}
 	if settingsMap["smtp_port"] == "" {
-		settingsMap["smtp_port"] = string(rune(cfg.Email.SMTPPort))
+		settingsMap["smtp_port"] = strconv.Itoa(cfg.Email.SMTPPort)
 	}
 	if settingsMap["smtp_username"] == "" {
 		settingsMap["smtp_username"] = cfg.Email.Username
@@ -38,17 +43,41 @@ func GetSettings(c *gin.Context) {
 	if settingsMap["smtp_from"] == "" {
 		settingsMap["smtp_from"] = cfg.Email.From
 	}
+	emailDefaults := map[string]string{
+		"mail_transport":    cfg.Email.Transport,
+		"smtp_security":     cfg.Email.Security,
+		"mail_file_path":    cfg.Email.FilePath,
+		"mail_api_provider": cfg.Email.APIProvider,
+		"mail_api_base_url": cfg.Email.APIBaseURL,
+		"mail_api_domain":   cfg.Email.APIDomain,
+	}
+	for key, value := range emailDefaults {
+		if settingsMap[key] == "" {
+			settingsMap[key] = value
+		}
+	}
+	if settingsMap["mail_transport"] == "" {
+		settingsMap["mail_transport"] = utils.MailTransportSMTP
+	}
 	if settingsMap["site_name"] == "" {
 		settingsMap["site_name"] = "AI HACKER"
 	}
 	
-	// 返回配置,但不返回密码
+	// 返回配置,但不返回密码和 API 密钥
 	c.JSON(http.StatusOK, gin.H{
 		"email": gin.H{
-			"smtp_host": settingsMap["smtp_host"],
-			"smtp_port": settingsMap["smtp_port"],
-			"username":  settingsMap["smtp_username"],
-			"from":      settingsMap["smtp_from"],
+			"transport":    settingsMap["mail_transport"],
+			"smtp_host":    settingsMap["smtp_host"],
+			"smtp_port":    settingsMap["smtp_port"],
+			"security":     settingsMap["smtp_security"],
+			"username":     settingsMap["smtp_username"],
+			"from":         settingsMap["smtp_from"],
+			"file_path":    settingsMap["mail_file_path"],
+			"api_provider": settingsMap["mail_api_provider"],
+			"api_key_set":  settingsMap["mail_api_key"] != "" || cfg.Email.APIKey != "",
+			"api_base_url": settingsMap["mail_api_base_url"],
+			"api_domain":   settingsMap["mail_api_domain"],
+			"configured":   utils.EmailConfigured(),
 		},
 		"site": gin.H{
 			"name":                settingsMap["site_name"],
@@ -56,6 +85,22 @@ func GetSettings(c *gin.Context) {
 			"footer_copyright":    settingsMap["footer_copyright"],
 			"enable_register":     settingsMap["enable_register"],
 			"purchase_interval":   settingsMap["purchase_interval"],
+			"trash_retention_days": settingsMap["trash_retention_days"],
+			"delete_policy":        settingsMap["delete_policy"],
+			"backup_interval_hours": settingsMap["backup_interval_hours"],
+			"backup_retention":      settingsMap["backup_retention"],
+		},
+		"alerts": gin.H{
+			"webhook_url":        settingsMap["alert_webhook_url"],
+			"reveal_daily_quota": settingsMap["reveal_daily_quota"],
+		},
+		"notifications": gin.H{
+			"telegram_bot_token_set": settingsMap["telegram_bot_token"] != "",
+			"telegram_chat_id":       settingsMap["telegram_chat_id"],
+			"telegram_api_base_url":  settingsMap["telegram_api_base_url"],
+			"routes":                 utils.NotificationRoutes(),
+			"events":                 utils.NotificationEvents(),
+			"channels":               utils.NotifyChannels(),
 		},
 		"legal": gin.H{
 			"terms":             settingsMap["terms_of_service"],
@@ -106,11 +151,18 @@ func GetLegalDocs(c *gin.Context) {
 // UpdateEmailConfig 更新邮件配置
 func UpdateEmailConfig(c *gin.Context) {
 	var req struct {
-		SMTPHost string `json:"smtp_host"`
-		SMTPPort int    `json:"smtp_port"`
-		Username string `json:"username"`
-		Password string `json:"password"`
-		From     string `json:"from"`
+		Transport   string `json:"transport"`
+		SMTPHost    string `json:"smtp_host"`
+		SMTPPort    int    `json:"smtp_port"`
+		Security    string `json:"security"`
+		Username    string `json:"username"`
+		Password    string `json:"password"`
+		From        string `json:"from"`
+		FilePath    string `json:"file_path"`
+		APIProvider string `json:"api_provider"`
+		APIKey      string `json:"api_key"`
+		APIBaseURL  string `json:"api_base_url"`
+		APIDomain   string `json:"api_domain"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -118,22 +170,49 @@ func UpdateEmailConfig(c *gin.Context) {
 		return
 	}
 
+	values := map[string]string{
+		"mail_transport":    req.Transport,
+		"smtp_security":     req.Security,
+		"mail_file_path":    req.FilePath,
+		"mail_api_provider": req.APIProvider,
+		"mail_api_base_url": req.APIBaseURL,
+		"mail_api_domain":   req.APIDomain,
+	}
+	for _, key := range []string{"mail_transport", "smtp_security", "mail_file_path", "mail_api_provider", "mail_api_base_url", "mail_api_domain"} {
+		if msg := ValidateSetting(key, values[key]); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": key + " " + msg})
+			return
+		}
+	}
+
 	var settings []models.Setting
 	utils.LoadFromFile(settingsFile, &settings)
+	before := settingsSnapshot(settings)
 	
 	// 更新或添加设置
 	updateSetting(&settings, "smtp_host", req.SMTPHost)
-	updateSetting(&settings, "smtp_port", string(rune(req.SMTPPort)))
+	smtpPort := ""
+	if req.SMTPPort > 0 {
+		smtpPort = strconv.Itoa(req.SMTPPort)
+	}
+	updateSetting(&settings, "smtp_port", smtpPort)
 	updateSetting(&settings, "smtp_username", req.Username)
 	updateSetting(&settings, "smtp_from", req.From)
+	for _, key := range []string{"mail_transport", "smtp_security", "mail_file_path", "mail_api_provider", "mail_api_base_url", "mail_api_domain"} {
+		updateSetting(&settings, key, values[key])
+	}
 	
 	// 如果提供了密码,则更新密码
 	if req.Password != "" {
 		updateSetting(&settings, "smtp_password", req.Password)
 	}
+	if req.APIKey != "" {
+		updateSetting(&settings, "mail_api_key", req.APIKey)
+	}
 
 	// 保存到数据文件
 	utils.SaveToFile(settingsFile, settings)
+	audit.Set(c, "settings.update", "settings", "email", before, settingsSnapshot(settings))
 
 	c.JSON(http.StatusOK, gin.H{"message": "邮件配置更新成功"})
 }
@@ -146,6 +225,10 @@ func UpdateSiteConfig(c *gin.Context) {
 		FooterCopyright  string `json:"footer_copyright"`
 		EnableRegister   string `json:"enable_register"`
 		PurchaseInterval string `json:"purchase_interval"`
+		TrashRetention   string `json:"trash_retention_days"`
+		DeletePolicy     string `json:"delete_policy"`
+		BackupInterval   string `json:"backup_interval_hours"`
+		BackupRetention  string `json:"backup_retention"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -155,6 +238,7 @@ func UpdateSiteConfig(c *gin.Context) {
 
 	var settings []models.Setting
 	utils.LoadFromFile(settingsFile, &settings)
+	before := settingsSnapshot(settings)
 	
 	// 更新网站配置
 	updateSetting(&settings, "site_name", req.SiteName)
@@ -162,9 +246,28 @@ func UpdateSiteConfig(c *gin.Context) {
 	updateSetting(&settings, "footer_copyright", req.FooterCopyright)
 	updateSetting(&settings, "enable_register", req.EnableRegister)
 	updateSetting(&settings, "purchase_interval", req.PurchaseInterval)
+	updateSetting(&settings, "trash_retention_days", req.TrashRetention)
+	if req.DeletePolicy != "" {
+		if msg := ValidateSetting("delete_policy", req.DeletePolicy); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		updateSetting(&settings, "delete_policy", req.DeletePolicy)
+	}
+	for key, value := range map[string]string{"backup_interval_hours": req.BackupInterval, "backup_retention": req.BackupRetention} {
+		if value == "" {
+			continue
+		}
+		if msg := ValidateSetting(key, value); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "备份设置" + msg})
+			return
+		}
+		updateSetting(&settings, key, value)
+	}
 
 	// 保存到数据文件
 	utils.SaveToFile(settingsFile, settings)
+	audit.Set(c, "settings.update", "settings", "site", before, settingsSnapshot(settings))
 
 	c.JSON(http.StatusOK, gin.H{"message": "网站配置更新成功"})
 }
@@ -183,6 +286,7 @@ func UpdateLegalConfig(c *gin.Context) {
 
 	var settings []models.Setting
 	utils.LoadFromFile(settingsFile, &settings)
+	before := settingsSnapshot(settings)
 	
 	// 获取当前时间
 	currentTime := time.Now().Format("2006-01-02")
@@ -199,10 +303,116 @@ func UpdateLegalConfig(c *gin.Context) {
 
 	// 保存到数据文件
 	utils.SaveToFile(settingsFile, settings)
+	audit.Set(c, "settings.update", "settings", "legal", before, settingsSnapshot(settings))
 
 	c.JSON(http.StatusOK, gin.H{"message": "法律文档更新成功"})
 }
 
+// UpdateAlertConfig 更新告警配置
+func UpdateAlertConfig(c *gin.Context) {
+	var req struct {
+		WebhookURL       string `json:"webhook_url"`
+		RevealDailyQuota string `json:"reveal_daily_quota"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	var settings []models.Setting
+	utils.LoadFromFile(settingsFile, &settings)
+	before := settingsSnapshot(settings)
+
+	updateSetting(&settings, "alert_webhook_url", req.WebhookURL)
+	updateSetting(&settings, "reveal_daily_quota", req.RevealDailyQuota)
+
+	// 保存到数据文件
+	utils.SaveToFile(settingsFile, settings)
+	audit.Set(c, "settings.update", "settings", "alerts", before, settingsSnapshot(settings))
+
+	c.JSON(http.StatusOK, gin.H{"message": "告警配置更新成功"})
+}
+
+// UpdateNotificationConfig 更新通知配置
+// routes 为事件到通知渠道的映射,未提供的事件保持不变,空列表表示不发送
+func UpdateNotificationConfig(c *gin.Context) {
+	var req struct {
+		TelegramBotToken   string              `json:"telegram_bot_token"`
+		TelegramChatID     string              `json:"telegram_chat_id"`
+		TelegramAPIBaseURL string              `json:"telegram_api_base_url"`
+		Routes             map[string][]string `json:"routes"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	values := map[string]string{
+		"telegram_chat_id":      strings.TrimSpace(req.TelegramChatID),
+		"telegram_api_base_url": strings.TrimSpace(req.TelegramAPIBaseURL),
+	}
+	keys := []string{"telegram_chat_id", "telegram_api_base_url"}
+	for event, channels := range req.Routes {
+		key := utils.NotificationRouteKey(event)
+		if _, ok := settingValidators[key]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "未知的通知事件: " + event})
+			return
+		}
+		values[key] = utils.FormatNotificationRoute(channels)
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		if msg := ValidateSetting(key, values[key]); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": key + " " + msg})
+			return
+		}
+	}
+
+	var settings []models.Setting
+	utils.LoadFromFile(settingsFile, &settings)
+	before := settingsSnapshot(settings)
+
+	for _, key := range keys {
+		updateSetting(&settings, key, values[key])
+	}
+	// 如果提供了机器人令牌,则更新令牌
+	if req.TelegramBotToken != "" {
+		updateSetting(&settings, "telegram_bot_token", strings.TrimSpace(req.TelegramBotToken))
+	}
+
+	// 保存到数据文件
+	utils.SaveToFile(settingsFile, settings)
+	audit.Set(c, "settings.update", "settings", "notifications", before, settingsSnapshot(settings))
+
+	c.JSON(http.StatusOK, gin.H{"message": "通知配置更新成功"})
+}
+
+// TestNotification 通过指定渠道发送测试通知
+func TestNotification(c *gin.Context) {
+	var req struct {
+		Channel string `json:"channel" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请选择通知渠道"})
+		return
+	}
+
+	err := utils.SendTestNotification(req.Channel)
+	if errors.Is(err, utils.ErrNotifierNotConfigured) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "测试通知发送成功"})
+}
+
 // TestEmail 测试邮件发送
 func TestEmail(c *gin.Context) {
 	var req struct {
@@ -215,28 +425,195 @@ func TestEmail(c *gin.Context) {
 	}
 
 	// 发送测试邮件
-	subject := "测试邮件 - AI HACKER"
-	body := `
-		<html>
-		<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333;">
-			<div style="max-width: 600px; margin: 0 auto; padding: 20px;">
-				<h2 style="color: #000; border-bottom: 2px solid #000; padding-bottom: 10px;">邮件配置测试</h2>
-				<p>您好，</p>
-				<p>这是一封测试邮件，用于验证 AI HACKER 系统的邮件配置是否正确。</p>
-				<p>如果您收到这封邮件，说明邮件服务配置成功。</p>
-				<hr style="border: none; border-top: 1px solid #ddd; margin: 20px 0;">
-				<p style="color: #999; font-size: 12px;">此邮件由系统自动发送，请勿回复。</p>
-			</div>
-		</body>
-		</html>
-	`
-
-	if err := utils.SendEmail(req.To, subject, body); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "发送测试邮件失败: " + err.Error()})
+	email, err := utils.RenderEmail(utils.EmailTemplateTest, utils.NewEmailData(req.To))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成测试邮件失败: " + err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "测试邮件发送成功"})
+	// 直接发送而不经过发送队列,返回发送方式的详细错误
+	transport := utils.EmailTransport()
+	response, err := utils.SendMail(utils.MailMessage{
+		To:      req.To,
+		Subject: email.Subject,
+		HTML:    email.HTML,
+		Text:    email.Text,
+		Type:    utils.EmailTemplateTest,
+		UserID:  c.GetString("user_id"),
+	})
+	if errors.Is(err, utils.ErrEmailNotConfigured) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "transport": transport})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":     err.Error(),
+			"transport": transport,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "测试邮件发送成功",
+		"transport": transport,
+		"response":  response,
+	})
+}
+
+// settingValidators 可以修改的设置项及校验函数,nil 表示不校验
+var settingValidators = map[string]func(value string) string{
+	"site_name":                   nil,
+	"site_announcement":           nil,
+	"footer_copyright":            nil,
+	"enable_register":             validateBoolSetting,
+	"purchase_interval":           validateCountSetting,
+	"trash_retention_days":        validateCountSetting,
+	"delete_policy":               validateDeletePolicy,
+	"backup_interval_hours":       validateCountSetting,
+	"backup_retention":            validateCountSetting,
+	"alert_webhook_url":           validateURLSetting,
+	"reveal_daily_quota":          validateCountSetting,
+	"telegram_bot_token":          nil,
+	"telegram_chat_id":            nil,
+	"telegram_api_base_url":       validateURLSetting,
+	"notify_order_paid":           validateNotifyRoute,
+	"notify_stock_low":            validateNotifyRoute,
+	"notify_backup_failed":        validateNotifyRoute,
+	"notify_cardkey_reveal_quota": validateNotifyRoute,
+	"smtp_host":                   nil,
+	"smtp_port":                   validateCountSetting,
+	"smtp_username":               nil,
+	"smtp_password":               nil,
+	"smtp_from":                   nil,
+	"smtp_security":               validateSMTPSecurity,
+	"mail_transport":              validateMailTransport,
+	"mail_file_path":              validateMailFilePath,
+	"mail_api_provider":           validateMailProvider,
+	"mail_api_key":                nil,
+	"mail_api_base_url":           validateURLSetting,
+	"mail_api_domain":             nil,
+	"terms_of_service":            nil,
+	"privacy_policy":              nil,
+}
+
+// secretSettings 不对外显示的设置项
+var secretSettings = map[string]bool{"smtp_password": true, "mail_api_key": true, "telegram_bot_token": true}
+
+// SettingKeys 返回可以修改的设置项,按名称排序
+func SettingKeys() []string {
+	keys := make([]string, 0, len(settingValidators))
+	for key := range settingValidators {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// IsSecretSetting 设置项是否为密码等不显示的内容
+func IsSecretSetting(key string) bool {
+	return secretSettings[key]
+}
+
+// ValidateSetting 校验设置项的值,返回错误信息,空值表示恢复默认
+func ValidateSetting(key, value string) string {
+	validate, ok := settingValidators[key]
+	if !ok {
+		return "未知的设置项: " + key
+	}
+	if validate == nil || value == "" {
+		return ""
+	}
+	return validate(value)
+}
+
+func validateCountSetting(value string) string {
+	if n, err := strconv.Atoi(value); err != nil || n < 0 {
+		return "必须是非负整数"
+	}
+	return ""
+}
+
+func validateBoolSetting(value string) string {
+	if value != "true" && value != "false" {
+		return "只能是 true 或 false"
+	}
+	return ""
+}
+
+func validateDeletePolicy(value string) string {
+	if value != DeletePolicyRestrict && value != DeletePolicyCascade {
+		return "无效的删除策略"
+	}
+	return ""
+}
+
+func validateMailTransport(value string) string {
+	if value != utils.MailTransportSMTP && value != utils.MailTransportFile && value != utils.MailTransportHTTP {
+		return "只能是 smtp、file 或 http"
+	}
+	return ""
+}
+
+func validateMailFilePath(value string) string {
+	if err := utils.ValidateMailFilePath(value); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func validateSMTPSecurity(value string) string {
+	if value != utils.SMTPSecuritySTARTTLS && value != utils.SMTPSecurityTLS && value != utils.SMTPSecurityNone {
+		return "只能是 starttls、tls 或 none"
+	}
+	return ""
+}
+
+func validateMailProvider(value string) string {
+	if value != utils.MailProviderSendGrid && value != utils.MailProviderMailgun {
+		return "只能是 sendgrid 或 mailgun"
+	}
+	return ""
+}
+
+// validateNotifyRoute 通知路由为逗号分隔的渠道,none 表示不发送
+func validateNotifyRoute(value string) string {
+	if _, err := utils.ParseNotificationRoute(value); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func validateURLSetting(value string) string {
+	if u, err := url.Parse(value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "必须是 http 或 https 地址"
+	}
+	return ""
+}
+
+// LoadSettings 读取全部设置项
+func LoadSettings() map[string]string {
+	var settings []models.Setting
+	utils.LoadFromFile(settingsFile, &settings)
+	return settingsSnapshot(settings)
+}
+
+// SaveSetting 保存单个设置项,返回修改前的值
+func SaveSetting(key, value string) (string, error) {
+	var settings []models.Setting
+	utils.LoadFromFile(settingsFile, &settings)
+	before := settingsSnapshot(settings)[key]
+
+	updateSetting(&settings, key, value)
+	return before, utils.SaveToFile(settingsFile, settings)
+}
+
+// settingsSnapshot 将设置转换为键值映射,用于记录变更
+func settingsSnapshot(settings []models.Setting) map[string]string {
+	m := make(map[string]string, len(settings))
+	for _, s := range settings {
+		m[s.Key] = s.Value
+	}
+	return m
 }
 
 // updateSetting 更新或添加设置项
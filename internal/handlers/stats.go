@@ -0,0 +1,396 @@
+package handlers
+
+import (
+	"ai-hacker/internal/models"
+	"ai-hacker/internal/utils"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 统计缓存的最长有效期,卡密过期等不写文件的变化在此时间后体现
+const statsMaxAge = 5 * time.Minute
+
+// 统计周期
+const (
+	statsPeriodDay   = "day"
+	statsPeriodWeek  = "week"
+	statsPeriodMonth = "month"
+)
+
+// StatsBucket 单个时间段的销售统计
+type StatsBucket struct {
+	Period        string  `json:"period"`
+	Revenue       float64 `json:"revenue"`       // 扣除退款后的销售额
+	Orders        int     `json:"orders"`        // 有效订单数,不含已取消订单
+	Units         int     `json:"units"`         // 售出件数,不含已全额退款订单
+	Registrations int     `json:"registrations"` // 新注册用户数
+}
+
+// ProductStats 单个商品的销售和库存统计
+type ProductStats struct {
+	ProductID   string  `json:"product_id"`
+	ProductName string  `json:"product_name"`
+	Revenue     float64 `json:"revenue"`
+	Orders      int     `json:"orders"`
+	Units       int     `json:"units"`
+	Remaining   int     `json:"remaining"`         // 可售库存
+	Sold        int     `json:"sold"`              // 已售出的卡密数
+	Deleted     bool    `json:"deleted,omitempty"` // 商品已删除或不存在
+}
+
+// statsSnapshot 一次全量扫描得到的统计结果,生成后只读
+type statsSnapshot struct {
+	days       map[string]*StatsBucket // 按天汇总,键为 2006-01-02
+	products   []ProductStats
+	total      StatsBucket
+	users      int
+	buyers     int // 下过有效订单的注册用户数
+	computedAt time.Time
+}
+
+// 统计缓存,数据文件变化或超过最长有效期时重新计算
+var statsCache struct {
+	sync.Mutex
+	signature string
+	snapshot  *statsSnapshot
+}
+
+// statsSignature 根据数据文件的修改时间和大小生成签名
+func statsSignature() string {
+	signature := ""
+	for _, file := range []string{ordersFile, usersFile, productsFile, cardKeysFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			signature += file + ":-;"
+			continue
+		}
+		signature += fmt.Sprintf("%s:%d:%d;", file, info.ModTime().UnixNano(), info.Size())
+	}
+	return signature
+}
+
+// loadStats 获取统计结果,命中缓存时不再扫描数据文件
+func loadStats() *statsSnapshot {
+	statsCache.Lock()
+	defer statsCache.Unlock()
+
+	signature := statsSignature()
+	if statsCache.snapshot != nil && statsCache.signature == signature && time.Since(statsCache.snapshot.computedAt) < statsMaxAge {
+		return statsCache.snapshot
+	}
+
+	statsCache.snapshot = computeStats()
+	statsCache.signature = signature
+	return statsCache.snapshot
+}
+
+// computeStats 扫描订单、用户、商品和卡密生成统计结果
+func computeStats() *statsSnapshot {
+	var orders []models.Order
+	var users []models.User
+	var products []models.Product
+	var cardKeys []models.CardKey
+	utils.LoadFromFile(ordersFile, &orders)
+	utils.LoadFromFile(usersFile, &users)
+	utils.LoadFromFile(productsFile, &products)
+	utils.LoadFromFile(cardKeysFile, &cardKeys)
+
+	now := time.Now()
+	snapshot := &statsSnapshot{
+		days:       make(map[string]*StatsBucket),
+		computedAt: now,
+	}
+
+	day := func(t time.Time) *StatsBucket {
+		key := t.Local().Format("2006-01-02")
+		bucket, ok := snapshot.days[key]
+		if !ok {
+			bucket = &StatsBucket{Period: key}
+			snapshot.days[key] = bucket
+		}
+		return bucket
+	}
+
+	// 商品统计,已删除的商品保留销售数据
+	// 早期订单没有商品 ID,按商品名称归入同名商品,优先使用未删除的商品
+	productIndex := make(map[string]int)
+	for _, product := range products {
+		i := len(snapshot.products)
+		productIndex[product.ID] = i
+		snapshot.products = append(snapshot.products, ProductStats{
+			ProductID:   product.ID,
+			ProductName: product.Name,
+			Deleted:     product.IsDeleted(),
+		})
+		nameKey := "name:" + product.Name
+		if j, ok := productIndex[nameKey]; !ok || (snapshot.products[j].Deleted && !product.IsDeleted()) {
+			productIndex[nameKey] = i
+		}
+	}
+	productOf := func(id, name string) *ProductStats {
+		key := id
+		if key == "" {
+			key = "name:" + name
+		}
+		i, ok := productIndex[key]
+		if !ok {
+			i = len(snapshot.products)
+			productIndex[key] = i
+			// 商品已不存在,只保留销售数据
+			snapshot.products = append(snapshot.products, ProductStats{ProductID: id, ProductName: name, Deleted: true})
+		}
+		return &snapshot.products[i]
+	}
+
+	registered := make(map[string]bool)
+	for _, user := range users {
+		if user.IsDeleted() {
+			continue
+		}
+		snapshot.users++
+		registered[user.Email] = true
+		if !user.CreatedAt.IsZero() {
+			day(user.CreatedAt).Registrations++
+		}
+	}
+
+	buyers := make(map[string]bool)
+	for _, order := range orders {
+		if order.IsDeleted() || order.Status == models.OrderStatusCancelled {
+			continue
+		}
+
+		revenue := order.Amount - order.RefundedAmount
+		units := 1
+		if order.Status == models.OrderStatusRefunded {
+			units = 0
+		}
+
+		snapshot.total.Revenue += revenue
+		snapshot.total.Orders++
+		snapshot.total.Units += units
+		if !order.CreatedAt.IsZero() {
+			bucket := day(order.CreatedAt)
+			bucket.Revenue += revenue
+			bucket.Orders++
+			bucket.Units += units
+		}
+
+		product := productOf(order.ProductID, order.ProductName)
+		product.Revenue += revenue
+		product.Orders++
+		product.Units += units
+
+		if registered[order.Email] {
+			buyers[order.Email] = true
+		}
+	}
+	snapshot.buyers = len(buyers)
+
+	for i := range cardKeys {
+		ck := &cardKeys[i]
+		if ck.IsDeleted() {
+			continue
+		}
+		idx, ok := productIndex[ck.ProductID]
+		if !ok {
+			continue
+		}
+		switch {
+		case ck.Status == "used":
+			snapshot.products[idx].Sold++
+		case ck.Status == "unused" && !isCardKeyExpired(ck, now):
+			snapshot.products[idx].Remaining++
+		}
+	}
+
+	for _, bucket := range snapshot.days {
+		bucket.Revenue = roundAmount(bucket.Revenue)
+	}
+	for i := range snapshot.products {
+		snapshot.products[i].Revenue = roundAmount(snapshot.products[i].Revenue)
+	}
+	snapshot.total.Revenue = roundAmount(snapshot.total.Revenue)
+
+	return snapshot
+}
+
+// periodKey 返回时间所在统计周期的键
+func periodKey(t time.Time, period string) string {
+	switch period {
+	case statsPeriodWeek:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case statsPeriodMonth:
+		return t.Format("2006-01")
+	}
+	return t.Format("2006-01-02")
+}
+
+// salesSeries 按周期汇总指定日期范围的统计,没有数据的周期补零
+func (s *statsSnapshot) salesSeries(period string, from, to time.Time) []StatsBucket {
+	series := []StatsBucket{}
+	index := make(map[string]int)
+
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.Local)
+	for d := start; !d.After(to); d = d.AddDate(0, 0, 1) {
+		key := periodKey(d, period)
+		i, ok := index[key]
+		if !ok {
+			i = len(series)
+			index[key] = i
+			series = append(series, StatsBucket{Period: key})
+		}
+
+		bucket, ok := s.days[d.Format("2006-01-02")]
+		if !ok {
+			continue
+		}
+		series[i].Revenue += bucket.Revenue
+		series[i].Orders += bucket.Orders
+		series[i].Units += bucket.Units
+		series[i].Registrations += bucket.Registrations
+	}
+
+	for i := range series {
+		series[i].Revenue = roundAmount(series[i].Revenue)
+	}
+	return series
+}
+
+// GetStatsOverview 获取销售概览（管理员）
+func GetStatsOverview(c *gin.Context) {
+	stats := loadStats()
+
+	today := time.Now().Format("2006-01-02")
+	todayStats := StatsBucket{Period: today}
+	if bucket, ok := stats.days[today]; ok {
+		todayStats = *bucket
+	}
+
+	conversion := 0.0
+	if stats.users > 0 {
+		conversion = float64(stats.buyers) / float64(stats.users)
+	}
+
+	products := 0
+	for _, p := range stats.products {
+		if !p.Deleted {
+			products++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"revenue":         stats.total.Revenue,
+		"orders":          stats.total.Orders,
+		"units":           stats.total.Units,
+		"users":           stats.users,
+		"buyers":          stats.buyers,
+		"conversion_rate": conversion,
+		"products":        products,
+		"today":           todayStats,
+		"computed_at":     stats.computedAt,
+	})
+}
+
+// GetSalesStats 按日、周或月获取销售趋势（管理员）
+// 参数 period 为 day / week / month,from 和 to 为日期,默认最近 30 天、12 周或 12 个月
+func GetSalesStats(c *gin.Context) {
+	period := c.DefaultQuery("period", statsPeriodDay)
+
+	to := time.Now()
+	var from time.Time
+	switch period {
+	case statsPeriodDay:
+		from = to.AddDate(0, 0, -29)
+	case statsPeriodWeek:
+		from = to.AddDate(0, 0, -7*11)
+	case statsPeriodMonth:
+		from = to.AddDate(0, -11, 0)
+		from = time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.Local)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "period 只能是 day、week 或 month"})
+		return
+	}
+
+	if v := c.Query("from"); v != "" {
+		t, err := utils.ParseTime(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "开始时间格式错误"})
+			return
+		}
+		from = t
+	}
+	if v := c.Query("to"); v != "" {
+		t, err := utils.ParseTime(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "结束时间格式错误"})
+			return
+		}
+		to = t
+	}
+	if from.After(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "开始时间不能晚于结束时间"})
+		return
+	}
+	if to.Sub(from) > 5*366*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "统计范围不能超过 5 年"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"period": period,
+		"series": loadStats().salesSeries(period, from, to),
+	})
+}
+
+// GetTopProducts 获取热销商品（管理员）
+// 参数 sort 为 revenue 或 units,limit 默认 10
+func GetTopProducts(c *gin.Context) {
+	sortBy := c.DefaultQuery("sort", "revenue")
+	if sortBy != "revenue" && sortBy != "units" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort 只能是 revenue 或 units"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit 参数错误"})
+		return
+	}
+
+	top := []ProductStats{}
+	for _, p := range loadStats().products {
+		if p.Orders > 0 {
+			top = append(top, p)
+		}
+	}
+	sort.SliceStable(top, func(i, j int) bool {
+		if sortBy == "units" && top[i].Units != top[j].Units {
+			return top[i].Units > top[j].Units
+		}
+		return top[i].Revenue > top[j].Revenue
+	})
+	if len(top) > limit {
+		top = top[:limit]
+	}
+
+	c.JSON(http.StatusOK, top)
+}
+
+// GetStockStats 获取各商品的剩余库存和已售数量（管理员）
+func GetStockStats(c *gin.Context) {
+	result := []ProductStats{}
+	for _, p := range loadStats().products {
+		if !p.Deleted {
+			result = append(result, p)
+		}
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"ai-hacker/internal/models"
+	"ai-hacker/internal/utils"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const stockSubscriptionsFile = "data/stock_subscriptions.json"
+
+// SubscribeRestock 订阅到货通知
+func SubscribeRestock(c *gin.Context) {
+	productID := c.Param("id")
+
+	var req struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "邮箱格式错误"})
+		return
+	}
+
+	if findProduct(productID) == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "商品不存在"})
+		return
+	}
+
+	if GetProductStock(productID) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "商品有货，可直接购买"})
+		return
+	}
+
+	var subscriptions []models.StockSubscription
+	utils.LoadFromFile(stockSubscriptionsFile, &subscriptions)
+
+	// 已有待通知的订阅时不重复添加
+	for _, s := range subscriptions {
+		if s.ProductID == productID && s.Email == req.Email && s.NotifiedAt == nil {
+			c.JSON(http.StatusOK, gin.H{"message": "您已订阅到货通知"})
+			return
+		}
+	}
+
+	subscriptions = append(subscriptions, models.StockSubscription{
+		ID:        "SUB" + utils.GenerateID(),
+		ProductID: productID,
+		Email:     req.Email,
+		CreatedAt: time.Now(),
+	})
+	utils.SaveToFile(stockSubscriptionsFile, subscriptions)
+
+	c.JSON(http.StatusOK, gin.H{"message": "订阅成功，到货后将通过邮件通知您"})
+}
+
+// checkLowStock 售出后检查库存是否低于告警阈值
+// 库存首次跌破阈值或售罄时告警,避免每笔订单重复告警
+func checkLowStock(product *models.Product, before int) {
+	publishStockChanged(product.ID, before)
+	if product.LowStockThreshold <= 0 {
+		return
+	}
+
+	remaining := GetProductStock(product.ID)
+	crossed := before >= product.LowStockThreshold && remaining < product.LowStockThreshold
+	if !crossed && remaining > 0 {
+		return
+	}
+
+	subject := "库存不足告警"
+	message := fmt.Sprintf("商品 %s (%s) 剩余库存 %d，低于告警阈值 %d，请及时补充卡密。",
+		product.Name, product.ID, remaining, product.LowStockThreshold)
+	if remaining == 0 {
+		subject = "商品售罄告警"
+		message = fmt.Sprintf("商品 %s (%s) 已售罄，请及时补充卡密。", product.Name, product.ID)
+	}
+
+	payload := map[string]interface{}{
+		"product_id":   product.ID,
+		"product_name": product.Name,
+		"stock":        remaining,
+		"threshold":    product.LowStockThreshold,
+	}
+	utils.PublishWebhookEvent(models.WebhookEventStockLow, payload)
+	utils.Go(func() {
+		utils.NotifyAdmins("stock.low", subject, message, payload)
+	})
+}
+
+// publishStockChanged 库存与 before 不同时发布库存变化的实时事件
+func publishStockChanged(productID string, before int) {
+	stock := GetProductStock(productID)
+	if stock == before {
+		return
+	}
+	data := gin.H{
+		"product_id": productID,
+		"stock":      stock,
+		"before":     before,
+	}
+	if product := findProduct(productID); product != nil {
+		data["product_name"] = product.Name
+	}
+	utils.PublishAdminEvent(utils.AdminEventStockChanged, data)
+}
+
+// publishCardKeysImported 推送卡密导入事件,source 为导入方式 (csv 或 upload)
+func publishCardKeysImported(productID string, count int, source string) {
+	if count == 0 {
+		return
+	}
+	data := gin.H{
+		"product_id": productID,
+		"count":      count,
+		"source":     source,
+		"stock":      GetProductStock(productID),
+	}
+	if product := findProduct(productID); product != nil {
+		data["product_name"] = product.Name
+	}
+	utils.PublishWebhookEvent(models.WebhookEventCardKeyImported, data)
+}
+
+// checkRestock 补充卡密后检查是否从无货变为有货,是则通知订阅用户
+func checkRestock(productID string, before int) {
+	publishStockChanged(productID, before)
+	if before > 0 || GetProductStock(productID) <= 0 {
+		return
+	}
+
+	product := findProduct(productID)
+	if product == nil {
+		return
+	}
+
+	var subscriptions []models.StockSubscription
+	utils.LoadFromFile(stockSubscriptionsFile, &subscriptions)
+
+	var pending []string
+	now := time.Now()
+	for i := range subscriptions {
+		if subscriptions[i].ProductID == productID && subscriptions[i].NotifiedAt == nil {
+			pending = append(pending, subscriptions[i].Email)
+			subscriptions[i].NotifiedAt = &now
+		}
+	}
+
+	if len(pending) == 0 {
+		return
+	}
+	utils.SaveToFile(stockSubscriptionsFile, subscriptions)
+
+	// 到货通知加入发送队列
+	for _, email := range pending {
+		if err := utils.QueueRestockEmail(email, product.Name); err != nil {
+			log.Printf("到货通知加入发送队列失败: %v", err)
+		}
+	}
+}
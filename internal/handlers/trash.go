@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"ai-hacker/internal/audit"
+	"ai-hacker/internal/models"
+	"ai-hacker/internal/utils"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 回收站默认保留天数
+const defaultTrashRetentionDays = 30
+
+// softDeletable 支持回收站的模型指针约束
+type softDeletable[T any] interface {
+	*T
+	SoftDeleteInfo() *models.SoftDelete
+}
+
+var errTrashNotFound = errors.New("回收站中不存在该记录")
+
+// listTrash 返回文件中已删除的记录
+func listTrash[T any, PT softDeletable[T]](file string) []T {
+	var items []T
+	utils.LoadFromFile(file, &items)
+
+	result := []T{}
+	for i := range items {
+		if PT(&items[i]).SoftDeleteInfo().IsDeleted() {
+			result = append(result, items[i])
+		}
+	}
+	return result
+}
+
+// trashPage 分页返回回收站记录,默认按删除时间倒序,时间范围按删除时间筛选
+// 参数错误时直接返回 400
+func trashPage[T any, PT softDeletable[T]](c *gin.Context, file string, idOf func(*T) string) (listPage[T], bool) {
+	q, ok := parseListQuery(c)
+	if !ok {
+		return listPage[T]{}, false
+	}
+
+	spec := listSpec[T]{
+		sorts: map[string]func(a, b *T) int{
+			"deleted_at": func(a, b *T) int {
+				return compareDeletedAt(PT(a).SoftDeleteInfo().DeletedAt, PT(b).SoftDeleteInfo().DeletedAt)
+			},
+		},
+		defaultSort: "deleted_at",
+		defaultDesc: true,
+		id:          idOf,
+	}
+
+	page, err := paginate(listTrash[T, PT](file), q, spec, func(item *T) bool {
+		return q.matchID(idOf(item)) && q.matchTime(*PT(item).SoftDeleteInfo().DeletedAt)
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return listPage[T]{}, false
+	}
+	return page, true
+}
+
+// findTrash 在已删除的记录中查找指定 ID
+func findTrash[T any, PT softDeletable[T]](items []T, id string, idOf func(*T) string) *T {
+	for i := range items {
+		if idOf(&items[i]) == id && PT(&items[i]).SoftDeleteInfo().IsDeleted() {
+			return &items[i]
+		}
+	}
+	return nil
+}
+
+// purgeTrash 彻底删除超过保留期的记录,返回被清除的记录
+func purgeTrash[T any, PT softDeletable[T]](file string, cutoff time.Time) []T {
+	var items []T
+	utils.LoadFromFile(file, &items)
+
+	kept := []T{}
+	purged := []T{}
+	for i := range items {
+		info := PT(&items[i]).SoftDeleteInfo()
+		if info.IsDeleted() && info.DeletedAt.Before(cutoff) {
+			purged = append(purged, items[i])
+			continue
+		}
+		kept = append(kept, items[i])
+	}
+
+	if len(purged) > 0 {
+		utils.SaveToFile(file, kept)
+	}
+	return purged
+}
+
+// GetTrashRetentionDays 获取回收站保留天数
+func GetTrashRetentionDays() int {
+	var settings []models.Setting
+	utils.LoadFromFile(settingsFile, &settings)
+
+	for _, s := range settings {
+		if s.Key == "trash_retention_days" && s.Value != "" {
+			if days, err := strconv.Atoi(s.Value); err == nil && days > 0 {
+				return days
+			}
+		}
+	}
+
+	return defaultTrashRetentionDays
+}
+
+// PurgeTrash 彻底删除回收站中超过保留期的订单、用户、商品和卡密
+func PurgeTrash() int {
+	cutoff := time.Now().AddDate(0, 0, -GetTrashRetentionDays())
+
+	count := len(purgeTrash[models.Order](ordersFile, cutoff))
+	count += len(purgeTrash[models.User](usersFile, cutoff))
+	count += len(purgeTrash[models.Product](productsFile, cutoff))
+
+	cardKeys := purgeTrash[models.CardKey](cardKeysFile, cutoff)
+	for _, ck := range cardKeys {
+		// 未售出的文件类卡密同时删除文件
+		if ck.FileID != "" && ck.Status == "unused" {
+			deleteDeliveryFile(ck.FileID)
+		}
+	}
+	count += len(cardKeys)
+
+	if count > 0 {
+		log.Printf("回收站清理: 彻底删除 %d 条记录", count)
+	}
+	return count
+}
+
+// StartTrashPurgeJob 启动回收站定时清理任务,启动时执行一次,之后每天执行一次,ctx 结束时退出
+func StartTrashPurgeJob(ctx context.Context) {
+	utils.Go(func() {
+		PurgeTrash()
+
+		ticker := time.NewTicker(24 * time.Hour)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				PurgeTrash()
+			}
+		}
+	})
+}
+
+// GetTrashOrders 获取回收站中的订单（管理员）
+func GetTrashOrders(c *gin.Context) {
+	if page, ok := trashPage[models.Order](c, ordersFile, func(o *models.Order) string { return o.ID }); ok {
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+// RestoreOrder 从回收站恢复订单
+func RestoreOrder(c *gin.Context) {
+	var orders []models.Order
+	utils.LoadFromFile(ordersFile, &orders)
+
+	order := findTrash(orders, c.Param("id"), func(o *models.Order) string { return o.ID })
+	if order == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": errTrashNotFound.Error()})
+		return
+	}
+
+	order.Restore()
+	utils.SaveToFile(ordersFile, orders)
+	audit.Set(c, "orders.restore", "orders", order.ID, nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "订单已恢复"})
+}
+
+// GetTrashUsers 获取回收站中的用户（管理员）
+func GetTrashUsers(c *gin.Context) {
+	page, ok := trashPage[models.User](c, usersFile, func(u *models.User) string { return u.ID })
+	if !ok {
+		return
+	}
+	for i := range page.Items {
+		page.Items[i].Password = ""
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// RestoreUser 从回收站恢复用户,邮箱已被新用户占用时不允许恢复
+func RestoreUser(c *gin.Context) {
+	var users []models.User
+	utils.LoadFromFile(usersFile, &users)
+
+	user := findTrash(users, c.Param("id"), func(u *models.User) string { return u.ID })
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": errTrashNotFound.Error()})
+		return
+	}
+
+	for i := range users {
+		if &users[i] != user && users[i].Email == user.Email && !users[i].IsDeleted() {
+			c.JSON(http.StatusConflict, gin.H{"error": "该邮箱已被其他用户使用,无法恢复"})
+			return
+		}
+	}
+
+	user.Restore()
+	utils.SaveToFile(usersFile, users)
+	audit.Set(c, "users.restore", "users", user.ID, nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "用户已恢复"})
+}
+
+// GetTrashProducts 获取回收站中的商品（管理员）
+func GetTrashProducts(c *gin.Context) {
+	if page, ok := trashPage[models.Product](c, productsFile, func(p *models.Product) string { return p.ID }); ok {
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+// RestoreProduct 从回收站恢复商品,同时恢复随商品一起删除的卡密
+func RestoreProduct(c *gin.Context) {
+	var products []models.Product
+	utils.LoadFromFile(productsFile, &products)
+
+	product := findTrash(products, c.Param("id"), func(p *models.Product) string { return p.ID })
+	if product == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": errTrashNotFound.Error()})
+		return
+	}
+
+	deletedAt := *product.DeletedAt
+	product.Restore()
+	utils.SaveToFile(productsFile, products)
+	audit.Set(c, "products.restore", "products", product.ID, nil, nil)
+
+	// 删除时间相同的卡密是随商品级联删除的
+	var cardKeys []models.CardKey
+	utils.LoadFromFile(cardKeysFile, &cardKeys)
+	restored := 0
+	for i := range cardKeys {
+		ck := &cardKeys[i]
+		if ck.ProductID == product.ID && ck.IsDeleted() && ck.DeletedAt.Equal(deletedAt) {
+			ck.Restore()
+			restored++
+		}
+	}
+	if restored > 0 {
+		utils.SaveToFile(cardKeysFile, cardKeys)
+		checkRestock(product.ID, 0)
+		audit.SetDetail(c, fmt.Sprintf("恢复卡密 %d 个", restored))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":           "商品已恢复",
+		"restored_cardkeys": restored,
+	})
+}
+
+// GetTrashCardKeys 获取回收站中的卡密（管理员）
+func GetTrashCardKeys(c *gin.Context) {
+	audit.Set(c, "cardkeys.view", "cardkeys", "", nil, nil)
+	audit.SetDetail(c, "回收站")
+
+	page, ok := trashPage[models.CardKey](c, cardKeysFile, cardKeyListSpec.id)
+	if !ok {
+		return
+	}
+	for i := range page.Items {
+		page.Items[i] = maskCardKey(page.Items[i])
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// RestoreCardKey 从回收站恢复卡密,所属商品仍在回收站时不允许恢复
+func RestoreCardKey(c *gin.Context) {
+	var cardKeys []models.CardKey
+	utils.LoadFromFile(cardKeysFile, &cardKeys)
+
+	cardKey := findTrash(cardKeys, c.Param("id"), func(ck *models.CardKey) string { return ck.ID })
+	if cardKey == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": errTrashNotFound.Error()})
+		return
+	}
+
+	if findProduct(cardKey.ProductID) == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "所属商品不存在或在回收站中,请先恢复商品"})
+		return
+	}
+
+	before := GetProductStock(cardKey.ProductID)
+	cardKey.Restore()
+	utils.SaveToFile(cardKeysFile, cardKeys)
+	audit.Set(c, "cardkeys.restore", "cardkeys", cardKey.ID, nil, nil)
+	checkRestock(cardKey.ProductID, before)
+
+	c.JSON(http.StatusOK, gin.H{"message": "卡密已恢复"})
+}
@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"ai-hacker/internal/audit"
+	"ai-hacker/internal/models"
+	"ai-hacker/internal/utils"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const webhooksFile = "data/webhooks.json"
+
+// webhookRequest 创建或修改 Webhook 的参数
+type webhookRequest struct {
+	URL          string   `json:"url"`
+	Events       []string `json:"events"`
+	Description  string   `json:"description"`
+	Active       *bool    `json:"active"`
+	RotateSecret bool     `json:"rotate_secret"` // 修改时重新生成签名密钥
+}
+
+// GetWebhooks 获取 Webhook 列表和可订阅的事件（管理员）
+// 签名密钥只在创建和重新生成时返回
+func GetWebhooks(c *gin.Context) {
+	var hooks []models.Webhook
+	utils.LoadFromFile(webhooksFile, &hooks)
+
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+	if hooks == nil {
+		hooks = []models.Webhook{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"webhooks": hooks,
+		"events":   utils.WebhookEvents(),
+	})
+}
+
+// CreateWebhook 创建 Webhook（管理员）
+func CreateWebhook(c *gin.Context) {
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	if msg := validateWebhook(req.URL, req.Events); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	secret, err := utils.GenerateWebhookSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成签名密钥失败"})
+		return
+	}
+
+	now := time.Now()
+	hook := models.Webhook{
+		ID:          "WH" + utils.GenerateID(),
+		URL:         req.URL,
+		Events:      req.Events,
+		Secret:      secret,
+		Description: req.Description,
+		Active:      req.Active == nil || *req.Active,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	var hooks []models.Webhook
+	utils.LoadFromFile(webhooksFile, &hooks)
+	hooks = append(hooks, hook)
+	if err := utils.SaveToFile(webhooksFile, hooks); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存 Webhook 失败"})
+		return
+	}
+	audit.Set(c, "webhooks.create", "webhooks", hook.ID, nil, hook)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Webhook 创建成功,请保存签名密钥,之后不再显示",
+		"webhook": hook,
+	})
+}
+
+// UpdateWebhook 修改 Webhook（管理员）
+// 未提供的字段保持不变,rotate_secret 为 true 时重新生成签名密钥
+func UpdateWebhook(c *gin.Context) {
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	var hooks []models.Webhook
+	utils.LoadFromFile(webhooksFile, &hooks)
+
+	var hook *models.Webhook
+	for i := range hooks {
+		if hooks[i].ID == c.Param("id") {
+			hook = &hooks[i]
+			break
+		}
+	}
+	if hook == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook 不存在"})
+		return
+	}
+	before := *hook
+
+	if req.URL != "" {
+		hook.URL = req.URL
+	}
+	if req.Events != nil {
+		hook.Events = req.Events
+	}
+	if req.Description != "" {
+		hook.Description = req.Description
+	}
+	if req.Active != nil {
+		hook.Active = *req.Active
+	}
+	if msg := validateWebhook(hook.URL, hook.Events); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if req.RotateSecret {
+		secret, err := utils.GenerateWebhookSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "生成签名密钥失败"})
+			return
+		}
+		hook.Secret = secret
+	}
+	hook.UpdatedAt = time.Now()
+
+	if err := utils.SaveToFile(webhooksFile, hooks); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存 Webhook 失败"})
+		return
+	}
+	audit.Set(c, "webhooks.update", "webhooks", hook.ID, before, *hook)
+
+	result := *hook
+	if !req.RotateSecret {
+		result.Secret = ""
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Webhook 更新成功",
+		"webhook": result,
+	})
+}
+
+// DeleteWebhook 删除 Webhook（管理员）
+// 推送记录保留,未完成的推送不再发送
+func DeleteWebhook(c *gin.Context) {
+	var hooks []models.Webhook
+	utils.LoadFromFile(webhooksFile, &hooks)
+
+	for i := range hooks {
+		if hooks[i].ID == c.Param("id") {
+			deleted := hooks[i]
+			hooks = append(hooks[:i], hooks[i+1:]...)
+			if err := utils.SaveToFile(webhooksFile, hooks); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "保存 Webhook 失败"})
+				return
+			}
+			audit.Set(c, "webhooks.delete", "webhooks", deleted.ID, deleted, nil)
+			c.JSON(http.StatusOK, gin.H{"message": "Webhook 已删除"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusNotFound, gin.H{"error": "Webhook 不存在"})
+}
+
+// PingWebhook 发送测试推送（管理员）
+func PingWebhook(c *gin.Context) {
+	var hooks []models.Webhook
+	utils.LoadFromFile(webhooksFile, &hooks)
+
+	for _, hook := range hooks {
+		if hook.ID == c.Param("id") {
+			delivery, err := utils.PingWebhook(hook)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "加入推送队列失败: " + err.Error()})
+				return
+			}
+			audit.Set(c, "webhooks.ping", "webhooks", hook.ID, nil, nil)
+			c.JSON(http.StatusOK, gin.H{
+				"message":  "测试推送已加入队列",
+				"delivery": delivery,
+			})
+			return
+		}
+	}
+
+	c.JSON(http.StatusNotFound, gin.H{"error": "Webhook 不存在"})
+}
+
+// 推送记录排序字段
+var webhookDeliveryListSpec = listSpec[models.WebhookDelivery]{
+	sorts: map[string]func(a, b *models.WebhookDelivery) int{
+		"created_at":      func(a, b *models.WebhookDelivery) int { return compareTimes(a.CreatedAt, b.CreatedAt) },
+		"next_attempt_at": func(a, b *models.WebhookDelivery) int { return compareTimes(a.NextAttemptAt, b.NextAttemptAt) },
+	},
+	defaultSort: "created_at",
+	defaultDesc: true,
+	id:          func(d *models.WebhookDelivery) string { return d.ID },
+}
+
+// GetWebhookDeliveries 查询推送记录（管理员）
+// 支持按状态、Webhook (webhook_id)、事件 (event) 和创建时间筛选,列表中不返回推送内容
+func GetWebhookDeliveries(c *gin.Context) {
+	q, ok := parseListQuery(c)
+	if !ok {
+		return
+	}
+
+	deliveries, err := utils.ListWebhookDeliveries()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取推送记录失败: " + err.Error()})
+		return
+	}
+	for i := range deliveries {
+		deliveries[i].Payload = ""
+	}
+
+	webhookID := c.Query("webhook_id")
+	event := c.Query("event")
+	respondList(c, q, deliveries, webhookDeliveryListSpec, func(d *models.WebhookDelivery) bool {
+		return q.matchID(d.ID) &&
+			q.matchStatus(d.Status) &&
+			(webhookID == "" || d.WebhookID == webhookID) &&
+			(event == "" || d.Event == event) &&
+			q.matchTime(d.CreatedAt)
+	})
+}
+
+// GetWebhookDelivery 获取推送详情,包括推送内容和每次尝试的结果（管理员）
+func GetWebhookDelivery(c *gin.Context) {
+	deliveries, err := utils.ListWebhookDeliveries()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取推送记录失败: " + err.Error()})
+		return
+	}
+
+	for _, d := range deliveries {
+		if d.ID == c.Param("id") {
+			c.JSON(http.StatusOK, d)
+			return
+		}
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": utils.ErrWebhookDeliveryNotFound.Error()})
+}
+
+// RedeliverWebhook 使用相同内容重新推送（管理员）
+func RedeliverWebhook(c *gin.Context) {
+	delivery, err := utils.RedeliverWebhook(c.Param("id"))
+	if errors.Is(err, utils.ErrWebhookDeliveryNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "加入推送队列失败: " + err.Error()})
+		return
+	}
+	audit.Set(c, "webhooks.redeliver", "webhook-deliveries", c.Param("id"), nil, nil)
+
+	delivery.Payload = ""
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "已重新加入推送队列",
+		"delivery": delivery,
+	})
+}
+
+// validateWebhook 校验推送地址和订阅的事件,返回错误信息
+func validateWebhook(url string, events []string) string {
+	if url == "" {
+		return "请填写推送地址"
+	}
+	if msg := validateURLSetting(url); msg != "" {
+		return "推送地址" + msg
+	}
+	if len(events) == 0 {
+		return "请至少订阅一个事件"
+	}
+	for _, e := range events {
+		if !utils.IsWebhookEvent(e) {
+			return "未知的事件: " + e
+		}
+	}
+	return ""
+}
+
+// orderWebhookData 订单事件的推送内容,不包含卡密
+func orderWebhookData(order models.Order) gin.H {
+	return gin.H{
+		"order_id":        order.ID,
+		"product_id":      order.ProductID,
+		"product_name":    order.ProductName,
+		"email":           order.Email,
+		"amount":          order.Amount,
+		"status":          order.Status,
+		"payment_method":  order.PaymentMethod,
+		"refunded_amount": order.RefundedAmount,
+		"created_at":      order.CreatedAt,
+	}
+}
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"ai-hacker/internal/audit"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 请求方法对应的默认操作
+var auditMethodActions = map[string]string{
+	http.MethodPost:   "create",
+	http.MethodPut:    "update",
+	http.MethodPatch:  "update",
+	http.MethodDelete: "delete",
+}
+
+// AuditLog 审计日志中间件
+// 所有修改类请求都会记录;查询类请求只在处理函数调用 audit.Set 时记录,如查看卡密
+func AuditLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		rec := audit.Get(c)
+		action, isWrite := auditMethodActions[c.Request.Method]
+		if rec == nil && !isWrite {
+			return
+		}
+		// 未通过认证的请求不记录
+		if c.GetString("email") == "" {
+			return
+		}
+
+		entity := auditEntity(c.FullPath())
+		entry := audit.Entry{
+			Actor:    c.GetString("email"),
+			ActorID:  c.GetString("user_id"),
+			Action:   entity + "." + action,
+			Entity:   entity,
+			TargetID: c.Param("id"),
+			IP:       c.ClientIP(),
+			Method:   c.Request.Method,
+			Path:     c.Request.URL.Path,
+			Status:   c.Writer.Status(),
+		}
+		if rec != nil {
+			if rec.Action != "" {
+				entry.Action = rec.Action
+			}
+			if rec.Entity != "" {
+				entry.Entity = rec.Entity
+			}
+			if rec.TargetID != "" {
+				entry.TargetID = rec.TargetID
+			}
+			entry.Diff = rec.Diff
+			entry.Detail = rec.Detail
+		}
+
+		if err := audit.Append(entry); err != nil {
+			log.Printf("写入审计日志失败: %v", err)
+		}
+	}
+}
+
+// auditEntity 从路由中取出操作对象,如 /api/admin/orders/:id 为 orders
+func auditEntity(fullPath string) string {
+	path := strings.TrimPrefix(fullPath, "/api/admin/")
+	if i := strings.Index(path, "/"); i >= 0 {
+		path = path[:i]
+	}
+	if path == "" {
+		return "admin"
+	}
+	return path
+}
@@ -14,6 +14,8 @@ type RateLimiter struct {
 	mu       sync.Mutex
 	limit    int
 	window   time.Duration
+	stop     chan struct{}
+	stopOnce sync.Once
 }
 
 // NewRateLimiter 创建限流器
@@ -22,6 +24,7 @@ func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
 		requests: make(map[string][]time.Time),
 		limit:    limit,
 		window:   window,
+		stop:     make(chan struct{}),
 	}
 	
 	// 定期清理过期记录
@@ -35,7 +38,13 @@ func (rl *RateLimiter) cleanup() {
 	ticker := time.NewTicker(time.Minute)
 	defer ticker.Stop()
 	
-	for range ticker.C {
+	for {
+		select {
+		case <-rl.stop:
+			return
+		case <-ticker.C:
+		}
+
 		rl.mu.Lock()
 		now := time.Now()
 		for key, times := range rl.requests {
@@ -56,6 +65,13 @@ func (rl *RateLimiter) cleanup() {
 	}
 }
 
+// Stop 停止定期清理,关闭服务时调用
+func (rl *RateLimiter) Stop() {
+	rl.stopOnce.Do(func() {
+		close(rl.stop)
+	})
+}
+
 // Allow 检查是否允许请求
 func (rl *RateLimiter) Allow(key string) bool {
 	rl.mu.Lock()
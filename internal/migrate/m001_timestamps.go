@@ -0,0 +1,385 @@
+package migrate
+
+import (
+	"ai-hacker/internal/models"
+	"ai-hacker/internal/utils"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// recordSpec 数据文件中需要迁移的字段
+type recordSpec struct {
+	idPrefix  string                // 缺少 ID 时生成的前缀,为空表示不补全
+	times     []string              // time.Time 字段
+	optional  []string              // *time.Time 字段,空值改为 null
+	strings   []string              // 字符串时间字段,统一为 utils.TimeLayout
+	endOfDay  []string              // 字符串时间字段中仅日期时视为当天结束的字段
+	createdAt string                // 为空时按 ID 中的时间戳补全的字段
+	nested    map[string]recordSpec // 嵌套的记录列表
+}
+
+// fileSpec 需要迁移的数据文件
+type fileSpec struct {
+	file  string
+	spec  recordSpec
+	model func() interface{}
+}
+
+var timestampFiles = []fileSpec{
+	{
+		file:  "data/products.json",
+		spec:  recordSpec{idPrefix: "P", optional: []string{"deleted_at"}},
+		model: func() interface{} { return &[]models.Product{} },
+	},
+	{
+		file: "data/orders.json",
+		spec: recordSpec{
+			idPrefix:  "ORD",
+			times:     []string{"created_at"},
+			optional:  []string{"deleted_at"},
+			createdAt: "created_at",
+			nested: map[string]recordSpec{
+				"refunds":      {idPrefix: "RF", times: []string{"created_at"}, createdAt: "created_at"},
+				"replacements": {times: []string{"created_at"}},
+			},
+		},
+		model: func() interface{} { return &[]models.Order{} },
+	},
+	{
+		file:  "data/users.json",
+		spec:  recordSpec{idPrefix: "U", times: []string{"created_at"}, optional: []string{"deleted_at"}, createdAt: "created_at"},
+		model: func() interface{} { return &[]models.User{} },
+	},
+	{
+		file: "data/card_keys.json",
+		spec: recordSpec{
+			idPrefix: "CK",
+			optional: []string{"deleted_at"},
+			strings:  []string{"used_at", "expires_at"},
+			endOfDay: []string{"expires_at"},
+		},
+		model: func() interface{} { return &[]models.CardKey{} },
+	},
+	{
+		// 文件 ID 同时是存储的文件名,不能补全
+		file:  "data/files.json",
+		spec:  recordSpec{times: []string{"created_at"}},
+		model: func() interface{} { return &[]models.DeliveryFile{} },
+	},
+	{
+		file:  "data/expiry_reports.json",
+		spec:  recordSpec{idPrefix: "EXP", times: []string{"run_at"}, createdAt: "run_at"},
+		model: func() interface{} { return &[]models.ExpiryReport{} },
+	},
+	{
+		file:  "data/stock_subscriptions.json",
+		spec:  recordSpec{idPrefix: "SUB", times: []string{"created_at"}, optional: []string{"notified_at"}, createdAt: "created_at"},
+		model: func() interface{} { return &[]models.StockSubscription{} },
+	},
+	{
+		file:  "data/key_reveals.json",
+		spec:  recordSpec{idPrefix: "RV", times: []string{"created_at"}, createdAt: "created_at"},
+		model: func() interface{} { return &[]models.KeyReveal{} },
+	},
+}
+
+// normalizeTimestampsAndIDs 迁移 1
+//   - time.Time 字段统一为 RFC3339,兼容早期写入的 "2006-01-02 15:04:05"、仅日期和 Unix 时间戳
+//   - 卡密的使用时间和有效期统一为 utils.TimeLayout
+//   - 缺少 ID 的记录生成 ID,缺少创建时间的记录按 ID 中的纳秒时间戳补全
+func normalizeTimestampsAndIDs(tx *Tx) error {
+	for _, f := range timestampFiles {
+		records, err := tx.LoadRecords(f.file)
+		if err != nil {
+			return err
+		}
+
+		m := &recordMigrator{tx: tx, file: f.file, ids: newIDAllocator(records)}
+		changed := false
+		for i, record := range records {
+			c, err := m.migrate(f.spec, record, fmt.Sprintf("#%d", i+1))
+			if err != nil {
+				return err
+			}
+			changed = changed || c
+		}
+
+		if changed {
+			if err := tx.SaveRecords(f.file, records, f.model()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// recordMigrator 迁移单个文件中的记录
+type recordMigrator struct {
+	tx   *Tx
+	file string
+	ids  *idAllocator
+}
+
+// migrate 迁移一条记录,position 用于记录没有 ID 时的提示
+func (m *recordMigrator) migrate(spec recordSpec, record map[string]interface{}, position string) (bool, error) {
+	changed := false
+	id, _ := record["id"].(string)
+	label := id
+	if label == "" {
+		label = position
+	}
+
+	for _, field := range spec.times {
+		c, err := m.normalizeTime(record, field, label, false)
+		if err != nil {
+			return false, err
+		}
+		changed = changed || c
+	}
+	for _, field := range spec.optional {
+		c, err := m.normalizeTime(record, field, label, true)
+		if err != nil {
+			return false, err
+		}
+		changed = changed || c
+	}
+	for _, field := range spec.strings {
+		c, err := m.normalizeString(record, field, label, contains(spec.endOfDay, field))
+		if err != nil {
+			return false, err
+		}
+		changed = changed || c
+	}
+
+	// 先按原 ID 补全时间,再为缺少 ID 的记录生成 ID
+	if spec.createdAt != "" && id != "" && isZeroTime(record[spec.createdAt]) {
+		if t, ok := timeFromID(id); ok {
+			record[spec.createdAt] = t.Format(time.RFC3339Nano)
+			m.tx.Changef(m.file, label, "%s 按 ID 补全为 %s", spec.createdAt, t.Format(utils.TimeLayout))
+			changed = true
+		}
+	}
+	if spec.idPrefix != "" && id == "" {
+		id = m.ids.next(spec.idPrefix)
+		record["id"] = id
+		m.tx.Changef(m.file, label, "补全 ID 为 %s", id)
+		changed = true
+	}
+
+	fields := make([]string, 0, len(spec.nested))
+	for field := range spec.nested {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		nestedSpec := spec.nested[field]
+		items, ok := record[field].([]interface{})
+		if !ok {
+			continue
+		}
+		for i, item := range items {
+			nested, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			c, err := m.migrate(nestedSpec, nested, fmt.Sprintf("%s.%s#%d", id, field, i+1))
+			if err != nil {
+				return false, err
+			}
+			changed = changed || c
+		}
+	}
+	return changed, nil
+}
+
+// normalizeTime 将 time.Time 字段转换为 RFC3339
+// optional 为 true 时空值改为 null,否则改为零值
+func (m *recordMigrator) normalizeTime(record map[string]interface{}, field, label string, optional bool) (bool, error) {
+	value, ok := record[field]
+	if !ok || value == nil {
+		return false, nil
+	}
+
+	if s, ok := value.(string); ok {
+		if _, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return false, nil
+		}
+		if strings.TrimSpace(s) == "" {
+			if optional {
+				delete(record, field)
+			} else {
+				record[field] = time.Time{}.Format(time.RFC3339Nano)
+			}
+			m.tx.Changef(m.file, label, "%s 为空字符串,改为空值", field)
+			return true, nil
+		}
+	}
+
+	t, _, err := parseLooseTime(value)
+	if err != nil {
+		return false, fmt.Errorf("%s %s 的 %s 无法识别: %v", m.file, label, field, value)
+	}
+	record[field] = t.Format(time.RFC3339Nano)
+	m.tx.Changef(m.file, label, "%s 由 %v 改为 %s", field, value, record[field])
+	return true, nil
+}
+
+// normalizeString 将字符串时间字段统一为 utils.TimeLayout
+// endOfDay 为 true 时仅日期视为当天结束,与卡密有效期的解析方式一致
+func (m *recordMigrator) normalizeString(record map[string]interface{}, field, label string, endOfDay bool) (bool, error) {
+	value, ok := record[field]
+	if !ok || value == nil {
+		return false, nil
+	}
+	if s, ok := value.(string); ok {
+		if s == "" {
+			return false, nil
+		}
+		if _, err := time.ParseInLocation(utils.TimeLayout, s, time.Local); err == nil {
+			return false, nil
+		}
+	}
+
+	t, dateOnly, err := parseLooseTime(value)
+	if err != nil {
+		return false, fmt.Errorf("%s %s 的 %s 无法识别: %v", m.file, label, field, value)
+	}
+	if dateOnly && endOfDay {
+		t = t.Add(24*time.Hour - time.Second)
+	}
+	record[field] = t.In(time.Local).Format(utils.TimeLayout)
+	m.tx.Changef(m.file, label, "%s 由 %v 改为 %s", field, value, record[field])
+	return true, nil
+}
+
+// 早期数据中出现过的时间格式,按本地时间解析
+var looseLayouts = []string{
+	utils.TimeLayout,
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05",
+	"2006/01/02 15:04:05",
+	"2006/01/02 15:04",
+}
+
+var looseDateLayouts = []string{
+	"2006-01-02",
+	"2006/01/02",
+}
+
+// parseLooseTime 解析字符串或数字形式的时间,数字按量级识别为秒、毫秒或纳秒
+func parseLooseTime(value interface{}) (time.Time, bool, error) {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = strings.TrimSpace(v)
+	case json.Number:
+		s = v.String()
+	default:
+		return time.Time{}, false, fmt.Errorf("不支持的类型 %T", value)
+	}
+
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return unixTime(n), false, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, false, nil
+	}
+	for _, layout := range looseLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, false, nil
+		}
+	}
+	for _, layout := range looseDateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, true, nil
+		}
+	}
+	return time.Time{}, false, fmt.Errorf("无法识别的时间: %s", s)
+}
+
+// unixTime 按数值量级转换 Unix 时间戳
+func unixTime(n int64) time.Time {
+	switch {
+	case n < 1e11:
+		return time.Unix(n, 0)
+	case n < 1e14:
+		return time.UnixMilli(n)
+	default:
+		return time.Unix(0, n)
+	}
+}
+
+// isZeroTime 字段为空或零值时间
+func isZeroTime(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	s, ok := value.(string)
+	if !ok {
+		return false
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	return err == nil && t.IsZero()
+}
+
+// idTimestamp 匹配 ID 中的纳秒时间戳,如 ORD1700000000000000000、CK1700000000000000000_1
+var idTimestamp = regexp.MustCompile(`^[A-Za-z]*(\d{19})(?:_\d+)?$`)
+
+// timeFromID 从 utils.GenerateID 或 UnixNano 生成的 ID 中取出时间
+func timeFromID(id string) (time.Time, bool) {
+	match := idTimestamp.FindStringSubmatch(id)
+	if match == nil {
+		return time.Time{}, false
+	}
+	n, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	t := time.Unix(0, n)
+	if t.Year() < 2000 || t.After(time.Now().Add(24*time.Hour)) {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// idAllocator 生成与现有记录不重复的 ID
+type idAllocator struct {
+	used map[string]bool
+	seq  int64
+}
+
+func newIDAllocator(records []map[string]interface{}) *idAllocator {
+	a := &idAllocator{used: make(map[string]bool), seq: time.Now().UnixNano()}
+	for _, record := range records {
+		if id, ok := record["id"].(string); ok {
+			a.used[id] = true
+		}
+	}
+	return a
+}
+
+// next 按程序中的格式生成 ID: 前缀 + 纳秒时间戳
+func (a *idAllocator) next(prefix string) string {
+	for {
+		a.seq++
+		id := prefix + strconv.FormatInt(a.seq, 10)
+		if !a.used[id] {
+			a.used[id] = true
+			return id
+		}
+	}
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
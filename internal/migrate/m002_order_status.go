@@ -0,0 +1,76 @@
+package migrate
+
+import (
+	"ai-hacker/internal/models"
+	"fmt"
+	"strings"
+)
+
+const ordersFile = "data/orders.json"
+
+// legacyOrderStatuses 早期版本中管理员可以填写任意订单状态,常见的写法对应到当前的状态
+var legacyOrderStatuses = map[string]string{
+	"":           models.OrderStatusCompleted, // 早期订单创建即完成
+	"完成":         models.OrderStatusCompleted,
+	"已支付":        models.OrderStatusCompleted,
+	"已付款":        models.OrderStatusCompleted,
+	"已发货":        models.OrderStatusCompleted,
+	"paid":       models.OrderStatusCompleted,
+	"success":    models.OrderStatusCompleted,
+	"completed":  models.OrderStatusCompleted,
+	"待处理":        models.OrderStatusPending,
+	"待支付":        models.OrderStatusPending,
+	"未支付":        models.OrderStatusPending,
+	"pending":    models.OrderStatusPending,
+	"processing": models.OrderStatusPending,
+	"退款":         models.OrderStatusRefunded,
+	"refunded":   models.OrderStatusRefunded,
+	"取消":         models.OrderStatusCancelled,
+	"cancelled":  models.OrderStatusCancelled,
+	"canceled":   models.OrderStatusCancelled,
+}
+
+// currentOrderStatuses 当前版本的订单状态
+var currentOrderStatuses = map[string]bool{
+	models.OrderStatusPending:         true,
+	models.OrderStatusCompleted:       true,
+	models.OrderStatusPartialRefunded: true,
+	models.OrderStatusRefunded:        true,
+	models.OrderStatusCancelled:       true,
+}
+
+// normalizeOrderStatuses 迁移 2
+// 将早期填写的订单状态统一为当前的状态,否则这些订单无法再修改、退款或取消。
+// 无法识别的状态保持不变并在结果中列出,由管理员在后台修改。
+func normalizeOrderStatuses(tx *Tx) error {
+	records, err := tx.LoadRecords(ordersFile)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for i, record := range records {
+		label, _ := record["id"].(string)
+		if label == "" {
+			label = fmt.Sprintf("#%d", i+1)
+		}
+
+		status, _ := record["status"].(string)
+		if currentOrderStatuses[status] {
+			continue
+		}
+		normalized, ok := legacyOrderStatuses[strings.ToLower(strings.TrimSpace(status))]
+		if !ok {
+			tx.Changef(ordersFile, label, "无法识别的订单状态 %q,保持不变", status)
+			continue
+		}
+		record["status"] = normalized
+		tx.Changef(ordersFile, label, "status 由 %q 改为 %s", status, normalized)
+		changed = true
+	}
+
+	if changed {
+		return tx.SaveRecords(ordersFile, records, &[]models.Order{})
+	}
+	return nil
+}
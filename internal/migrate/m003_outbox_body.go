@@ -0,0 +1,46 @@
+package migrate
+
+import (
+	"ai-hacker/internal/models"
+	"fmt"
+)
+
+const outboxFile = "data/outbox.json"
+
+// clearOutboxBodies 迁移 3
+// 发货邮件的正文包含卡密和下载链接,早期版本在发送后仍保留在队列文件和备份中。
+// 清除已发送邮件和已停止重试的发货邮件的正文,发货邮件重试时会按订单重新生成。
+func clearOutboxBodies(tx *Tx) error {
+	records, err := tx.LoadRecords(outboxFile)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for i, record := range records {
+		status, _ := record["status"].(string)
+		msgType, _ := record["type"].(string)
+		if status != models.OutboxStatusSent && !(status == models.OutboxStatusDead && msgType == models.OutboxTypeOrder) {
+			continue
+		}
+		body, _ := record["body"].(string)
+		text, _ := record["text"].(string)
+		if body == "" && text == "" {
+			continue
+		}
+
+		label, _ := record["id"].(string)
+		if label == "" {
+			label = fmt.Sprintf("#%d", i+1)
+		}
+		delete(record, "body")
+		delete(record, "text")
+		tx.Changef(outboxFile, label, "清除邮件正文 (状态 %s)", status)
+		changed = true
+	}
+
+	if changed {
+		return tx.SaveRecords(outboxFile, records, &[]models.OutboxMessage{})
+	}
+	return nil
+}
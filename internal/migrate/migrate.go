@@ -0,0 +1,252 @@
+// Package migrate 管理数据目录的结构版本和数据迁移
+//
+// 数据目录中的 schema_version.json 记录当前版本,迁移按版本号顺序执行,
+// 每个迁移完成后更新版本。迁移需要可以重复执行: 中途失败时部分文件
+// 可能已经写入,再次执行应得到相同的结果。
+package migrate
+
+import (
+	"ai-hacker/internal/utils"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// VersionFile 数据结构版本文件
+const VersionFile = "data/schema_version.json"
+
+// Migration 单个数据迁移
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *Tx) error
+}
+
+// migrations 所有迁移,按版本号排序
+var migrations = []Migration{
+	{Version: 1, Name: "统一时间格式并补全 ID", Up: normalizeTimestampsAndIDs},
+	{Version: 2, Name: "统一订单状态", Up: normalizeOrderStatuses},
+	{Version: 3, Name: "清除已发送邮件的正文", Up: clearOutboxBodies},
+}
+
+// Applied 已执行的迁移记录
+type Applied struct {
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	Changes   int       `json:"changes"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// State 数据目录的版本状态
+type State struct {
+	Version int       `json:"version"`
+	History []Applied `json:"history"`
+}
+
+// Change 迁移对数据的一处修改
+type Change struct {
+	File    string `json:"file"`
+	ID      string `json:"id"`
+	Message string `json:"message"`
+}
+
+// Result 单个迁移的执行结果
+type Result struct {
+	Version int      `json:"version"`
+	Name    string   `json:"name"`
+	Changes []Change `json:"changes"`
+}
+
+// Latest 程序支持的最新数据版本
+func Latest() int {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// LoadState 读取数据目录的版本状态,文件不存在时为版本 0
+func LoadState() (State, error) {
+	state := State{History: []Applied{}}
+	if _, err := os.Stat(VersionFile); os.IsNotExist(err) {
+		return state, nil
+	}
+	if err := utils.LoadFromFile(VersionFile, &state); err != nil {
+		return state, fmt.Errorf("读取 %s 失败: %v", VersionFile, err)
+	}
+	return state, nil
+}
+
+// Pending 返回尚未执行的迁移
+// 数据版本高于程序支持的版本时返回错误,避免旧程序改写新格式的数据
+func Pending() ([]Migration, State, error) {
+	state, err := LoadState()
+	if err != nil {
+		return nil, state, err
+	}
+	if state.Version > Latest() {
+		return nil, state, fmt.Errorf("数据版本 %d 高于程序支持的版本 %d,请升级程序", state.Version, Latest())
+	}
+
+	pending := []Migration{}
+	for _, m := range migrations {
+		if m.Version > state.Version {
+			pending = append(pending, m)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Version < pending[j].Version })
+	return pending, state, nil
+}
+
+// Plan 试运行所有待执行的迁移,不写入任何文件
+// 后面的迁移看到的是前面迁移修改后的数据
+func Plan() ([]Result, error) {
+	pending, _, err := Pending()
+	if err != nil {
+		return nil, err
+	}
+
+	tx := newTx(true)
+	results := []Result{}
+	for _, m := range pending {
+		result, err := tx.run(m)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// Apply 依次执行待执行的迁移,每个迁移完成后更新版本文件
+// 需要在服务停止或启动前执行
+func Apply() ([]Result, error) {
+	pending, state, err := Pending()
+	if err != nil {
+		return nil, err
+	}
+
+	results := []Result{}
+	for _, m := range pending {
+		tx := newTx(false)
+		result, err := tx.run(m)
+		if err != nil {
+			return results, err
+		}
+		if err := tx.commit(); err != nil {
+			return results, fmt.Errorf("迁移 %d 写入失败: %v", m.Version, err)
+		}
+
+		state.Version = m.Version
+		state.History = append(state.History, Applied{
+			Version:   m.Version,
+			Name:      m.Name,
+			Changes:   len(result.Changes),
+			AppliedAt: time.Now(),
+		})
+		if err := utils.SaveToFile(VersionFile, state); err != nil {
+			return results, fmt.Errorf("更新 %s 失败: %v", VersionFile, err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// Tx 一次迁移的数据读写
+// 写入先保存在内存中,迁移成功后统一写入文件,试运行时不写入
+type Tx struct {
+	dryRun  bool
+	files   map[string][]byte
+	order   []string
+	changes []Change
+}
+
+func newTx(dryRun bool) *Tx {
+	return &Tx{dryRun: dryRun, files: make(map[string][]byte)}
+}
+
+// run 执行迁移并收集修改
+func (tx *Tx) run(m Migration) (Result, error) {
+	tx.changes = []Change{}
+	if err := m.Up(tx); err != nil {
+		return Result{}, fmt.Errorf("迁移 %d (%s) 失败: %v", m.Version, m.Name, err)
+	}
+	return Result{Version: m.Version, Name: m.Name, Changes: tx.changes}, nil
+}
+
+// commit 将迁移写入的文件保存到数据目录
+func (tx *Tx) commit() error {
+	if tx.dryRun {
+		return nil
+	}
+	defer utils.BeginDataWrite()()
+	for _, file := range tx.order {
+		if err := os.WriteFile(file, tx.files[file], 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Changef 记录一处修改
+func (tx *Tx) Changef(file, id, format string, args ...interface{}) {
+	tx.changes = append(tx.changes, Change{File: file, ID: id, Message: fmt.Sprintf(format, args...)})
+}
+
+// read 读取文件内容,优先返回本次迁移已写入的内容
+// 文件不存在时返回 nil
+func (tx *Tx) read(file string) ([]byte, error) {
+	if data, ok := tx.files[file]; ok {
+		return data, nil
+	}
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// LoadRecords 以通用结构读取 JSON 数组文件,不依赖当前的模型定义
+// 数字保持原样,文件不存在时返回空列表
+func (tx *Tx) LoadRecords(file string) ([]map[string]interface{}, error) {
+	data, err := tx.read(file)
+	if err != nil {
+		return nil, err
+	}
+	records := []map[string]interface{}{}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return records, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&records); err != nil {
+		return nil, fmt.Errorf("%s 无法解析: %v", file, err)
+	}
+	return records, nil
+}
+
+// SaveRecords 将记录按模型 v 重新编码后写入,v 为指向模型切片的指针
+// 经过模型编码可以确认迁移后的数据能被程序读取,字段顺序也与程序写入的一致
+func (tx *Tx) SaveRecords(file string, records []map[string]interface{}, v interface{}) error {
+	data, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s 迁移后仍无法按当前结构读取: %v", file, err)
+	}
+	data, err = json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if _, ok := tx.files[file]; !ok {
+		tx.order = append(tx.order, file)
+	}
+	tx.files[file] = data
+	return nil
+}
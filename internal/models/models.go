@@ -2,42 +2,322 @@ package models
 
 import "time"
 
+// SoftDelete 软删除标记,嵌入到支持回收站的模型中
+type SoftDelete struct {
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy string     `json:"deleted_by,omitempty"`
+}
+
+// IsDeleted 是否已删除
+func (s *SoftDelete) IsDeleted() bool {
+	return s.DeletedAt != nil
+}
+
+// MarkDeleted 标记为已删除
+func (s *SoftDelete) MarkDeleted(operator string, at time.Time) {
+	s.DeletedAt = &at
+	s.DeletedBy = operator
+}
+
+// Restore 从回收站恢复
+func (s *SoftDelete) Restore() {
+	s.DeletedAt = nil
+	s.DeletedBy = ""
+}
+
+// SoftDeleteInfo 返回软删除标记,供回收站通用逻辑使用
+func (s *SoftDelete) SoftDeleteInfo() *SoftDelete {
+	return s
+}
+
 // Product 商品结构
 type Product struct {
-	ID          string  `json:"id"`
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
-	Stock       int     `json:"stock"`
+	ID                string     `json:"id"`
+	Name              string     `json:"name"`
+	Description       string     `json:"description"`
+	Price             float64    `json:"price"`
+	Stock             int        `json:"stock"`
+	DeliveryTemplate  string     `json:"delivery_template"`    // 发货说明模板,支持 {order_id} {card_key} {product_name} {date}
+	KeyFields         []KeyField `json:"key_fields,omitempty"` // 结构化卡密字段定义,为空时卡密为单行文本
+	MaxDownloads      int        `json:"max_downloads"`        // 文件类卡密每个订单的最大下载次数,0 表示不限
+	LowStockThreshold int        `json:"low_stock_threshold"`  // 库存低于该值时告警,0 表示不告警
+	SoftDelete
 }
 
-// Order 订单结构
-type Order struct {
+// KeyField 卡密字段定义
+type KeyField struct {
+	Name  string `json:"name"`  // 字段标识,如 account
+	Label string `json:"label"` // 展示名称,如 账号
+}
+
+// 订单状态
+const (
+	OrderStatusPending         = "处理中"
+	OrderStatusCompleted       = "已完成"
+	OrderStatusPartialRefunded = "部分退款"
+	OrderStatusRefunded        = "已退款"
+	OrderStatusCancelled       = "已取消"
+)
+
+// 退款时卡密的处理方式
+const (
+	KeyActionKeep    = "keep"    // 保留,用户可继续使用
+	KeyActionRestock = "restock" // 退回库存重新销售
+	KeyActionVoid    = "void"    // 作废
+)
+
+// OrderRefund 退款或取消记录
+type OrderRefund struct {
 	ID          string    `json:"id"`
-	ProductName string    `json:"product_name"`
-	Email       string    `json:"email"`
+	Type        string    `json:"type"` // refund:退款 cancel:取消
 	Amount      float64   `json:"amount"`
-	Status      string    `json:"status"`
-	CardKey     string    `json:"card_key"`
+	Reason      string    `json:"reason"`
+	Operator    string    `json:"operator"`
+	KeyAction   string    `json:"key_action"`
+	ProviderRef string    `json:"provider_ref,omitempty"` // 支付渠道退款单号
 	CreatedAt   time.Time `json:"created_at"`
 }
 
+// KeyReplacement 售后换卡记录
+type KeyReplacement struct {
+	OldCardKeyID string    `json:"old_card_key_id"`
+	OldKey       string    `json:"old_key"`
+	NewCardKeyID string    `json:"new_card_key_id"`
+	NewKey       string    `json:"new_key"`
+	Reason       string    `json:"reason"`
+	Operator     string    `json:"operator"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// KeyFieldValue 带标签的卡密字段值,用于邮件和订单展示
+type KeyFieldValue struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// Order 订单结构
+type Order struct {
+	ID             string           `json:"id"`
+	ProductID      string           `json:"product_id,omitempty"`
+	ProductName    string           `json:"product_name"`
+	Email          string           `json:"email"`
+	Amount         float64          `json:"amount"`
+	Status         string           `json:"status"`
+	CardKey        string           `json:"card_key"`
+	CardKeyID      string           `json:"card_key_id,omitempty"`
+	CardKeyFields  []KeyFieldValue  `json:"card_key_fields,omitempty"` // 结构化卡密的各字段
+	Instructions   string           `json:"instructions,omitempty"`    // 下单时渲染的发货说明
+	FileID         string           `json:"file_id,omitempty"`         // 文件类卡密对应的文件
+	DownloadCount  int              `json:"download_count,omitempty"`  // 文件已下载次数
+	DownloadURL    string           `json:"download_url,omitempty"`    // 查询时生成的限时下载链接,不持久化
+	Replacements   []KeyReplacement `json:"replacements,omitempty"`    // 售后换卡记录
+	PaymentMethod  string           `json:"payment_method,omitempty"`  // 支付渠道,为空表示无在线支付
+	RefundedAmount float64          `json:"refunded_amount,omitempty"` // 累计退款金额
+	Refunds        []OrderRefund    `json:"refunds,omitempty"`         // 退款和取消记录
+	CreatedAt      time.Time        `json:"created_at"`
+	SoftDelete
+}
+
 // User 用户结构
 type User struct {
-	ID       string `json:"id"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
-	Role     int    `json:"role"` // 1:普通用户 2:管理员 3:超级管理员
+	ID        string    `json:"id"`
+	Email     string    `json:"email"`
+	Password  string    `json:"password"`
+	Role      int       `json:"role"` // 1:普通用户 2:管理员 3:超级管理员
+	CreatedAt time.Time `json:"created_at"`
+	SoftDelete
 }
 
 // CardKey 卡密结构
 type CardKey struct {
-	ID        string `json:"id"`
-	ProductID string `json:"product_id"`
-	Key       string `json:"key"`
-	Status    string `json:"status"` // unused:未使用 used:已使用
-	OrderID   string `json:"order_id,omitempty"`
-	UsedAt    string `json:"used_at,omitempty"`
+	ID        string            `json:"id"`
+	ProductID string            `json:"product_id"`
+	Key       string            `json:"key"`
+	Fields    map[string]string `json:"fields,omitempty"`  // 结构化卡密字段值,键为 KeyField.Name
+	FileID    string            `json:"file_id,omitempty"` // 文件类卡密对应的文件,Key 为文件名
+	Status    string            `json:"status"`            // unused:未使用 used:已使用 expired:已过期 defective:已失效 void:已作废
+	OrderID   string            `json:"order_id,omitempty"`
+	UsedAt    string            `json:"used_at,omitempty"`
+	ExpiresAt string            `json:"expires_at,omitempty"` // 供应商有效期,为空表示长期有效
+	SoftDelete
+}
+
+// DeliveryFile 文件类卡密的文件信息
+// 文件内容私有存储在 data/files 目录,仅能通过签名链接下载
+type DeliveryFile struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ExpiryReport 卡密过期处理报告
+type ExpiryReport struct {
+	ID           string              `json:"id"`
+	RunAt        time.Time           `json:"run_at"`
+	ExpiredCount int                 `json:"expired_count"`
+	LostValue    float64             `json:"lost_value"` // 按商品售价计算的库存损失
+	Products     []ExpiryProductLoss `json:"products"`
+}
+
+// ExpiryProductLoss 单个商品的过期损失
+type ExpiryProductLoss struct {
+	ProductID   string  `json:"product_id"`
+	ProductName string  `json:"product_name"`
+	Count       int     `json:"count"`
+	Value       float64 `json:"value"`
+}
+
+// StockSubscription 到货通知订阅
+type StockSubscription struct {
+	ID         string     `json:"id"`
+	ProductID  string     `json:"product_id"`
+	Email      string     `json:"email"`
+	CreatedAt  time.Time  `json:"created_at"`
+	NotifiedAt *time.Time `json:"notified_at,omitempty"` // 已发送到货通知的时间,为空表示待通知
+}
+
+// KeyReveal 卡密明文查看记录
+type KeyReveal struct {
+	ID        string    `json:"id"`
+	CardKeyID string    `json:"card_key_id"`
+	ProductID string    `json:"product_id"`
+	Operator  string    `json:"operator"`
+	Reason    string    `json:"reason"`
+	Blocked   bool      `json:"blocked"` // 超出每日配额被拒绝
+	CreatedAt time.Time `json:"created_at"`
+	// 明文导出时一次记录导出的全部卡密,CardKeyID 为空
+	CardKeyIDs []string `json:"card_key_ids,omitempty"`
+}
+
+// KeyCount 本次查看的卡密数量,计入每日配额
+func (r *KeyReveal) KeyCount() int {
+	if len(r.CardKeyIDs) > 0 {
+		return len(r.CardKeyIDs)
+	}
+	return 1
+}
+
+// 邮件发送队列状态
+const (
+	OutboxStatusPending = "pending" // 等待发送或等待重试
+	OutboxStatusSending = "sending" // 发送中
+	OutboxStatusSent    = "sent"    // 已发送
+	OutboxStatusDead    = "dead"    // 多次重试失败,需要管理员处理
+)
+
+// 邮件类型
+const (
+	OutboxTypeOrder   = "order"   // 订单发货
+	OutboxTypeRestock = "restock" // 到货通知
+	OutboxTypeAlert   = "alert"   // 管理员告警
+)
+
+// OutboxMessage 邮件发送队列中的邮件
+// 邮件内容在加入队列时生成,发送失败按指数退避重试
+type OutboxMessage struct {
+	ID            string     `json:"id"`
+	Type          string     `json:"type"`
+	To            string     `json:"to"`
+	Subject       string     `json:"subject"`
+	Body          string     `json:"body,omitempty"`
+	Text          string     `json:"text,omitempty"` // 纯文本内容
+	OrderID       string     `json:"order_id,omitempty"`
+	UserID        string     `json:"user_id,omitempty"` // 收件人对应的用户
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error,omitempty"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+}
+
+// 邮件发送日志状态
+const (
+	EmailLogStatusQueued   = "queued"   // 已加入发送队列
+	EmailLogStatusSent     = "sent"     // 发送成功
+	EmailLogStatusRetrying = "retrying" // 发送失败,等待重试
+	EmailLogStatusFailed   = "failed"   // 发送失败,不再重试
+)
+
+// EmailLog 邮件发送日志,每封邮件一条,记录最后一次发送的结果
+// 经过发送队列的邮件与队列中的邮件 ID 相同
+type EmailLog struct {
+	ID        string     `json:"id"`
+	Type      string     `json:"type"` // 邮件模板,如 order、reset_password
+	To        string     `json:"to"`
+	Subject   string     `json:"subject"`
+	OrderID   string     `json:"order_id,omitempty"`
+	UserID    string     `json:"user_id,omitempty"`
+	Status    string     `json:"status"`
+	Transport string     `json:"transport,omitempty"`
+	Attempts  int        `json:"attempts"`
+	Response  string     `json:"response,omitempty"` // 服务器接收邮件后的响应
+	Error     string     `json:"error,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	AttemptAt *time.Time `json:"attempt_at,omitempty"` // 最后一次发送时间
+	SentAt    *time.Time `json:"sent_at,omitempty"`
+}
+
+// Webhook 事件
+const (
+	WebhookEventOrderCreated    = "order.created"
+	WebhookEventOrderPaid       = "order.paid"
+	WebhookEventOrderRefunded   = "order.refunded"
+	WebhookEventStockLow        = "stock.low"
+	WebhookEventUserRegistered  = "user.registered"
+	WebhookEventCardKeyImported = "cardkey.imported"
+	WebhookEventPing            = "ping" // 测试推送,发给指定的订阅,不需要订阅
+)
+
+// Webhook 推送状态
+const (
+	WebhookDeliveryPending   = "pending"   // 等待推送或等待重试
+	WebhookDeliverySending   = "sending"   // 正在推送
+	WebhookDeliveryDelivered = "delivered" // 接收方返回 2xx
+	WebhookDeliveryDead      = "dead"      // 多次失败后停止重试
+)
+
+// Webhook 事件订阅
+type Webhook struct {
+	ID          string    `json:"id"`
+	URL         string    `json:"url"`
+	Events      []string  `json:"events"`
+	Secret      string    `json:"secret,omitempty"` // 签名密钥,列表中不返回
+	Description string    `json:"description,omitempty"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// WebhookDelivery 一次事件推送,同时作为推送队列和推送记录
+// 推送内容在事件发生时生成,重试和重新推送使用相同的内容
+type WebhookDelivery struct {
+	ID            string           `json:"id"`
+	WebhookID     string           `json:"webhook_id"`
+	URL           string           `json:"url"`
+	Event         string           `json:"event"`
+	EventID       string           `json:"event_id"`
+	Payload       string           `json:"payload,omitempty"`
+	Status        string           `json:"status"`
+	Attempts      []WebhookAttempt `json:"attempts,omitempty"`
+	RedeliveryOf  string           `json:"redelivery_of,omitempty"` // 手动重新推送时为原推送的 ID
+	NextAttemptAt time.Time        `json:"next_attempt_at"`
+	CreatedAt     time.Time        `json:"created_at"`
+	UpdatedAt     time.Time        `json:"updated_at"`
+	DeliveredAt   *time.Time       `json:"delivered_at,omitempty"`
+}
+
+// WebhookAttempt 一次推送尝试的结果
+type WebhookAttempt struct {
+	At           time.Time `json:"at"`
+	StatusCode   int       `json:"status_code,omitempty"`
+	ResponseBody string    `json:"response_body,omitempty"` // 截断后的响应内容
+	Error        string    `json:"error,omitempty"`
+	DurationMs   int64     `json:"duration_ms"`
 }
 
 // Role 角色结构
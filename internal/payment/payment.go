@@ -0,0 +1,35 @@
+package payment
+
+import (
+	"ai-hacker/internal/models"
+	"sync"
+)
+
+// Provider 支付渠道
+// 接入在线支付时实现该接口并调用 Register 注册
+type Provider interface {
+	// Name 渠道标识,与 Order.PaymentMethod 对应
+	Name() string
+	// Refund 发起退款,返回渠道退款单号
+	Refund(order models.Order, amount float64, reason string) (string, error)
+}
+
+var (
+	providers = make(map[string]Provider)
+	mu        sync.RWMutex
+)
+
+// Register 注册支付渠道
+func Register(p Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	providers[p.Name()] = p
+}
+
+// Get 获取支付渠道
+func Get(name string) (Provider, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	p, ok := providers[name]
+	return p, ok
+}
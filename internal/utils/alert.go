@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"ai-hacker/internal/models"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const usersFile = "data/users.json"
+
+// getAdminEmails 获取所有管理员邮箱（role >= 2）
+func getAdminEmails() []string {
+	var users []models.User
+	LoadFromFile(usersFile, &users)
+
+	var emails []string
+	for _, u := range users {
+		if u.Role >= 2 && !u.IsDeleted() {
+			emails = append(emails, u.Email)
+		}
+	}
+	return emails
+}
+
+// userIDByEmail 按邮箱查找用户 ID,不是注册用户时返回空
+func userIDByEmail(email string) string {
+	var users []models.User
+	LoadFromFile(usersFile, &users)
+
+	for _, u := range users {
+		if u.Email == email && !u.IsDeleted() {
+			return u.ID
+		}
+	}
+	return ""
+}
+
+// emailNotifier 将告警邮件加入发送队列发给所有管理员
+type emailNotifier struct{}
+
+func (emailNotifier) Notify(n Notification) error {
+	var lastErr error
+	for _, email := range getAdminEmails() {
+		data := NewEmailData(email)
+		data.Subject = n.Subject
+		data.Message = n.Message
+		rendered, err := RenderEmail(EmailTemplateAlert, data)
+		if err == nil {
+			_, err = EnqueueEmail(models.OutboxMessage{
+				Type:    models.OutboxTypeAlert,
+				To:      email,
+				Subject: rendered.Subject,
+				Body:    rendered.HTML,
+				Text:    rendered.Text,
+			})
+		}
+		if err != nil {
+			lastErr = fmt.Errorf("告警邮件加入发送队列失败: %v", err)
+		}
+	}
+	return lastErr
+}
+
+// webhookNotifier 推送告警到告警 Webhook 地址
+type webhookNotifier struct {
+	url string
+}
+
+func (w webhookNotifier) Notify(n Notification) error {
+	return postAlertWebhook(w.url, n.Event, n.Message, n.Payload)
+}
+
+// postAlertWebhook 推送告警到 Webhook
+func postAlertWebhook(url, event, message string, payload map[string]interface{}) error {
+	data := map[string]interface{}{
+		"event":   event,
+		"message": message,
+		"time":    time.Now().Format(time.RFC3339),
+	}
+	for k, v := range payload {
+		data[k] = v
+	}
+
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Webhook 返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// QueueRestockEmail 将到货通知邮件加入发送队列
+func QueueRestockEmail(to, productName string) error {
+	data := NewEmailData(to)
+	data.ProductName = productName
+
+	email, err := RenderEmail(EmailTemplateRestock, data)
+	if err != nil {
+		return err
+	}
+	_, err = EnqueueEmail(models.OutboxMessage{
+		Type:    models.OutboxTypeRestock,
+		To:      to,
+		Subject: email.Subject,
+		Body:    email.HTML,
+		Text:    email.Text,
+	})
+	return err
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"context"
+	"sync"
+)
+
+// background 后台任务,关闭服务时等待完成
+var background sync.WaitGroup
+
+// Go 在后台执行 fn,用于发送邮件、告警和定时任务
+// 与直接使用 go 不同,关闭服务时会等待这些任务完成,不会丢失已触发的邮件
+func Go(fn func()) {
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		fn()
+	}()
+}
+
+// WaitBackground 等待后台任务完成,ctx 结束时返回 ctx 的错误
+// 定时任务需要先通过取消其 ctx 退出
+func WaitBackground(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"ai-hacker/internal/models"
+	"strings"
+)
+
+// CardKeyFieldValues 按商品字段定义整理卡密字段值,保持定义中的顺序
+func CardKeyFieldValues(fields []models.KeyField, values map[string]string) []models.KeyFieldValue {
+	if len(fields) == 0 || len(values) == 0 {
+		return nil
+	}
+
+	var result []models.KeyFieldValue
+	for _, f := range fields {
+		value, ok := values[f.Name]
+		if !ok {
+			continue
+		}
+		label := f.Label
+		if label == "" {
+			label = f.Name
+		}
+		result = append(result, models.KeyFieldValue{Label: label, Value: value})
+	}
+	return result
+}
+
+// JoinCardKeyFields 将结构化卡密拼接为单行文本
+// 用于兼容只展示单个卡密字符串的地方
+func JoinCardKeyFields(values []models.KeyFieldValue) string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		parts = append(parts, v.Label+": "+v.Value)
+	}
+	return strings.Join(parts, " | ")
+}
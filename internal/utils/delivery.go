@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"html"
+	"strings"
+	"time"
+)
+
+// DeliveryVars 发货说明模板变量
+type DeliveryVars struct {
+	OrderID     string
+	CardKey     string
+	ProductName string
+	Date        time.Time
+}
+
+// DeliveryPlaceholders 发货说明模板支持的占位符
+var DeliveryPlaceholders = map[string]string{
+	"{order_id}":     "订单号",
+	"{card_key}":     "卡密",
+	"{product_name}": "商品名称",
+	"{date}":         "购买日期",
+}
+
+// RenderDeliveryTemplate 渲染发货说明模板
+func RenderDeliveryTemplate(tpl string, vars DeliveryVars) string {
+	if tpl == "" {
+		return ""
+	}
+
+	replacer := strings.NewReplacer(
+		"{order_id}", vars.OrderID,
+		"{card_key}", vars.CardKey,
+		"{product_name}", vars.ProductName,
+		"{date}", vars.Date.Format("2006-01-02 15:04:05"),
+	)
+	return replacer.Replace(tpl)
+}
+
+// DeliveryInstructionsHTML 将发货说明转换为邮件中可安全展示的 HTML
+func DeliveryInstructionsHTML(instructions string) string {
+	if instructions == "" {
+		return ""
+	}
+	escaped := html.EscapeString(instructions)
+	return strings.ReplaceAll(escaped, "\n", "<br>")
+}
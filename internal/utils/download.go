@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"ai-hacker/internal/config"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DownloadLinkTTL 文件下载链接有效期
+const DownloadLinkTTL = 24 * time.Hour
+
+// downloadSecretFile 未配置签名密钥时自动生成的密钥文件,随数据目录一起备份
+const downloadSecretFile = "data/download_secret"
+
+var (
+	downloadSecretOnce sync.Once
+	downloadSecretKey  []byte
+)
+
+// downloadSecret 下载链接的签名密钥
+// 优先使用配置 security.download_secret 或环境变量 DOWNLOAD_SECRET,
+// 否则读取 data/download_secret,文件不存在时生成随机密钥并保存
+func downloadSecret() []byte {
+	downloadSecretOnce.Do(func() {
+		if secret := config.GetConfig().Security.DownloadSecret; secret != "" {
+			downloadSecretKey = []byte(secret)
+			return
+		}
+
+		if data, err := os.ReadFile(downloadSecretFile); err == nil && len(bytes.TrimSpace(data)) > 0 {
+			downloadSecretKey = bytes.TrimSpace(data)
+			return
+		}
+
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			log.Fatalf("生成下载链接签名密钥失败: %v", err)
+		}
+		downloadSecretKey = []byte(hex.EncodeToString(buf))
+		if err := os.WriteFile(downloadSecretFile, downloadSecretKey, 0600); err != nil {
+			log.Printf("保存下载链接签名密钥失败,重启后已发出的下载链接将失效: %v", err)
+		}
+	})
+	return downloadSecretKey
+}
+
+// signDownload 计算下载链接签名
+func signDownload(orderID string, expires int64) string {
+	mac := hmac.New(sha256.New, downloadSecret())
+	mac.Write([]byte("download:" + orderID + ":" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// DownloadURL 生成订单文件的限时签名下载链接
+func DownloadURL(orderID string) string {
+	expires := time.Now().Add(DownloadLinkTTL).Unix()
+	cfg := config.GetConfig()
+	return fmt.Sprintf("%s/api/downloads/%s?expires=%d&sig=%s",
+		cfg.Server.Domain, orderID, expires, signDownload(orderID, expires))
+}
+
+// VerifyDownload 校验下载链接签名和有效期
+func VerifyDownload(orderID, expiresStr, sig string) bool {
+	expires, err := strconv.ParseInt(expiresStr, 10, 64)
+	if err != nil {
+		return false
+	}
+	if time.Now().Unix() > expires {
+		return false
+	}
+	expected := signDownload(orderID, expires)
+	return hmac.Equal([]byte(expected), []byte(sig))
+}
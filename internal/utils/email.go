@@ -6,8 +6,6 @@ import (
 	"fmt"
 	"log"
 	"strconv"
-
-	"gopkg.in/gomail.v2"
 )
 
 const settingsFile = "data/settings.json"
@@ -23,28 +21,50 @@ func getEmailConfig() config.EmailConfig {
 		settingsMap[s.Key] = s.Value
 	}
 	
-	// 如果数据库中有配置,使用数据库配置
+	// 配置文件中的配置,数据库中有配置时覆盖
+	emailCfg := config.GetConfig().Email
+
+	// 如果数据库中有 SMTP 配置,使用数据库配置
 	if settingsMap["smtp_host"] != "" {
 		port, _ := strconv.Atoi(settingsMap["smtp_port"])
 		if port == 0 {
 			port = 587
 		}
-		return config.EmailConfig{
-			SMTPHost: settingsMap["smtp_host"],
-			SMTPPort: port,
-			Username: settingsMap["smtp_username"],
-			Password: settingsMap["smtp_password"],
-			From:     settingsMap["smtp_from"],
+		emailCfg.SMTPHost = settingsMap["smtp_host"]
+		emailCfg.SMTPPort = port
+		emailCfg.Username = settingsMap["smtp_username"]
+		emailCfg.Password = settingsMap["smtp_password"]
+		emailCfg.From = settingsMap["smtp_from"]
+	}
+
+	// 发送方式等其他配置逐项覆盖
+	override := func(field *string, key string) {
+		if settingsMap[key] != "" {
+			*field = settingsMap[key]
 		}
 	}
-	
-	// 否则使用配置文件中的配置
-	cfg := config.GetConfig()
-	return cfg.Email
+	override(&emailCfg.Transport, "mail_transport")
+	override(&emailCfg.Security, "smtp_security")
+	override(&emailCfg.From, "smtp_from")
+	override(&emailCfg.FilePath, "mail_file_path")
+	override(&emailCfg.APIProvider, "mail_api_provider")
+	override(&emailCfg.APIKey, "mail_api_key")
+	override(&emailCfg.APIBaseURL, "mail_api_base_url")
+	override(&emailCfg.APIDomain, "mail_api_domain")
+
+	return emailCfg
 }
 
 // isEmailConfigured 检查邮件是否已配置
 func isEmailConfigured(emailCfg config.EmailConfig) bool {
+	switch emailCfg.Transport {
+	case MailTransportFile:
+		return true
+	case MailTransportHTTP:
+		return emailCfg.APIKey != "" && emailCfg.From != "" &&
+			(emailCfg.APIProvider == MailProviderSendGrid ||
+				emailCfg.APIProvider == MailProviderMailgun && emailCfg.APIDomain != "")
+	}
 	return emailCfg.SMTPHost != "" &&
 		emailCfg.SMTPHost != "smtp.example.com" &&
 		emailCfg.Username != "" &&
@@ -53,102 +73,118 @@ func isEmailConfigured(emailCfg config.EmailConfig) bool {
 		emailCfg.Password != "your-password"
 }
 
-// SendEmail 发送邮件
-func SendEmail(to, subject, body string) error {
+// EmailConfigured 邮件服务是否已配置
+func EmailConfigured() bool {
+	return isEmailConfigured(getEmailConfig())
+}
+
+// EmailTransport 当前使用的发送方式
+func EmailTransport() string {
+	if transport := getEmailConfig().Transport; transport != "" {
+		return transport
+	}
+	return MailTransportSMTP
+}
+
+// SendMail 不经过发送队列直接发送邮件并记录发送日志,返回服务器的响应
+// 邮件服务未配置时返回 ErrEmailNotConfigured
+func SendMail(msg MailMessage) (string, error) {
+	response, transport, err := sendMail(msg)
+
+	status := models.EmailLogStatusSent
+	if err != nil {
+		status = models.EmailLogStatusFailed
+	}
+	updateEmailLog("L"+GenerateID(), func(l *models.EmailLog) {
+		l.Type = msg.Type
+		l.To = msg.To
+		l.Subject = msg.Subject
+		l.OrderID = msg.OrderID
+		l.UserID = msg.UserID
+		setEmailAttempt(l, status, transport, response, err, 1)
+	})
+
+	return response, err
+}
+
+// sendMail 使用当前配置的发送方式发送邮件,返回服务器的响应和发送方式
+func sendMail(msg MailMessage) (string, string, error) {
 	emailCfg := getEmailConfig()
+	transport := emailCfg.Transport
+	if transport == "" {
+		transport = MailTransportSMTP
+	}
 
-	// 检查邮件是否已配置
-	if !isEmailConfigured(emailCfg) {
-		log.Printf("警告: 邮件未配置,跳过发送邮件到 %s", to)
-		log.Println("请在后台系统设置中配置邮件服务器信息")
-		return nil // 返回 nil 避免阻塞业务流程
+	mailer, err := NewMailer(emailCfg)
+	if err != nil {
+		return "", transport, err
 	}
 
-	m := gomail.NewMessage()
-	m.SetHeader("From", emailCfg.From)
-	m.SetHeader("To", to)
-	m.SetHeader("Subject", subject)
-	m.SetBody("text/html", body)
-
-	d := gomail.NewDialer(
-		emailCfg.SMTPHost,
-		emailCfg.SMTPPort,
-		emailCfg.Username,
-		emailCfg.Password,
-	)
-
-	if err := d.DialAndSend(m); err != nil {
-		return fmt.Errorf("发送邮件失败: %v", err)
+	if msg.From == "" {
+		msg.From = emailCfg.From
+	}
+	response, err := mailer.Send(msg)
+	if err != nil {
+		return response, transport, fmt.Errorf("发送邮件失败: %v", err)
 	}
 
-	log.Printf("邮件已发送到: %s", to)
-	return nil
+	log.Printf("邮件已发送到: %s", msg.To)
+	return response, transport, nil
 }
 
-// SendOrderEmail 发送订单邮件
-func SendOrderEmail(to, orderID, productName, cardKey string, amount float64) error {
-	siteName := GetSiteName()
-	subject := "订单购买成功 - " + siteName
-	body := fmt.Sprintf(`
-		<html>
-		<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333;">
-			<div style="max-width: 600px; margin: 0 auto; padding: 20px;">
-				<h2 style="color: #000; border-bottom: 2px solid #000; padding-bottom: 10px;">订单购买成功</h2>
-				<p>您好，</p>
-				<p>感谢您在 %s 购买商品，以下是您的订单信息：</p>
-				<table style="width: 100%%; border-collapse: collapse; margin: 20px 0;">
-					<tr style="background-color: #f5f5f5;">
-						<td style="padding: 10px; border: 1px solid #ddd;"><strong>订单号</strong></td>
-						<td style="padding: 10px; border: 1px solid #ddd;">%s</td>
-					</tr>
-					<tr>
-						<td style="padding: 10px; border: 1px solid #ddd;"><strong>商品名称</strong></td>
-						<td style="padding: 10px; border: 1px solid #ddd;">%s</td>
-					</tr>
-					<tr style="background-color: #f5f5f5;">
-						<td style="padding: 10px; border: 1px solid #ddd;"><strong>支付金额</strong></td>
-						<td style="padding: 10px; border: 1px solid #ddd;">￥%.2f</td>
-					</tr>
-					<tr>
-						<td style="padding: 10px; border: 1px solid #ddd;"><strong>卡密</strong></td>
-						<td style="padding: 10px; border: 1px solid #ddd; font-family: monospace; font-size: 16px; color: #000;">%s</td>
-					</tr>
-				</table>
-				<p style="color: #666; font-size: 14px;">请妥善保管您的卡密，如有问题请联系客服。</p>
-				<hr style="border: none; border-top: 1px solid #ddd; margin: 20px 0;">
-				<p style="color: #999; font-size: 12px;">此邮件由系统自动发送，请勿回复。</p>
-			</div>
-		</body>
-		</html>
-	`, siteName, orderID, productName, amount, cardKey)
-
-	return SendEmail(to, subject, body)
+// QueueOrderEmail 将订单发货邮件加入发送队列
+func QueueOrderEmail(order models.Order) (models.OutboxMessage, error) {
+	msg, err := OrderEmailMessage(order)
+	if err != nil {
+		return msg, err
+	}
+	return EnqueueEmail(msg)
+}
+
+// OrderEmailMessage 按订单当前的卡密生成发货邮件,文件类卡密附带新生成的限时下载链接
+func OrderEmailMessage(order models.Order) (models.OutboxMessage, error) {
+	data := NewEmailData(order.Email)
+	data.Order = order
+	data.CardKey = order.CardKey
+	data.Fields = order.CardKeyFields
+	data.Instructions = order.Instructions
+	// 文件类卡密附带限时下载链接
+	if order.FileID != "" {
+		data.Link = DownloadURL(order.ID)
+		data.ValidFor = fmt.Sprintf("%d 小时", int(DownloadLinkTTL.Hours()))
+	}
+
+	email, err := RenderEmail(EmailTemplateOrder, data)
+	if err != nil {
+		return models.OutboxMessage{}, err
+	}
+	return models.OutboxMessage{
+		Type:    models.OutboxTypeOrder,
+		To:      order.Email,
+		Subject: email.Subject,
+		Body:    email.HTML,
+		Text:    email.Text,
+		OrderID: order.ID,
+	}, nil
 }
 
 // SendResetPasswordEmail 发送重置密码邮件
-func SendResetPasswordEmail(to, resetToken string) error {
-	siteName := GetSiteName()
-	cfg := config.GetConfig()
-	subject := "重置密码 - " + siteName
-	resetLink := fmt.Sprintf("%s/reset-password.html?token=%s", cfg.Server.Domain, resetToken)
-	body := fmt.Sprintf(`
-		<html>
-		<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333;">
-			<div style="max-width: 600px; margin: 0 auto; padding: 20px;">
-				<h2 style="color: #000; border-bottom: 2px solid #000; padding-bottom: 10px;">重置密码</h2>
-				<p>您好，</p>
-				<p>您请求重置 %s 账户密码。请点击下面的链接重置密码：</p>
-				<p style="margin: 30px 0;">
-					<a href="%s" style="display: inline-block; padding: 12px 30px; background-color: #000; color: #fff; text-decoration: none; border-radius: 5px;">重置密码</a>
-				</p>
-				<p style="color: #666; font-size: 14px;">此链接将在 30 分钟后失效。</p>
-				<p style="color: #666; font-size: 14px;">如果您没有请求重置密码，请忽略此邮件。</p>
-				<hr style="border: none; border-top: 1px solid #ddd; margin: 20px 0;">
-				<p style="color: #999; font-size: 12px;">此邮件由系统自动发送，请勿回复。</p>
-			</div>
-		</body>
-		</html>
-	`, siteName, resetLink)
-
-	return SendEmail(to, subject, body)
+func SendResetPasswordEmail(userID, to, resetToken string) error {
+	data := NewEmailData(to)
+	data.Link = fmt.Sprintf("%s/reset-password.html?token=%s", data.SiteURL, resetToken)
+	data.ValidFor = "30 分钟"
+
+	email, err := RenderEmail(EmailTemplateResetPassword, data)
+	if err != nil {
+		return err
+	}
+	_, err = SendMail(MailMessage{
+		To:      to,
+		Subject: email.Subject,
+		HTML:    email.HTML,
+		Text:    email.Text,
+		Type:    EmailTemplateResetPassword,
+		UserID:  userID,
+	})
+	return err
 }
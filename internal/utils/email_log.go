@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"ai-hacker/internal/models"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const emailLogFile = "data/email_log.json"
+
+// emailLogRetention 发送日志的保留时间
+const emailLogRetention = 180 * 24 * time.Hour
+
+// emailLogMu 保护发送日志文件的读改写
+var emailLogMu sync.Mutex
+
+// ListEmailLogs 获取全部邮件发送日志
+func ListEmailLogs() ([]models.EmailLog, error) {
+	emailLogMu.Lock()
+	defer emailLogMu.Unlock()
+
+	var logs []models.EmailLog
+	if err := LoadFromFile(emailLogFile, &logs); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// OrderEmailDeliveries 每个订单最近一封发货邮件的发送日志,按订单 ID 索引
+func OrderEmailDeliveries() map[string]models.EmailLog {
+	logs, _ := ListEmailLogs()
+
+	deliveries := make(map[string]models.EmailLog)
+	for _, l := range logs {
+		if l.OrderID == "" || l.Type != EmailTemplateOrder {
+			continue
+		}
+		if last, ok := deliveries[l.OrderID]; !ok || !l.CreatedAt.Before(last.CreatedAt) {
+			deliveries[l.OrderID] = l
+		}
+	}
+	return deliveries
+}
+
+// logQueuedEmail 记录加入发送队列的邮件
+func logQueuedEmail(msg models.OutboxMessage) {
+	updateEmailLog(msg.ID, func(l *models.EmailLog) {
+		l.Type = msg.Type
+		l.To = msg.To
+		l.Subject = msg.Subject
+		l.OrderID = msg.OrderID
+		l.UserID = msg.UserID
+		l.Status = models.EmailLogStatusQueued
+		l.Attempts = 0
+		l.Error = ""
+		l.UpdatedAt = time.Now()
+	})
+}
+
+// logEmailAttempt 记录一次发送的结果
+func logEmailAttempt(id, status, transport, response string, sendErr error, attempts int) {
+	updateEmailLog(id, func(l *models.EmailLog) {
+		setEmailAttempt(l, status, transport, response, sendErr, attempts)
+	})
+}
+
+// setEmailAttempt 将发送结果写入日志,发送失败时发布实时事件
+func setEmailAttempt(l *models.EmailLog, status, transport, response string, sendErr error, attempts int) {
+	now := time.Now()
+	l.Status = status
+	l.Transport = transport
+	l.Attempts = attempts
+	l.Response = response
+	l.Error = ""
+	if sendErr != nil {
+		l.Error = sendErr.Error()
+	}
+	l.UpdatedAt = now
+	l.AttemptAt = &now
+	if status == models.EmailLogStatusSent {
+		l.SentAt = &now
+	}
+	if sendErr != nil {
+		PublishAdminEvent(AdminEventEmailFailed, emailFailedEventData(l))
+	}
+}
+
+// emailFailedEventData 邮件发送失败事件的内容
+// 实时事件只需要 order:view 权限,不包含收件人、主题和错误信息,详情在需要 order:manage 的发送日志中查看
+func emailFailedEventData(l *models.EmailLog) map[string]interface{} {
+	return map[string]interface{}{
+		"id":       l.ID,
+		"type":     l.Type,
+		"order_id": l.OrderID,
+		"status":   l.Status,
+		"attempts": l.Attempts,
+	}
+}
+
+// updateEmailLog 修改或新增一条发送日志,同时清理过期的日志
+// 日志只用于查询,写入失败时不影响邮件发送
+func updateEmailLog(id string, update func(l *models.EmailLog)) {
+	emailLogMu.Lock()
+	defer emailLogMu.Unlock()
+
+	var logs []models.EmailLog
+	LoadFromFile(emailLogFile, &logs)
+
+	cutoff := time.Now().Add(-emailLogRetention)
+	kept := logs[:0]
+	found := false
+	for _, l := range logs {
+		if l.ID == id {
+			update(&l)
+			found = true
+		} else if l.CreatedAt.Before(cutoff) {
+			continue
+		}
+		kept = append(kept, l)
+	}
+	if !found {
+		l := models.EmailLog{ID: id, CreatedAt: time.Now()}
+		update(&l)
+		kept = append(kept, l)
+	}
+
+	if err := SaveToFile(emailLogFile, kept); err != nil {
+		log.Printf("保存邮件发送日志失败: %v", err)
+	}
+}
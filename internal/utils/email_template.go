@@ -0,0 +1,424 @@
+package utils
+
+import (
+	"ai-hacker/internal/config"
+	"ai-hacker/internal/models"
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// 邮件模板名称
+const (
+	EmailTemplateOrder         = "order"
+	EmailTemplateRestock       = "restock"
+	EmailTemplateResetPassword = "reset_password"
+	EmailTemplateVerifyCode    = "verify_code"
+	EmailTemplateAlert         = "alert"
+	EmailTemplateTest          = "test"
+)
+
+// EmailData 邮件模板变量,各模板可用的字段见 EmailTemplate.Variables
+type EmailData struct {
+	SiteName     string
+	SiteURL      string
+	Email        string
+	Order        models.Order
+	CardKey      string
+	Fields       []models.KeyFieldValue
+	Instructions string
+	Link         string
+	ValidFor     string
+	Code         string
+	ProductName  string
+	Subject      string
+	Message      string
+}
+
+// EmailTemplateVar 模板变量说明
+type EmailTemplateVar struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// EmailTemplate 邮件模板,主题和纯文本使用 text/template,HTML 使用 html/template
+type EmailTemplate struct {
+	Name       string             `json:"name"`
+	Title      string             `json:"title"`
+	Subject    string             `json:"subject"`
+	HTML       string             `json:"html"`
+	Text       string             `json:"text"`
+	Customized bool               `json:"customized"`
+	Variables  []EmailTemplateVar `json:"variables"`
+}
+
+// RenderedEmail 渲染后的邮件
+type RenderedEmail struct {
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Text    string `json:"text"`
+}
+
+// 所有模板都可以使用的变量
+var commonEmailVars = []EmailTemplateVar{
+	{"{{.SiteName}}", "网站名称"},
+	{"{{.SiteURL}}", "网站地址"},
+	{"{{.Email}}", "收件人邮箱"},
+}
+
+// emailTemplateNames 模板列表的顺序
+var emailTemplateNames = []string{
+	EmailTemplateOrder,
+	EmailTemplateRestock,
+	EmailTemplateResetPassword,
+	EmailTemplateVerifyCode,
+	EmailTemplateAlert,
+	EmailTemplateTest,
+}
+
+// emailTemplateFuncs 模板函数
+// nl2br 将多行文本转为 HTML 换行,内容会先转义
+var emailTemplateFuncs = map[string]interface{}{
+	"nl2br": func(s string) htmltemplate.HTML {
+		return htmltemplate.HTML(DeliveryInstructionsHTML(s))
+	},
+}
+
+// EmailTemplateNames 返回所有邮件模板名称
+func EmailTemplateNames() []string {
+	return append([]string(nil), emailTemplateNames...)
+}
+
+// DefaultEmailTemplate 获取默认模板
+func DefaultEmailTemplate(name string) (EmailTemplate, bool) {
+	tpl, ok := defaultEmailTemplates[name]
+	if !ok {
+		return EmailTemplate{}, false
+	}
+	tpl.Name = name
+	tpl.Variables = append(append([]EmailTemplateVar(nil), commonEmailVars...), tpl.Variables...)
+	return tpl, true
+}
+
+// EmailTemplateSettingKey 模板各部分在系统设置中的键,part 为 subject、html 或 text
+func EmailTemplateSettingKey(name, part string) string {
+	return "email_template_" + name + "_" + part
+}
+
+// GetEmailTemplate 获取当前模板,未修改的部分使用默认模板
+func GetEmailTemplate(name string) (EmailTemplate, bool) {
+	tpl, ok := DefaultEmailTemplate(name)
+	if !ok {
+		return tpl, false
+	}
+
+	var settings []models.Setting
+	LoadFromFile(settingsFile, &settings)
+	for _, s := range settings {
+		if s.Value == "" {
+			continue
+		}
+		switch s.Key {
+		case EmailTemplateSettingKey(name, "subject"):
+			tpl.Subject = s.Value
+		case EmailTemplateSettingKey(name, "html"):
+			tpl.HTML = s.Value
+		case EmailTemplateSettingKey(name, "text"):
+			tpl.Text = s.Value
+		default:
+			continue
+		}
+		tpl.Customized = true
+	}
+	return tpl, true
+}
+
+// NewEmailData 创建包含网站信息的模板变量
+func NewEmailData(to string) EmailData {
+	return EmailData{
+		SiteName: GetSiteName(),
+		SiteURL:  config.GetConfig().Server.Domain,
+		Email:    to,
+	}
+}
+
+// SampleEmailData 预览和校验模板使用的示例数据
+func SampleEmailData(name string) EmailData {
+	data := NewEmailData("customer@example.com")
+	data.Order = models.Order{
+		ID:          "ORD20260101120000",
+		ProductID:   "P1",
+		ProductName: "示例商品",
+		Email:       data.Email,
+		Amount:      99,
+		Status:      models.OrderStatusCompleted,
+		CardKey:     "XXXX-YYYY-ZZZZ",
+		CreatedAt:   time.Now(),
+	}
+	data.CardKey = data.Order.CardKey
+	data.Fields = []models.KeyFieldValue{
+		{Label: "账号", Value: "demo@example.com"},
+		{Label: "密码", Value: "p@ssw0rd"},
+	}
+	data.Instructions = "登录后请立即修改密码\n如有问题请联系客服"
+	data.Code = "123456"
+	data.ProductName = data.Order.ProductName
+	data.Subject = "库存告警"
+	data.Message = "商品 示例商品 (P1) 库存仅剩 3 个，请及时补充卡密。"
+
+	switch name {
+	case EmailTemplateOrder:
+		data.Link = DownloadURL(data.Order.ID)
+		data.ValidFor = fmt.Sprintf("%d 小时", int(DownloadLinkTTL.Hours()))
+	case EmailTemplateResetPassword:
+		data.Link = data.SiteURL + "/reset-password.html?token=sample"
+		data.ValidFor = "30 分钟"
+	case EmailTemplateVerifyCode:
+		data.ValidFor = "5 分钟"
+	}
+	return data
+}
+
+// RenderEmailTemplate 使用指定的模板内容渲染邮件
+func RenderEmailTemplate(tpl EmailTemplate, data EmailData) (RenderedEmail, error) {
+	var out RenderedEmail
+
+	subject, err := renderText("subject", tpl.Subject, data)
+	if err != nil {
+		return out, fmt.Errorf("主题模板错误: %v", err)
+	}
+	// 主题只能有一行
+	out.Subject = strings.Join(strings.Fields(subject), " ")
+
+	h, err := htmltemplate.New("html").Funcs(emailTemplateFuncs).Parse(tpl.HTML)
+	if err != nil {
+		return out, fmt.Errorf("HTML 模板错误: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := h.Execute(&buf, data); err != nil {
+		return out, fmt.Errorf("HTML 模板错误: %v", err)
+	}
+	out.HTML = buf.String()
+
+	if out.Text, err = renderText("text", tpl.Text, data); err != nil {
+		return out, fmt.Errorf("纯文本模板错误: %v", err)
+	}
+	return out, nil
+}
+
+// RenderEmail 使用当前模板渲染邮件,修改后的模板出错时使用默认模板
+func RenderEmail(name string, data EmailData) (RenderedEmail, error) {
+	tpl, ok := GetEmailTemplate(name)
+	if !ok {
+		return RenderedEmail{}, fmt.Errorf("邮件模板不存在: %s", name)
+	}
+
+	out, err := RenderEmailTemplate(tpl, data)
+	if err != nil && tpl.Customized {
+		log.Printf("邮件模板 %s 渲染失败,使用默认模板: %v", name, err)
+		tpl, _ = DefaultEmailTemplate(name)
+		out, err = RenderEmailTemplate(tpl, data)
+	}
+	return out, err
+}
+
+// renderText 渲染主题和纯文本模板
+func renderText(name, text string, data EmailData) (string, error) {
+	t, err := texttemplate.New(name).Funcs(texttemplate.FuncMap{"nl2br": func(s string) string { return s }}).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// 邮件公共样式
+const (
+	emailHeader = `<html>
+<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333;">
+	<div style="max-width: 600px; margin: 0 auto; padding: 20px;">`
+	emailFooter = `
+		<hr style="border: none; border-top: 1px solid #ddd; margin: 20px 0;">
+		<p style="color: #999; font-size: 12px;">此邮件由 {{.SiteName}} 系统自动发送，请勿回复。</p>
+	</div>
+</body>
+</html>`
+	textFooter = `
+--
+此邮件由 {{.SiteName}} 系统自动发送，请勿回复。
+`
+)
+
+// defaultEmailTemplates 默认模板
+var defaultEmailTemplates = map[string]EmailTemplate{
+	EmailTemplateOrder: {
+		Title:   "订单发货",
+		Subject: "订单购买成功 - {{.SiteName}}",
+		HTML: emailHeader + `
+		<h2 style="color: #000; border-bottom: 2px solid #000; padding-bottom: 10px;">订单购买成功</h2>
+		<p>您好，</p>
+		<p>感谢您在 {{.SiteName}} 购买商品，以下是您的订单信息：</p>
+		<table style="width: 100%; border-collapse: collapse; margin: 20px 0;">
+			<tr style="background-color: #f5f5f5;">
+				<td style="padding: 10px; border: 1px solid #ddd;"><strong>订单号</strong></td>
+				<td style="padding: 10px; border: 1px solid #ddd;">{{.Order.ID}}</td>
+			</tr>
+			<tr>
+				<td style="padding: 10px; border: 1px solid #ddd;"><strong>商品名称</strong></td>
+				<td style="padding: 10px; border: 1px solid #ddd;">{{.Order.ProductName}}</td>
+			</tr>
+			<tr style="background-color: #f5f5f5;">
+				<td style="padding: 10px; border: 1px solid #ddd;"><strong>支付金额</strong></td>
+				<td style="padding: 10px; border: 1px solid #ddd;">￥{{printf "%.2f" .Order.Amount}}</td>
+			</tr>
+			{{- if .Fields}}{{range .Fields}}
+			<tr>
+				<td style="padding: 10px; border: 1px solid #ddd;"><strong>{{.Label}}</strong></td>
+				<td style="padding: 10px; border: 1px solid #ddd; font-family: monospace; font-size: 16px; color: #000;">{{.Value}}</td>
+			</tr>
+			{{- end}}{{else}}
+			<tr>
+				<td style="padding: 10px; border: 1px solid #ddd;"><strong>卡密</strong></td>
+				<td style="padding: 10px; border: 1px solid #ddd; font-family: monospace; font-size: 16px; color: #000;">{{.CardKey}}</td>
+			</tr>
+			{{- end}}
+			{{- if .Link}}
+			<tr style="background-color: #f5f5f5;">
+				<td style="padding: 10px; border: 1px solid #ddd;"><strong>下载链接</strong></td>
+				<td style="padding: 10px; border: 1px solid #ddd;"><a href="{{.Link}}">点击下载</a><br><span style="color: #999; font-size: 12px;">链接 {{.ValidFor}}内有效，过期后可在订单查询页面重新获取</span></td>
+			</tr>
+			{{- end}}
+		</table>
+		{{- if .Instructions}}
+		<h3 style="color: #000; margin-top: 20px;">使用说明</h3>
+		<div style="background-color: #f5f5f5; padding: 15px; border-radius: 5px;">{{nl2br .Instructions}}</div>
+		{{- end}}
+		<p style="color: #666; font-size: 14px;">请妥善保管您的卡密，如有问题请联系客服。</p>` + emailFooter,
+		Text: `您好，
+
+感谢您在 {{.SiteName}} 购买商品，以下是您的订单信息：
+
+订单号: {{.Order.ID}}
+商品名称: {{.Order.ProductName}}
+支付金额: ￥{{printf "%.2f" .Order.Amount}}
+{{if .Fields}}{{range .Fields}}{{.Label}}: {{.Value}}
+{{end}}{{else}}卡密: {{.CardKey}}
+{{end}}{{if .Link}}下载链接 ({{.ValidFor}}内有效): {{.Link}}
+{{end}}{{if .Instructions}}
+使用说明:
+{{.Instructions}}
+{{end}}
+请妥善保管您的卡密，如有问题请联系客服。
+` + textFooter,
+		Variables: []EmailTemplateVar{
+			{"{{.Order.ID}}", "订单号"},
+			{"{{.Order.ProductName}}", "商品名称"},
+			{"{{.Order.Amount}}", "支付金额,可用 {{printf \"%.2f\" .Order.Amount}} 格式化"},
+			{"{{.Order.CreatedAt}}", "下单时间,可用 {{.Order.CreatedAt.Format \"2006-01-02 15:04\"}} 格式化"},
+			{"{{.CardKey}}", "卡密"},
+			{"{{.Fields}}", "结构化卡密字段列表,每项包含 .Label 和 .Value,为空时使用 .CardKey"},
+			{"{{.Link}}", "文件类卡密的下载链接,非文件类卡密为空"},
+			{"{{.ValidFor}}", "下载链接有效期,如 24 小时"},
+			{"{{.Instructions}}", "发货说明,HTML 中可用 {{nl2br .Instructions}} 保留换行"},
+		},
+	},
+	EmailTemplateRestock: {
+		Title:   "到货通知",
+		Subject: "到货通知 - {{.SiteName}}",
+		HTML: emailHeader + `
+		<h2 style="color: #000; border-bottom: 2px solid #000; padding-bottom: 10px;">到货通知</h2>
+		<p>您好，</p>
+		<p>您在 {{.SiteName}} 订阅的商品 <strong>{{.ProductName}}</strong> 已补货，欢迎前往购买。</p>
+		<p style="color: #666; font-size: 14px;">库存有限，先到先得。</p>` + emailFooter,
+		Text: `您好，
+
+您在 {{.SiteName}} 订阅的商品 {{.ProductName}} 已补货，欢迎前往购买: {{.SiteURL}}
+
+库存有限，先到先得。
+` + textFooter,
+		Variables: []EmailTemplateVar{
+			{"{{.ProductName}}", "商品名称"},
+		},
+	},
+	EmailTemplateResetPassword: {
+		Title:   "重置密码",
+		Subject: "重置密码 - {{.SiteName}}",
+		HTML: emailHeader + `
+		<h2 style="color: #000; border-bottom: 2px solid #000; padding-bottom: 10px;">重置密码</h2>
+		<p>您好，</p>
+		<p>您请求重置 {{.SiteName}} 账户密码。请点击下面的链接重置密码：</p>
+		<p style="margin: 30px 0;">
+			<a href="{{.Link}}" style="display: inline-block; padding: 12px 30px; background-color: #000; color: #fff; text-decoration: none; border-radius: 5px;">重置密码</a>
+		</p>
+		<p style="color: #666; font-size: 14px;">此链接将在 {{.ValidFor}}后失效。</p>
+		<p style="color: #666; font-size: 14px;">如果您没有请求重置密码，请忽略此邮件。</p>` + emailFooter,
+		Text: `您好，
+
+您请求重置 {{.SiteName}} 账户密码。请打开下面的链接重置密码：
+
+{{.Link}}
+
+此链接将在 {{.ValidFor}}后失效。
+如果您没有请求重置密码，请忽略此邮件。
+` + textFooter,
+		Variables: []EmailTemplateVar{
+			{"{{.Link}}", "重置密码链接"},
+			{"{{.ValidFor}}", "链接有效期,如 30 分钟"},
+		},
+	},
+	EmailTemplateVerifyCode: {
+		Title:   "注册验证码",
+		Subject: "{{.SiteName}} - 注册验证码",
+		HTML: emailHeader + `
+		<h2 style="color: #000;">注册验证码</h2>
+		<p>您正在注册 {{.SiteName}} 账号，验证码为：</p>
+		<div style="background-color: #f5f5f5; padding: 20px; text-align: center; font-size: 32px; font-weight: bold; letter-spacing: 5px; margin: 20px 0;">{{.Code}}</div>
+		<p style="color: #666;">验证码有效期为 {{.ValidFor}}，请尽快完成注册。</p>
+		<p style="color: #999; font-size: 12px;">如果这不是您的操作，请忽略此邮件。</p>` + emailFooter,
+		Text: `您正在注册 {{.SiteName}} 账号，验证码为：{{.Code}}
+
+验证码有效期为 {{.ValidFor}}，请尽快完成注册。
+如果这不是您的操作，请忽略此邮件。
+` + textFooter,
+		Variables: []EmailTemplateVar{
+			{"{{.Code}}", "验证码"},
+			{"{{.ValidFor}}", "验证码有效期,如 5 分钟"},
+		},
+	},
+	EmailTemplateAlert: {
+		Title:   "管理员告警",
+		Subject: "{{.Subject}} - {{.SiteName}}",
+		HTML: emailHeader + `
+		<h2 style="color: #000; border-bottom: 2px solid #000; padding-bottom: 10px;">{{.Subject}}</h2>
+		<p>{{.Message}}</p>` + emailFooter,
+		Text: `{{.Subject}}
+
+{{.Message}}
+` + textFooter,
+		Variables: []EmailTemplateVar{
+			{"{{.Subject}}", "告警标题"},
+			{"{{.Message}}", "告警内容"},
+		},
+	},
+	EmailTemplateTest: {
+		Title:   "测试邮件",
+		Subject: "测试邮件 - {{.SiteName}}",
+		HTML: emailHeader + `
+		<h2 style="color: #000; border-bottom: 2px solid #000; padding-bottom: 10px;">邮件配置测试</h2>
+		<p>您好，</p>
+		<p>这是一封测试邮件，用于验证 {{.SiteName}} 系统的邮件配置是否正确。</p>
+		<p>如果您收到这封邮件，说明邮件服务配置成功。</p>` + emailFooter,
+		Text: `您好，
+
+这是一封测试邮件，用于验证 {{.SiteName}} 系统的邮件配置是否正确。
+如果您收到这封邮件，说明邮件服务配置成功。
+` + textFooter,
+	},
+}
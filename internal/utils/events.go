@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 后台实时事件
+const (
+	AdminEventOrderCreated = "order.created" // 创建订单
+	AdminEventOrderPaid    = "order.paid"    // 订单支付完成
+	AdminEventStockChanged = "stock.changed" // 商品库存变化
+	AdminEventEmailFailed  = "email.failed"  // 邮件发送失败,包括会重试的失败
+	AdminEventResync       = "resync"        // 无法补发断线期间的事件,客户端应重新加载数据
+)
+
+const (
+	// adminEventBufferSize 保留最近的事件数量,用于断线重连后补发
+	adminEventBufferSize = 500
+	// adminEventSubscriberBuffer 每个连接待发送的事件数量,超出时断开该连接,由客户端重连补发
+	adminEventSubscriberBuffer = 64
+)
+
+// AdminEvent 推送给后台的实时事件
+// ID 由服务启动时间和序号组成,服务重启后旧的 ID 不再有效
+type AdminEvent struct {
+	ID   string      `json:"id"`
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// adminEventBus 进程内的事件总线,保留最近的事件并分发给所有订阅的连接
+type adminEventBus struct {
+	mu     sync.Mutex
+	epoch  string
+	seq    uint64
+	buffer []AdminEvent // 环形缓冲区,按序号取模存放
+	subs   map[chan AdminEvent]struct{}
+	closed bool
+}
+
+var adminEvents = &adminEventBus{
+	epoch:  strconv.FormatInt(time.Now().UnixNano(), 36),
+	buffer: make([]AdminEvent, adminEventBufferSize),
+	subs:   make(map[chan AdminEvent]struct{}),
+}
+
+// PublishAdminEvent 发布实时事件,不会阻塞调用方
+func PublishAdminEvent(eventType string, data interface{}) {
+	b := adminEvents
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	event := AdminEvent{
+		ID:   b.eventID(b.seq),
+		Type: eventType,
+		Time: time.Now(),
+		Data: data,
+	}
+	b.buffer[b.seq%adminEventBufferSize] = event
+
+	for ch := range b.subs {
+		select {
+		case ch <- event:
+		default:
+			// 连接处理不过来,断开后由客户端带 Last-Event-ID 重连补发
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// SubscribeAdminEvents 订阅实时事件
+// lastEventID 为客户端收到的最后一个事件,返回之后的事件用于补发;
+// 事件已不在缓冲区或来自服务重启前时只返回一个 resync 事件,客户端需要重新加载数据。
+// 返回的通道在服务关闭或连接处理过慢时关闭,不再使用时调用 cancel。
+func SubscribeAdminEvents(lastEventID string) (replay []AdminEvent, events <-chan AdminEvent, cancel func()) {
+	b := adminEvents
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan AdminEvent, adminEventSubscriberBuffer)
+	if b.closed {
+		close(ch)
+		return nil, ch, func() {}
+	}
+	b.subs[ch] = struct{}{}
+
+	cancel = func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+
+	if lastEventID == "" {
+		return nil, ch, cancel
+	}
+
+	last, ok := b.parseEventID(lastEventID)
+	oldest := uint64(1)
+	if b.seq > adminEventBufferSize {
+		oldest = b.seq - adminEventBufferSize + 1
+	}
+	if !ok || last > b.seq || last+1 < oldest {
+		// 使用当前最新的 ID,客户端下次重连时从这里继续
+		resync := AdminEvent{
+			ID:   b.eventID(b.seq),
+			Type: AdminEventResync,
+			Time: time.Now(),
+		}
+		return []AdminEvent{resync}, ch, cancel
+	}
+	for seq := last + 1; seq <= b.seq; seq++ {
+		replay = append(replay, b.buffer[seq%adminEventBufferSize])
+	}
+	return replay, ch, cancel
+}
+
+// CloseAdminEvents 关闭所有订阅的连接,用于关闭服务时结束长连接
+func CloseAdminEvents() {
+	b := adminEvents
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+// eventID 生成事件 ID
+func (b *adminEventBus) eventID(seq uint64) string {
+	return b.epoch + "-" + strconv.FormatUint(seq, 10)
+}
+
+// parseEventID 解析本次启动发布的事件 ID,返回序号
+func (b *adminEventBus) parseEventID(id string) (uint64, bool) {
+	epoch, seq, found := strings.Cut(id, "-")
+	if !found || epoch != b.epoch {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
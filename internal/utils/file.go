@@ -3,9 +3,27 @@ package utils
 import (
 	"encoding/json"
 	"os"
+	"sync"
 	"time"
 )
 
+// dataMu 数据目录的读写锁
+// 普通写入持有读锁可以并发进行,备份时持有写锁暂停所有写入以获得一致的快照
+var dataMu sync.RWMutex
+
+// BeginDataWrite 标记开始写入数据目录,返回结束写入的函数
+// 直接写入 data 目录 (不经过 SaveToFile) 的代码需要调用
+func BeginDataWrite() func() {
+	dataMu.RLock()
+	return dataMu.RUnlock
+}
+
+// FreezeData 暂停所有数据写入,返回恢复写入的函数
+func FreezeData() func() {
+	dataMu.Lock()
+	return dataMu.Unlock
+}
+
 // LoadFromFile 从文件加载数据
 func LoadFromFile(filename string, v interface{}) error {
 	data, err := os.ReadFile(filename)
@@ -21,9 +39,36 @@ func SaveToFile(filename string, v interface{}) error {
 	if err != nil {
 		return err
 	}
+
+	defer BeginDataWrite()()
 	return os.WriteFile(filename, data, 0644)
 }
 
+// StreamFromFile 逐条读取 JSON 数组文件,不一次性加载全部数据
+// fn 返回错误时停止读取并返回该错误
+func StreamFromFile[T any](filename string, fn func(item *T) error) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	for dec.More() {
+		var item T
+		if err := dec.Decode(&item); err != nil {
+			return err
+		}
+		if err := fn(&item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // InitFileIfNotExists 如果文件不存在则初始化
 func InitFileIfNotExists(filename string, data interface{}) {
 	if _, err := os.Stat(filename); os.IsNotExist(err) {
@@ -32,7 +77,22 @@ func InitFileIfNotExists(filename string, data interface{}) {
 }
 
 
+// TimeLayout 数据文件中字符串时间的统一格式
+const TimeLayout = "2006-01-02 15:04:05"
+
 // GetCurrentTime 获取当前时间字符串
 func GetCurrentTime() string {
-	return time.Now().Format("2006-01-02 15:04:05")
+	return time.Now().Format(TimeLayout)
+}
+
+// ParseTime 解析字符串时间,支持统一格式、仅日期和 RFC3339
+// 仅日期时视为当天结束
+func ParseTime(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation(TimeLayout, value, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t.Add(24*time.Hour - time.Second), nil
+	}
+	return time.Parse(time.RFC3339, value)
 }
@@ -0,0 +1,252 @@
+package utils
+
+import (
+	"ai-hacker/internal/config"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/gomail.v2"
+)
+
+// 邮件发送方式
+const (
+	MailTransportSMTP = "smtp" // SMTP 服务器
+	MailTransportFile = "file" // 保存到本地文件,用于开发和测试
+	MailTransportHTTP = "http" // 邮件服务商的 HTTP API
+)
+
+// SMTP 加密方式
+const (
+	SMTPSecuritySTARTTLS = "starttls" // 明文连接后升级为 TLS,服务器不支持时拒绝发送
+	SMTPSecurityTLS      = "tls"      // 直接使用 TLS 连接,通常为 465 端口
+	SMTPSecurityNone     = "none"     // 不加密,仅用于本地测试服务器
+)
+
+// smtpTimeout 连接和发送单封邮件的超时时间
+const smtpTimeout = 30 * time.Second
+
+// ErrEmailNotConfigured 邮件服务未配置
+var ErrEmailNotConfigured = errors.New("邮件服务未配置,请在后台系统设置中配置")
+
+// MailMessage 待发送的邮件
+type MailMessage struct {
+	From    string
+	To      string
+	Subject string
+	HTML    string
+	Text    string // 纯文本内容,为空时只发送 HTML
+
+	// 以下字段只用于记录发送日志,不会发出
+	Type    string // 邮件模板
+	OrderID string
+	UserID  string
+}
+
+// Mailer 邮件发送方式
+// Send 返回服务器的响应,如 SMTP 的 250 响应或 API 返回的消息 ID
+type Mailer interface {
+	Send(msg MailMessage) (string, error)
+}
+
+// NewMailer 按配置创建发送方式,未配置时返回 ErrEmailNotConfigured
+func NewMailer(emailCfg config.EmailConfig) (Mailer, error) {
+	if !isEmailConfigured(emailCfg) {
+		return nil, ErrEmailNotConfigured
+	}
+
+	switch emailCfg.Transport {
+	case "", MailTransportSMTP:
+		security := emailCfg.Security
+		if security == "" {
+			security = SMTPSecuritySTARTTLS
+			if emailCfg.SMTPPort == 465 {
+				security = SMTPSecurityTLS
+			}
+		}
+		return &smtpMailer{
+			host:     emailCfg.SMTPHost,
+			port:     emailCfg.SMTPPort,
+			username: emailCfg.Username,
+			password: emailCfg.Password,
+			security: security,
+		}, nil
+	case MailTransportFile:
+		path := emailCfg.FilePath
+		if path == "" {
+			path = defaultMailFilePath
+		}
+		if err := ValidateMailFilePath(path); err != nil {
+			return nil, fmt.Errorf("邮件保存位置 %s 无效: %v", path, err)
+		}
+		return &fileMailer{path: path}, nil
+	case MailTransportHTTP:
+		return newHTTPMailer(emailCfg)
+	}
+	return nil, fmt.Errorf("不支持的发送方式: %s", emailCfg.Transport)
+}
+
+// buildMIME 生成 MIME 格式的邮件内容,有纯文本内容时为 multipart/alternative
+func buildMIME(msg MailMessage) ([]byte, error) {
+	m := gomail.NewMessage()
+	m.SetHeader("From", msg.From)
+	m.SetHeader("To", msg.To)
+	m.SetHeader("Subject", msg.Subject)
+	m.SetHeader("Message-ID", fmt.Sprintf("<%s@%s>", GenerateID(), mailDomain(msg.From)))
+	if msg.Text != "" {
+		m.SetBody("text/plain", msg.Text)
+		m.AddAlternative("text/html", msg.HTML)
+	} else {
+		m.SetBody("text/html", msg.HTML)
+	}
+
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// mailAddress 取出 "名称 <地址>" 中的地址
+func mailAddress(s string) string {
+	if addr, err := mail.ParseAddress(s); err == nil {
+		return addr.Address
+	}
+	return strings.TrimSpace(s)
+}
+
+// mailDomain 发件地址的域名,用于生成 Message-ID
+func mailDomain(from string) string {
+	addr := mailAddress(from)
+	if i := strings.LastIndex(addr, "@"); i >= 0 && i < len(addr)-1 {
+		return addr[i+1:]
+	}
+	return "localhost"
+}
+
+// smtpMailer 通过 SMTP 服务器发送
+type smtpMailer struct {
+	host     string
+	port     int
+	username string
+	password string
+	security string
+}
+
+// Send 发送邮件,返回服务器接收邮件后的响应
+func (m *smtpMailer) Send(msg MailMessage) (string, error) {
+	data, err := buildMIME(msg)
+	if err != nil {
+		return "", err
+	}
+
+	addr := net.JoinHostPort(m.host, strconv.Itoa(m.port))
+	tlsConfig := &tls.Config{ServerName: m.host}
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+
+	var conn net.Conn
+	if m.security == SMTPSecurityTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return "", fmt.Errorf("连接 %s 失败: %v", addr, err)
+	}
+	conn.SetDeadline(time.Now().Add(2 * smtpTimeout))
+
+	c, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return "", fmt.Errorf("SMTP 握手失败: %v", err)
+	}
+	defer c.Close()
+
+	if m.security == SMTPSecuritySTARTTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return "", errors.New("服务器不支持 STARTTLS,如确认不需要加密请将加密方式设为 none")
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return "", fmt.Errorf("STARTTLS 失败: %v", err)
+		}
+	}
+
+	if m.username != "" {
+		if ok, mechs := c.Extension("AUTH"); ok {
+			var auth smtp.Auth = smtp.PlainAuth("", m.username, m.password, m.host)
+			if !strings.Contains(mechs, "PLAIN") && strings.Contains(mechs, "LOGIN") {
+				auth = &loginAuth{username: m.username, password: m.password}
+			}
+			if err := c.Auth(auth); err != nil {
+				return "", fmt.Errorf("SMTP 认证失败: %v", err)
+			}
+		}
+	}
+
+	if err := c.Mail(mailAddress(msg.From)); err != nil {
+		return "", fmt.Errorf("发件人被拒绝: %v", err)
+	}
+	if err := c.Rcpt(mailAddress(msg.To)); err != nil {
+		return "", fmt.Errorf("收件人被拒绝: %v", err)
+	}
+
+	// 不使用 c.Data,以便取得服务器接收邮件后的响应
+	id, err := c.Text.Cmd("DATA")
+	if err != nil {
+		return "", err
+	}
+	c.Text.StartResponse(id)
+	_, _, err = c.Text.ReadResponse(354)
+	c.Text.EndResponse(id)
+	if err != nil {
+		return "", fmt.Errorf("DATA 命令被拒绝: %v", err)
+	}
+	w := c.Text.DotWriter()
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	code, response, err := c.Text.ReadResponse(250)
+	if err != nil {
+		return "", fmt.Errorf("邮件被拒绝: %v", err)
+	}
+
+	c.Quit()
+	return fmt.Sprintf("%d %s", code, response), nil
+}
+
+// loginAuth LOGIN 认证,用于不支持 PLAIN 的服务器
+type loginAuth struct {
+	username string
+	password string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS {
+		return "", nil, errors.New("连接未加密,不能发送密码")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	}
+	return nil, fmt.Errorf("未知的 LOGIN 认证提示: %s", fromServer)
+}
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultMailFilePath file 方式未配置保存位置时使用的目录
+const defaultMailFilePath = "mailbox"
+
+// ValidateMailFilePath 检查 file 方式的保存位置
+// 邮件包含卡密,只能保存在 mailbox 目录或其中的子目录、mbox 文件中,
+// 不能是绝对路径或包含 ..,避免写入 static 等对外提供访问的目录
+func ValidateMailFilePath(path string) error {
+	slashed := filepath.ToSlash(path)
+	if filepath.IsAbs(path) || strings.HasPrefix(slashed, "/") || filepath.VolumeName(path) != "" {
+		return fmt.Errorf("不能使用绝对路径")
+	}
+	for _, part := range strings.Split(slashed, "/") {
+		if part == ".." {
+			return fmt.Errorf("不能包含 ..")
+		}
+	}
+	clean := filepath.ToSlash(filepath.Clean(path))
+	if clean != defaultMailFilePath && !strings.HasPrefix(clean, defaultMailFilePath+"/") {
+		return fmt.Errorf("只能位于 %s 目录中", defaultMailFilePath)
+	}
+	return nil
+}
+
+// mboxMu 保护 mbox 文件的追加写入
+var mboxMu sync.Mutex
+
+// fileMailer 将邮件保存到本地文件,不实际发送,用于开发和测试
+type fileMailer struct {
+	path string
+}
+
+// Send 保存邮件,返回保存位置
+func (m *fileMailer) Send(msg MailMessage) (string, error) {
+	data, err := buildMIME(msg)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.HasSuffix(m.path, ".mbox") {
+		return m.appendMbox(msg, data)
+	}
+
+	if err := os.MkdirAll(m.path, 0755); err != nil {
+		return "", fmt.Errorf("创建目录失败: %v", err)
+	}
+	file := filepath.Join(m.path, GenerateID()+".eml")
+	if err := os.WriteFile(file, data, 0600); err != nil {
+		return "", fmt.Errorf("保存邮件失败: %v", err)
+	}
+	return "已写入 " + file, nil
+}
+
+// appendMbox 以 mbox 格式追加到文件末尾
+func (m *fileMailer) appendMbox(msg MailMessage, data []byte) (string, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From %s %s\n", mailAddress(msg.From), time.Now().Format(time.ANSIC))
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		// 正文中以 From 开头的行需要转义
+		if strings.HasPrefix(strings.TrimLeft(line, ">"), "From ") {
+			buf.WriteString(">")
+		}
+		buf.WriteString(line)
+		buf.WriteString("\n")
+	}
+	buf.WriteString("\n")
+
+	mboxMu.Lock()
+	defer mboxMu.Unlock()
+
+	if dir := filepath.Dir(m.path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", fmt.Errorf("创建目录失败: %v", err)
+		}
+	}
+	f, err := os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", fmt.Errorf("打开 mbox 文件失败: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		return "", fmt.Errorf("保存邮件失败: %v", err)
+	}
+	return "已写入 " + m.path, nil
+}
@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"ai-hacker/internal/config"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+)
+
+// 支持的邮件服务商
+const (
+	MailProviderSendGrid = "sendgrid"
+	MailProviderMailgun  = "mailgun"
+)
+
+// 服务商默认接口地址,可通过配置修改(如 Mailgun 欧洲区或测试服务器)
+var defaultMailAPIBaseURLs = map[string]string{
+	MailProviderSendGrid: "https://api.sendgrid.com",
+	MailProviderMailgun:  "https://api.mailgun.net",
+}
+
+// httpMailer 通过邮件服务商的 HTTP API 发送
+type httpMailer struct {
+	provider string
+	apiKey   string
+	baseURL  string
+	domain   string
+	client   *http.Client
+}
+
+func newHTTPMailer(emailCfg config.EmailConfig) (Mailer, error) {
+	baseURL, ok := defaultMailAPIBaseURLs[emailCfg.APIProvider]
+	if !ok {
+		return nil, fmt.Errorf("不支持的邮件服务商: %s", emailCfg.APIProvider)
+	}
+	if emailCfg.APIBaseURL != "" {
+		baseURL = emailCfg.APIBaseURL
+	}
+	return &httpMailer{
+		provider: emailCfg.APIProvider,
+		apiKey:   emailCfg.APIKey,
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		domain:   emailCfg.APIDomain,
+		client:   &http.Client{Timeout: smtpTimeout},
+	}, nil
+}
+
+// Send 调用服务商接口发送邮件,返回服务商的消息 ID
+func (m *httpMailer) Send(msg MailMessage) (string, error) {
+	var req *http.Request
+	var err error
+	if m.provider == MailProviderMailgun {
+		req, err = m.mailgunRequest(msg)
+	} else {
+		req, err = m.sendGridRequest(msg)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("请求 %s 失败: %v", m.provider, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("%s 返回 %s: %s", m.provider, resp.Status, truncateString(strings.TrimSpace(string(body)), 500))
+	}
+
+	if m.provider == MailProviderMailgun {
+		var result struct {
+			ID      string `json:"id"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(body, &result)
+		return strings.TrimSpace(fmt.Sprintf("%s %s", resp.Status, result.ID)), nil
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s %s", resp.Status, resp.Header.Get("X-Message-Id"))), nil
+}
+
+// sendGridRequest SendGrid v3 Mail Send 接口
+func (m *httpMailer) sendGridRequest(msg MailMessage) (*http.Request, error) {
+	type address struct {
+		Email string `json:"email"`
+		Name  string `json:"name,omitempty"`
+	}
+	type content struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+
+	// 纯文本内容必须在 HTML 之前
+	var contents []content
+	if msg.Text != "" {
+		contents = append(contents, content{Type: "text/plain", Value: msg.Text})
+	}
+	contents = append(contents, content{Type: "text/html", Value: msg.HTML})
+
+	from := address{Email: mailAddress(msg.From)}
+	if addr, err := mail.ParseAddress(msg.From); err == nil {
+		from.Name = addr.Name
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"personalizations": []map[string]interface{}{
+			{"to": []address{{Email: mailAddress(msg.To)}}},
+		},
+		"from":    from,
+		"subject": msg.Subject,
+		"content": contents,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, m.baseURL+"/v3/mail/send", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+m.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// mailgunRequest Mailgun messages 接口
+func (m *httpMailer) mailgunRequest(msg MailMessage) (*http.Request, error) {
+	form := url.Values{}
+	form.Set("from", msg.From)
+	form.Set("to", msg.To)
+	form.Set("subject", msg.Subject)
+	form.Set("html", msg.HTML)
+	if msg.Text != "" {
+		form.Set("text", msg.Text)
+	}
+
+	endpoint := fmt.Sprintf("%s/v3/%s/messages", m.baseURL, url.PathEscape(m.domain))
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth("api", m.apiKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
+
+// truncateString 截断过长的字符串,用于错误信息
+func truncateString(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "..."
+}
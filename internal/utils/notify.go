@@ -0,0 +1,197 @@
+package utils
+
+import (
+	"ai-hacker/internal/models"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// 通知渠道
+const (
+	NotifyChannelEmail    = "email"    // 发邮件给所有管理员
+	NotifyChannelWebhook  = "webhook"  // 推送到告警 Webhook 地址
+	NotifyChannelTelegram = "telegram" // 通过 Telegram 机器人发送到指定会话
+)
+
+// notifyRouteNone 路由设置为该值时不发送通知
+const notifyRouteNone = "none"
+
+// ErrNotifierNotConfigured 通知渠道未配置
+var ErrNotifierNotConfigured = errors.New("通知渠道未配置")
+
+// Notification 发给管理员的通知
+type Notification struct {
+	Event   string
+	Subject string
+	Message string
+	Payload map[string]interface{} // Webhook 推送的附加数据
+}
+
+// Notifier 通知渠道
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+// NotificationEvent 可以发送通知的事件及默认发送的渠道
+type NotificationEvent struct {
+	Name     string   `json:"name"`
+	Title    string   `json:"title"`
+	Defaults []string `json:"defaults"`
+}
+
+// notificationEvents 可以配置路由的事件,默认渠道与原有的告警行为一致
+var notificationEvents = []NotificationEvent{
+	{Name: "order.paid", Title: "新订单", Defaults: []string{}},
+	{Name: "stock.low", Title: "库存不足", Defaults: []string{NotifyChannelEmail, NotifyChannelWebhook}},
+	{Name: "backup.failed", Title: "定时备份失败", Defaults: []string{NotifyChannelEmail, NotifyChannelWebhook}},
+	{Name: "cardkey.reveal_quota", Title: "卡密查看次数超限", Defaults: []string{NotifyChannelEmail, NotifyChannelWebhook}},
+}
+
+// NotifyChannels 返回全部通知渠道
+func NotifyChannels() []string {
+	return []string{NotifyChannelEmail, NotifyChannelWebhook, NotifyChannelTelegram}
+}
+
+// NotificationEvents 返回可以配置路由的事件
+func NotificationEvents() []NotificationEvent {
+	return append([]NotificationEvent(nil), notificationEvents...)
+}
+
+// NotificationRouteKey 事件路由的设置项名称,如 notify_stock_low
+func NotificationRouteKey(event string) string {
+	return "notify_" + strings.ReplaceAll(event, ".", "_")
+}
+
+// ParseNotificationRoute 解析路由设置,返回渠道列表,有未知渠道时返回错误
+// 空值表示使用默认渠道,由调用方处理
+func ParseNotificationRoute(value string) ([]string, error) {
+	if value == notifyRouteNone {
+		return []string{}, nil
+	}
+
+	channels := []string{}
+	for _, ch := range strings.Split(value, ",") {
+		ch = strings.TrimSpace(ch)
+		if ch == "" {
+			continue
+		}
+		if !isNotifyChannel(ch) {
+			return nil, fmt.Errorf("未知的通知渠道: %s", ch)
+		}
+		channels = append(channels, ch)
+	}
+	return channels, nil
+}
+
+// FormatNotificationRoute 将渠道列表保存为路由设置,没有渠道时保存为 none
+func FormatNotificationRoute(channels []string) string {
+	if len(channels) == 0 {
+		return notifyRouteNone
+	}
+	return strings.Join(channels, ",")
+}
+
+// NotificationRoutes 返回每个事件当前发送的渠道
+func NotificationRoutes() map[string][]string {
+	settings := loadSettingValues()
+
+	routes := make(map[string][]string, len(notificationEvents))
+	for _, e := range notificationEvents {
+		routes[e.Name] = notificationRoute(e, settings)
+	}
+	return routes
+}
+
+// NotifyAdmins 按事件路由将通知发送到对应的渠道
+// 未配置的渠道跳过,发送失败只记录日志
+func NotifyAdmins(event, subject, message string, payload map[string]interface{}) {
+	settings := loadSettingValues()
+
+	var channels []string
+	for _, e := range notificationEvents {
+		if e.Name == event {
+			channels = notificationRoute(e, settings)
+			break
+		}
+	}
+
+	n := Notification{Event: event, Subject: subject, Message: message, Payload: payload}
+	for _, ch := range channels {
+		notifier, err := newNotifier(ch, settings)
+		if errors.Is(err, ErrNotifierNotConfigured) {
+			continue
+		}
+		if err == nil {
+			err = notifier.Notify(n)
+		}
+		if err != nil {
+			log.Printf("发送 %s 通知到 %s 失败: %v", event, ch, err)
+		}
+	}
+}
+
+// SendTestNotification 通过指定渠道发送测试通知,返回具体的错误
+func SendTestNotification(channel string) error {
+	notifier, err := newNotifier(channel, loadSettingValues())
+	if err != nil {
+		return err
+	}
+	return notifier.Notify(Notification{
+		Event:   "test",
+		Subject: "测试通知",
+		Message: "这是一条测试通知，收到说明通知渠道配置正确。",
+	})
+}
+
+// notificationRoute 事件配置的渠道,未配置或配置有误时使用默认渠道
+func notificationRoute(e NotificationEvent, settings map[string]string) []string {
+	value := settings[NotificationRouteKey(e.Name)]
+	if value != "" {
+		if channels, err := ParseNotificationRoute(value); err == nil {
+			return channels
+		}
+	}
+	return append([]string{}, e.Defaults...)
+}
+
+func isNotifyChannel(channel string) bool {
+	for _, ch := range NotifyChannels() {
+		if ch == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// newNotifier 按设置创建通知渠道,缺少必要配置时返回 ErrNotifierNotConfigured
+func newNotifier(channel string, settings map[string]string) (Notifier, error) {
+	switch channel {
+	case NotifyChannelEmail:
+		return emailNotifier{}, nil
+	case NotifyChannelWebhook:
+		if settings["alert_webhook_url"] == "" {
+			return nil, fmt.Errorf("%w: 请填写告警 Webhook 地址", ErrNotifierNotConfigured)
+		}
+		return webhookNotifier{url: settings["alert_webhook_url"]}, nil
+	case NotifyChannelTelegram:
+		if settings["telegram_bot_token"] == "" || settings["telegram_chat_id"] == "" {
+			return nil, fmt.Errorf("%w: 请填写 Telegram 机器人令牌和会话 ID", ErrNotifierNotConfigured)
+		}
+		return newTelegramNotifier(settings["telegram_api_base_url"], settings["telegram_bot_token"], settings["telegram_chat_id"]), nil
+	}
+	return nil, fmt.Errorf("未知的通知渠道: %s", channel)
+}
+
+// loadSettingValues 读取全部设置项
+func loadSettingValues() map[string]string {
+	var settings []models.Setting
+	LoadFromFile(settingsFile, &settings)
+
+	values := make(map[string]string, len(settings))
+	for _, s := range settings {
+		values[s.Key] = s.Value
+	}
+	return values
+}
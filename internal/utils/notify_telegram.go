@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultTelegramAPIBaseURL Telegram Bot API 地址,可通过设置修改(如自建 Bot API 服务或测试服务器)
+const defaultTelegramAPIBaseURL = "https://api.telegram.org"
+
+// telegramMessageLimit 单条消息的截断长度,Telegram 限制为 4096 个字符
+const telegramMessageLimit = 4000
+
+// telegramNotifier 通过 Telegram 机器人发送消息
+type telegramNotifier struct {
+	baseURL string
+	token   string
+	chatID  string
+	client  *http.Client
+}
+
+func newTelegramNotifier(baseURL, token, chatID string) *telegramNotifier {
+	if baseURL == "" {
+		baseURL = defaultTelegramAPIBaseURL
+	}
+	return &telegramNotifier{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		chatID:  chatID,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Notify 调用 sendMessage 发送纯文本消息
+func (t *telegramNotifier) Notify(n Notification) error {
+	text := n.Subject
+	if n.Message != "" {
+		text += "\n\n" + n.Message
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"chat_id":                  t.chatID,
+		"text":                     truncateString(text, telegramMessageLimit),
+		"disable_web_page_preview": true,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := t.client.Post(t.baseURL+"/bot"+t.token+"/sendMessage", "application/json", bytes.NewReader(body))
+	if err != nil {
+		// 请求地址中包含机器人令牌,不能出现在错误信息中
+		return fmt.Errorf("请求 Telegram 失败: %s", strings.ReplaceAll(err.Error(), t.token, "***"))
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	json.Unmarshal(respBody, &result)
+	if resp.StatusCode != http.StatusOK || !result.OK {
+		if result.Description == "" {
+			result.Description = truncateString(strings.TrimSpace(string(respBody)), 500)
+		}
+		return fmt.Errorf("Telegram 返回 %s: %s", resp.Status, result.Description)
+	}
+	return nil
+}
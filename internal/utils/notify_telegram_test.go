@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testTelegramToken = "123456:SECRET-token"
+
+func TestTelegramNotifySuccess(t *testing.T) {
+	var got struct {
+		path string
+		body map[string]interface{}
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.path = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&got.body)
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1}}`))
+	}))
+	defer srv.Close()
+
+	n := newTelegramNotifier(srv.URL+"/", testTelegramToken, "-100200")
+	err := n.Notify(Notification{Subject: "新订单", Message: "订单 O1 已支付"})
+	if err != nil {
+		t.Fatalf("Notify 返回错误: %v", err)
+	}
+
+	if want := "/bot" + testTelegramToken + "/sendMessage"; got.path != want {
+		t.Errorf("请求路径为 %q,应为 %q", got.path, want)
+	}
+	if got.body["chat_id"] != "-100200" {
+		t.Errorf("chat_id 为 %v", got.body["chat_id"])
+	}
+	if got.body["text"] != "新订单\n\n订单 O1 已支付" {
+		t.Errorf("text 为 %q", got.body["text"])
+	}
+}
+
+func TestTelegramNotifyNotOK(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Telegram 在部分错误时仍返回 200,以 ok 字段表示结果
+		w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`))
+	}))
+	defer srv.Close()
+
+	err := newTelegramNotifier(srv.URL, testTelegramToken, "1").Notify(Notification{Subject: "测试"})
+	if err == nil {
+		t.Fatal("ok 为 false 时应返回错误")
+	}
+	if !strings.Contains(err.Error(), "chat not found") {
+		t.Errorf("错误信息应包含 Telegram 的说明: %v", err)
+	}
+}
+
+func TestTelegramNotifyRedactsToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 直接断开连接,请求错误中会带有包含令牌的地址
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer srv.Close()
+
+	err := newTelegramNotifier(srv.URL, testTelegramToken, "1").Notify(Notification{Subject: "测试"})
+	if err == nil {
+		t.Fatal("连接断开时应返回错误")
+	}
+	if strings.Contains(err.Error(), testTelegramToken) {
+		t.Errorf("错误信息包含机器人令牌: %v", err)
+	}
+	if !strings.Contains(err.Error(), "/bot***/sendMessage") {
+		t.Errorf("错误信息应包含隐藏令牌后的地址: %v", err)
+	}
+}
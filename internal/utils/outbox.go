@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"ai-hacker/internal/models"
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+const outboxFile = "data/outbox.json"
+
+// 发送队列参数
+const (
+	outboxMaxAttempts = 6                   // 超过后进入死信状态
+	outboxRetention   = 30 * 24 * time.Hour // 已发送邮件的保留时间
+)
+
+// ErrOutboxNotFound 队列中没有该邮件
+var ErrOutboxNotFound = errors.New("邮件不存在")
+
+// outbox 邮件发送队列,邮件未配置时保留在队列中,配置后再发送
+var outbox = newPersistentQueue(queueSpec[models.OutboxMessage]{
+	name:         "邮件",
+	file:         outboxFile,
+	workers:      2,
+	pollInterval: 10 * time.Second,
+	retryBase:    30 * time.Second,
+	retryMax:     time.Hour,
+	notFound:     ErrOutboxNotFound,
+	id:           func(m *models.OutboxMessage) string { return m.ID },
+	claim: func(m *models.OutboxMessage, now time.Time) bool {
+		if m.Status != models.OutboxStatusPending || m.NextAttemptAt.After(now) {
+			return false
+		}
+		m.Status = models.OutboxStatusSending
+		m.UpdatedAt = now
+		return true
+	},
+	expired: func(m *models.OutboxMessage, now time.Time) bool {
+		return m.Status == models.OutboxStatusSent && m.SentAt != nil && now.Sub(*m.SentAt) > outboxRetention
+	},
+	recover: func(m *models.OutboxMessage, now time.Time) bool {
+		if m.Status != models.OutboxStatusSending {
+			return false
+		}
+		m.Status = models.OutboxStatusPending
+		m.NextAttemptAt = now
+		return true
+	},
+	ready: EmailConfigured,
+})
+
+// EnqueueEmail 将邮件写入发送队列,由后台任务发送
+// 写入文件后返回,服务重启或 SMTP 暂时不可用都不会丢失
+func EnqueueEmail(msg models.OutboxMessage) (models.OutboxMessage, error) {
+	now := time.Now()
+	msg.ID = "M" + GenerateID()
+	msg.Status = models.OutboxStatusPending
+	msg.Attempts = 0
+	msg.NextAttemptAt = now
+	msg.CreatedAt = now
+	msg.UpdatedAt = now
+	if msg.UserID == "" {
+		msg.UserID = userIDByEmail(msg.To)
+	}
+
+	if err := outbox.add(msg); err != nil {
+		return msg, err
+	}
+
+	logQueuedEmail(msg)
+	return msg, nil
+}
+
+// ListOutbox 获取发送队列中的全部邮件
+func ListOutbox() ([]models.OutboxMessage, error) {
+	return outbox.list()
+}
+
+// RetryOutbox 立即重新发送等待重试或已进入死信状态的邮件,重试次数清零
+// render 不为 nil 时先重新生成邮件内容,返回错误时不重试
+func RetryOutbox(id string, render func(m *models.OutboxMessage) error) (models.OutboxMessage, error) {
+	var result models.OutboxMessage
+	err := outbox.update(id, func(m *models.OutboxMessage) error {
+		if m.Status != models.OutboxStatusPending && m.Status != models.OutboxStatusDead {
+			return errors.New("只能重试等待发送或发送失败的邮件")
+		}
+		if render != nil {
+			if err := render(m); err != nil {
+				return err
+			}
+		}
+		m.Status = models.OutboxStatusPending
+		m.Attempts = 0
+		m.NextAttemptAt = time.Now()
+		m.UpdatedAt = time.Now()
+		result = *m
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	logQueuedEmail(result)
+	outbox.wakeUp()
+	return result, nil
+}
+
+// StartOutbox 启动邮件发送任务,ctx 结束时不再取新邮件,正在发送的邮件会先完成
+// 上次退出时未发送完成的邮件重新加入队列,这些邮件可能已经发出,恢复后会再发送一次
+func StartOutbox(ctx context.Context) {
+	outbox.start(ctx, deliverOutbox)
+}
+
+// deliverOutbox 发送一封邮件并记录结果
+func deliverOutbox(msg models.OutboxMessage) {
+	response, transport, sendErr := sendMail(MailMessage{
+		To:      msg.To,
+		Subject: msg.Subject,
+		HTML:    msg.Body,
+		Text:    msg.Text,
+	})
+
+	logStatus := models.EmailLogStatusRetrying
+	attempts := msg.Attempts + 1
+	err := outbox.update(msg.ID, func(m *models.OutboxMessage) error {
+		now := time.Now()
+		m.Attempts++
+		m.UpdatedAt = now
+		attempts = m.Attempts
+
+		if sendErr == nil {
+			m.Status = models.OutboxStatusSent
+			m.LastError = ""
+			m.SentAt = &now
+			logStatus = models.EmailLogStatusSent
+			clearOutboxBody(m)
+			return nil
+		}
+
+		m.LastError = sendErr.Error()
+		if m.Attempts >= outboxMaxAttempts {
+			m.Status = models.OutboxStatusDead
+			logStatus = models.EmailLogStatusFailed
+			// 发货邮件重试时按订单重新生成,不必保留包含卡密的正文
+			if m.Type == models.OutboxTypeOrder {
+				clearOutboxBody(m)
+			}
+			log.Printf("邮件 %s 发送到 %s 失败 %d 次,已停止重试: %v", m.ID, m.To, m.Attempts, sendErr)
+			return nil
+		}
+		m.Status = models.OutboxStatusPending
+		m.NextAttemptAt = now.Add(outbox.backoff(m.Attempts))
+		log.Printf("邮件 %s 发送到 %s 失败,%s 后重试: %v", m.ID, m.To, outbox.backoff(m.Attempts), sendErr)
+		return nil
+	})
+	if err != nil {
+		log.Printf("更新邮件 %s 的发送状态失败: %v", msg.ID, err)
+	}
+	logEmailAttempt(msg.ID, logStatus, transport, response, sendErr, attempts)
+}
+
+// clearOutboxBody 清除邮件正文,发货邮件的正文包含卡密和下载链接,不在队列文件和备份中长期保存
+func clearOutboxBody(m *models.OutboxMessage) {
+	m.Body = ""
+	m.Text = ""
+}
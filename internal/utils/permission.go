@@ -34,6 +34,24 @@ func GetRolePermissions(roleID int) []string {
 	return []string{}
 }
 
+// RoleExists 检查角色是否存在,系统默认角色 (1, 2, 3) 始终存在
+func RoleExists(roleID int) bool {
+	if roleID >= 1 && roleID <= 3 {
+		return true
+	}
+
+	var roles []models.Role
+	LoadFromFile(rolesFile, &roles)
+
+	for _, role := range roles {
+		if role.ID == roleID {
+			return true
+		}
+	}
+
+	return false
+}
+
 // HasPermission 检查角色是否拥有指定权限
 // 支持权限继承：manage 权限自动包含 view 权限
 func HasPermission(roleID int, permission string) bool {
@@ -0,0 +1,221 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// queueSpec 持久化队列的参数和任务状态的处理方式
+type queueSpec[T any] struct {
+	name         string        // 日志中的队列名称
+	file         string        // 队列文件
+	workers      int           // 并发处理数
+	pollInterval time.Duration // 检查到期任务的间隔
+	retryBase    time.Duration // 首次重试间隔,之后每次翻倍
+	retryMax     time.Duration // 最长重试间隔
+	notFound     error         // 任务不存在时返回的错误
+
+	id func(t *T) string
+	// claim 任务到期时标记为处理中并返回 true
+	claim func(t *T, now time.Time) bool
+	// expired 任务已完成且超过保留时间,取任务时一并清理
+	expired func(t *T, now time.Time) bool
+	// recover 将上次退出时处理中的任务恢复为等待处理,返回是否恢复
+	recover func(t *T, now time.Time) bool
+	// ready 为 nil 或返回 true 时才取任务,未就绪的任务保留在队列中
+	ready func() bool
+}
+
+// persistentQueue 保存在文件中的任务队列,服务重启后继续处理
+// 任务由后台任务按到期时间取出处理,失败后按指数退避重试
+type persistentQueue[T any] struct {
+	queueSpec[T]
+	mu   sync.Mutex    // 保护队列文件的读改写
+	wake chan struct{} // 有新任务时唤醒后台任务
+}
+
+// newPersistentQueue 创建持久化队列
+func newPersistentQueue[T any](spec queueSpec[T]) *persistentQueue[T] {
+	return &persistentQueue[T]{queueSpec: spec, wake: make(chan struct{}, 1)}
+}
+
+// add 将任务写入队列并唤醒后台任务
+func (q *persistentQueue[T]) add(items ...T) error {
+	err := q.modify(func(all []T) ([]T, error) {
+		return append(all, items...), nil
+	})
+	if err != nil {
+		return err
+	}
+	q.wakeUp()
+	return nil
+}
+
+// list 获取队列中的全部任务
+func (q *persistentQueue[T]) list() ([]T, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var items []T
+	if err := LoadFromFile(q.file, &items); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return items, nil
+}
+
+// modify 读取全部任务交给 fn 修改后保存,fn 返回错误时不保存
+func (q *persistentQueue[T]) modify(fn func(all []T) ([]T, error)) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var items []T
+	LoadFromFile(q.file, &items)
+	items, err := fn(items)
+	if err != nil {
+		return err
+	}
+	return SaveToFile(q.file, items)
+}
+
+// update 修改队列中的一个任务,fn 返回错误时不保存
+func (q *persistentQueue[T]) update(id string, fn func(t *T) error) error {
+	return q.modify(func(all []T) ([]T, error) {
+		for i := range all {
+			if q.id(&all[i]) == id {
+				return all, fn(&all[i])
+			}
+		}
+		return nil, q.notFound
+	})
+}
+
+// wakeUp 通知后台任务检查队列
+func (q *persistentQueue[T]) wakeUp() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// backoff 第 attempts 次失败后的重试间隔
+func (q *persistentQueue[T]) backoff(attempts int) time.Duration {
+	delay := q.retryBase
+	for i := 1; i < attempts && delay < q.retryMax; i++ {
+		delay *= 2
+	}
+	if delay > q.retryMax {
+		delay = q.retryMax
+	}
+	return delay
+}
+
+// start 启动后台任务,由 process 处理取出的任务并通过 update 记录结果
+// ctx 结束时不再取新任务,正在处理的任务会先完成;上次退出时未处理完成的任务重新加入队列
+func (q *persistentQueue[T]) start(ctx context.Context, process func(t T)) {
+	q.recoverAll()
+
+	jobs := make(chan T)
+	for i := 0; i < q.workers; i++ {
+		Go(func() {
+			for t := range jobs {
+				process(t)
+			}
+		})
+	}
+
+	Go(func() {
+		defer close(jobs)
+
+		ticker := time.NewTicker(q.pollInterval)
+		defer ticker.Stop()
+
+		for {
+			if ctx.Err() == nil && (q.ready == nil || q.ready()) {
+			dispatch:
+				for {
+					batch := q.claimDue(q.workers)
+					if len(batch) == 0 {
+						break
+					}
+					for _, t := range batch {
+						select {
+						case jobs <- t:
+						case <-ctx.Done():
+							// 未交给后台任务的任务在下次启动时恢复
+							break dispatch
+						}
+					}
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-q.wake:
+			}
+		}
+	})
+}
+
+// claimDue 取出最多 n 个到期的任务并标记为处理中,同时清理过期的已完成任务
+func (q *persistentQueue[T]) claimDue(n int) []T {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var items []T
+	if err := LoadFromFile(q.file, &items); err != nil {
+		return nil
+	}
+
+	now := time.Now()
+	var claimed []T
+	kept := items[:0]
+	pruned := false
+	for _, t := range items {
+		if q.expired(&t, now) {
+			pruned = true
+			continue
+		}
+		if len(claimed) < n && q.claim(&t, now) {
+			claimed = append(claimed, t)
+		}
+		kept = append(kept, t)
+	}
+
+	if len(claimed) > 0 || pruned {
+		if err := SaveToFile(q.file, kept); err != nil {
+			log.Printf("保存%s队列失败: %v", q.name, err)
+			return nil
+		}
+	}
+	return claimed
+}
+
+// recoverAll 将上次退出时处理中的任务恢复为等待处理
+// 这些任务可能已经完成,恢复后会再处理一次
+func (q *persistentQueue[T]) recoverAll() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var items []T
+	if err := LoadFromFile(q.file, &items); err != nil {
+		return
+	}
+
+	now := time.Now()
+	recovered := 0
+	for i := range items {
+		if q.recover(&items[i], now) {
+			recovered++
+		}
+	}
+	if recovered > 0 {
+		SaveToFile(q.file, items)
+		log.Printf("恢复 %d 个未处理完成的%s", recovered, q.name)
+	}
+}
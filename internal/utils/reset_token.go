@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"sync"
@@ -40,9 +41,6 @@ func GenerateResetToken(email string) (string, error) {
 	}
 	resetTokenStore.mu.Unlock()
 
-	// 启动清理过期令牌
-	go cleanExpiredTokens()
-
 	return token, nil
 }
 
@@ -72,17 +70,31 @@ func DeleteResetToken(token string) {
 
 // cleanExpiredTokens 清理过期令牌
 func cleanExpiredTokens() {
-	ticker := time.NewTicker(5 * time.Minute)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		resetTokenStore.mu.Lock()
-		now := time.Now()
-		for token, resetToken := range resetTokenStore.tokens {
-			if now.After(resetToken.ExpiresAt) {
-				delete(resetTokenStore.tokens, token)
-			}
+	resetTokenStore.mu.Lock()
+	defer resetTokenStore.mu.Unlock()
+
+	now := time.Now()
+	for token, resetToken := range resetTokenStore.tokens {
+		if now.After(resetToken.ExpiresAt) {
+			delete(resetTokenStore.tokens, token)
 		}
-		resetTokenStore.mu.Unlock()
 	}
 }
+
+// StartTokenCleanup 启动过期重置令牌和验证码的清理任务,ctx 结束时退出
+func StartTokenCleanup(ctx context.Context) {
+	Go(func() {
+		ticker := time.NewTicker(5 * time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				cleanExpiredTokens()
+				CleanExpiredCodes()
+			}
+		}
+	})
+}
@@ -93,19 +93,20 @@ func CleanExpiredCodes() {
 
 // SendVerifyCodeEmail 发送验证码邮件
 func SendVerifyCodeEmail(email, code string) error {
-	siteName := GetSiteName()
-	subject := siteName + " - 注册验证码"
-	body := fmt.Sprintf(`
-		<div style="font-family: Arial, sans-serif; max-width: 600px; margin: 0 auto;">
-			<h2 style="color: #000;">注册验证码</h2>
-			<p>您正在注册 %s 账号，验证码为：</p>
-			<div style="background-color: #f5f5f5; padding: 20px; text-align: center; font-size: 32px; font-weight: bold; letter-spacing: 5px; margin: 20px 0;">
-				%s
-			</div>
-			<p style="color: #666;">验证码有效期为 5 分钟，请尽快完成注册。</p>
-			<p style="color: #999; font-size: 12px;">如果这不是您的操作，请忽略此邮件。</p>
-		</div>
-	`, siteName, code)
-	
-	return SendEmail(email, subject, body)
+	data := NewEmailData(email)
+	data.Code = code
+	data.ValidFor = "5 分钟"
+
+	rendered, err := RenderEmail(EmailTemplateVerifyCode, data)
+	if err != nil {
+		return err
+	}
+	_, err = SendMail(MailMessage{
+		To:      email,
+		Subject: rendered.Subject,
+		HTML:    rendered.HTML,
+		Text:    rendered.Text,
+		Type:    EmailTemplateVerifyCode,
+	})
+	return err
 }
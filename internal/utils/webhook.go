@@ -0,0 +1,337 @@
+package utils
+
+import (
+	"ai-hacker/internal/models"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	webhooksFile          = "data/webhooks.json"
+	webhookDeliveriesFile = "data/webhook_deliveries.json"
+)
+
+// Webhook 推送参数
+const (
+	webhookMaxAttempts   = 8                   // 超过后停止重试
+	webhookTimeout       = 10 * time.Second    // 单次推送的超时时间
+	webhookRetention     = 30 * 24 * time.Hour // 已完成推送的保留时间
+	webhookResponseLimit = 1024                // 记录的响应内容长度
+)
+
+// 推送请求头
+const (
+	WebhookHeaderEvent     = "X-Webhook-Event"
+	WebhookHeaderDelivery  = "X-Webhook-Delivery"
+	WebhookHeaderTimestamp = "X-Webhook-Timestamp"
+	WebhookHeaderSignature = "X-Webhook-Signature"
+)
+
+// webhookClient 推送使用的 HTTP 客户端
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// ErrWebhookDeliveryNotFound 推送记录不存在
+var ErrWebhookDeliveryNotFound = errors.New("推送记录不存在")
+
+// webhookQueue Webhook 推送队列
+var webhookQueue = newPersistentQueue(queueSpec[models.WebhookDelivery]{
+	name:         "Webhook 推送",
+	file:         webhookDeliveriesFile,
+	workers:      2,
+	pollInterval: 10 * time.Second,
+	retryBase:    30 * time.Second,
+	retryMax:     2 * time.Hour,
+	notFound:     ErrWebhookDeliveryNotFound,
+	id:           func(d *models.WebhookDelivery) string { return d.ID },
+	claim: func(d *models.WebhookDelivery, now time.Time) bool {
+		if d.Status != models.WebhookDeliveryPending || d.NextAttemptAt.After(now) {
+			return false
+		}
+		d.Status = models.WebhookDeliverySending
+		d.UpdatedAt = now
+		return true
+	},
+	expired: func(d *models.WebhookDelivery, now time.Time) bool {
+		finished := d.Status == models.WebhookDeliveryDelivered || d.Status == models.WebhookDeliveryDead
+		return finished && now.Sub(d.UpdatedAt) > webhookRetention
+	},
+	recover: func(d *models.WebhookDelivery, now time.Time) bool {
+		if d.Status != models.WebhookDeliverySending {
+			return false
+		}
+		d.Status = models.WebhookDeliveryPending
+		d.NextAttemptAt = now
+		return true
+	},
+})
+
+// webhookEvents 可以订阅的事件
+var webhookEvents = []string{
+	models.WebhookEventOrderCreated,
+	models.WebhookEventOrderPaid,
+	models.WebhookEventOrderRefunded,
+	models.WebhookEventStockLow,
+	models.WebhookEventUserRegistered,
+	models.WebhookEventCardKeyImported,
+}
+
+// WebhookEvents 返回可以订阅的事件
+func WebhookEvents() []string {
+	return append([]string(nil), webhookEvents...)
+}
+
+// IsWebhookEvent 是否为可以订阅的事件
+func IsWebhookEvent(event string) bool {
+	for _, e := range webhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateWebhookSecret 生成 Webhook 签名密钥
+func GenerateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// SignWebhookPayload 计算推送签名: HMAC-SHA256(secret, "<timestamp>.<body>") 的十六进制
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// PublishWebhookEvent 为订阅了该事件的 Webhook 生成推送,由后台任务发送和重试
+// 推送写入队列后返回,不影响业务流程,失败时只记录日志
+func PublishWebhookEvent(event string, data interface{}) {
+	var hooks []models.Webhook
+	LoadFromFile(webhooksFile, &hooks)
+
+	var targets []models.Webhook
+	for _, hook := range hooks {
+		if hook.Active && hookSubscribes(hook, event) {
+			targets = append(targets, hook)
+		}
+	}
+	if len(targets) == 0 {
+		return
+	}
+
+	if _, err := enqueueWebhookEvent(targets, event, data); err != nil {
+		log.Printf("Webhook 事件 %s 加入推送队列失败: %v", event, err)
+	}
+}
+
+// PingWebhook 向指定的 Webhook 发送测试推送
+func PingWebhook(hook models.Webhook) (models.WebhookDelivery, error) {
+	deliveries, err := enqueueWebhookEvent([]models.Webhook{hook}, models.WebhookEventPing, map[string]interface{}{
+		"webhook_id": hook.ID,
+		"events":     hook.Events,
+	})
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+	return deliveries[0], nil
+}
+
+// RedeliverWebhook 使用原推送的内容重新推送一次,生成新的推送记录
+func RedeliverWebhook(id string) (models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	err := webhookQueue.modify(func(deliveries []models.WebhookDelivery) ([]models.WebhookDelivery, error) {
+		var original *models.WebhookDelivery
+		for i := range deliveries {
+			if deliveries[i].ID == id {
+				original = &deliveries[i]
+				break
+			}
+		}
+		if original == nil {
+			return nil, ErrWebhookDeliveryNotFound
+		}
+
+		now := time.Now()
+		d = models.WebhookDelivery{
+			ID:            "WD" + GenerateID(),
+			WebhookID:     original.WebhookID,
+			URL:           original.URL,
+			Event:         original.Event,
+			EventID:       original.EventID,
+			Payload:       original.Payload,
+			Status:        models.WebhookDeliveryPending,
+			RedeliveryOf:  original.ID,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		return append(deliveries, d), nil
+	})
+	if err != nil {
+		return d, err
+	}
+
+	webhookQueue.wakeUp()
+	return d, nil
+}
+
+// ListWebhookDeliveries 获取全部推送记录
+func ListWebhookDeliveries() ([]models.WebhookDelivery, error) {
+	return webhookQueue.list()
+}
+
+// StartWebhooks 启动 Webhook 推送任务,ctx 结束时不再取新推送,正在进行的推送会先完成
+// 上次退出时未完成的推送重新加入队列
+func StartWebhooks(ctx context.Context) {
+	webhookQueue.start(ctx, deliverWebhook)
+}
+
+// hookSubscribes Webhook 是否订阅了该事件
+func hookSubscribes(hook models.Webhook, event string) bool {
+	for _, e := range hook.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// enqueueWebhookEvent 为每个 Webhook 生成一条推送,同一事件的推送内容和事件 ID 相同
+func enqueueWebhookEvent(hooks []models.Webhook, event string, data interface{}) ([]models.WebhookDelivery, error) {
+	now := time.Now()
+	eventID := "EV" + GenerateID()
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":         eventID,
+		"event":      event,
+		"created_at": now.Format(time.RFC3339),
+		"data":       data,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var created []models.WebhookDelivery
+	for _, hook := range hooks {
+		created = append(created, models.WebhookDelivery{
+			ID:            "WD" + GenerateID(),
+			WebhookID:     hook.ID,
+			URL:           hook.URL,
+			Event:         event,
+			EventID:       eventID,
+			Payload:       string(payload),
+			Status:        models.WebhookDeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		})
+	}
+
+	if err := webhookQueue.add(created...); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// deliverWebhook 推送一次并记录结果
+func deliverWebhook(d models.WebhookDelivery) {
+	attempt := postWebhook(d)
+
+	err := webhookQueue.update(d.ID, func(w *models.WebhookDelivery) error {
+		now := time.Now()
+		w.Attempts = append(w.Attempts, attempt)
+		w.UpdatedAt = now
+
+		if attempt.Error == "" {
+			w.Status = models.WebhookDeliveryDelivered
+			w.DeliveredAt = &now
+			return nil
+		}
+		if len(w.Attempts) >= webhookMaxAttempts {
+			w.Status = models.WebhookDeliveryDead
+			log.Printf("Webhook 推送 %s (%s) 失败 %d 次,已停止重试: %s", w.ID, w.Event, len(w.Attempts), attempt.Error)
+			return nil
+		}
+		w.Status = models.WebhookDeliveryPending
+		w.NextAttemptAt = now.Add(webhookQueue.backoff(len(w.Attempts)))
+		return nil
+	})
+	if err != nil {
+		log.Printf("更新 Webhook 推送 %s 的状态失败: %v", d.ID, err)
+	}
+}
+
+// postWebhook 发送推送请求,使用发送时 Webhook 的地址和密钥
+func postWebhook(d models.WebhookDelivery) models.WebhookAttempt {
+	start := time.Now()
+	attempt := models.WebhookAttempt{At: start}
+	fail := func(err error) models.WebhookAttempt {
+		attempt.Error = err.Error()
+		attempt.DurationMs = time.Since(start).Milliseconds()
+		return attempt
+	}
+
+	hook, ok := findWebhook(d.WebhookID)
+	if !ok {
+		return fail(errors.New("Webhook 已删除"))
+	}
+	if !hook.Active && d.Event != models.WebhookEventPing {
+		return fail(errors.New("Webhook 已停用"))
+	}
+
+	body := []byte(d.Payload)
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return fail(err)
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "AI-HACKER-Webhook")
+	req.Header.Set(WebhookHeaderEvent, d.Event)
+	req.Header.Set(WebhookHeaderDelivery, d.ID)
+	req.Header.Set(WebhookHeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookHeaderSignature, SignWebhookPayload(hook.Secret, timestamp, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return fail(err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseLimit))
+
+	attempt.StatusCode = resp.StatusCode
+	attempt.ResponseBody = string(respBody)
+	attempt.DurationMs = time.Since(start).Milliseconds()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		attempt.Error = fmt.Sprintf("接收方返回状态码 %d", resp.StatusCode)
+	}
+	return attempt
+}
+
+// findWebhook 按 ID 查找 Webhook
+func findWebhook(id string) (models.Webhook, bool) {
+	var hooks []models.Webhook
+	LoadFromFile(webhooksFile, &hooks)
+	for _, hook := range hooks {
+		if hook.ID == id {
+			return hook, true
+		}
+	}
+	return models.Webhook{}, false
+}
@@ -6,15 +6,23 @@ import (
 	"ai-hacker/internal/middleware"
 	"ai-hacker/internal/models"
 	"ai-hacker/internal/utils"
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	// 子命令,不带命令或使用 serve 时启动服务
+	if len(os.Args) > 1 && os.Args[1] != "serve" {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
 	// 加载配置
 	cfg, err := config.LoadConfig("config.json")
 	if err != nil {
@@ -31,6 +39,26 @@ func main() {
 	// 初始化数据目录
 	initDataDir()
 
+	// 定时任务在关闭服务时通过 jobsCtx 退出
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	// 启动卡密过期处理任务
+	handlers.StartCardKeyExpiryJob(jobsCtx)
+
+	// 启动回收站清理任务
+	handlers.StartTrashPurgeJob(jobsCtx)
+
+	// 启动定时备份任务
+	handlers.StartBackupJob(jobsCtx)
+
+	// 启动过期验证码和重置令牌清理任务
+	utils.StartTokenCleanup(jobsCtx)
+
+	// 启动邮件发送任务
+	utils.StartOutbox(jobsCtx)
+	utils.StartWebhooks(jobsCtx)
+
 	// 设置 Gin 模式
 	gin.SetMode(cfg.Server.Mode)
 
@@ -41,6 +69,15 @@ func main() {
 
 	// 创建限流器：每个 IP 每分钟最多 20 次请求
 	limiter := middleware.NewRateLimiter(20, time.Minute)
+	defer limiter.Stop()
+
+	// 认证相关限流器：每个 IP 每分钟最多 10 次请求
+	authLimiter := middleware.NewRateLimiter(10, time.Minute)
+	defer authLimiter.Stop()
+
+	// 创建订单严格限流：每个 IP 每分钟最多 5 次
+	orderLimiter := middleware.NewRateLimiter(5, time.Minute)
+	defer orderLimiter.Stop()
 
 	// API 路由
 	api := router.Group("/api")
@@ -101,16 +138,18 @@ func main() {
 		
 		// 商品查询不限流
 		api.GET("/products", handlers.GetProducts)
+		api.POST("/products/:id/subscribe", middleware.RateLimit(limiter), handlers.SubscribeRestock)
 		
 		// 订单相关限流
 		api.GET("/orders", middleware.RateLimit(limiter), handlers.GetOrders)
 		
-		// 创建订单严格限流：每分钟最多 5 次
-		orderLimiter := middleware.NewRateLimiter(5, time.Minute)
+		// 创建订单严格限流
 		api.POST("/orders", middleware.RateLimit(orderLimiter), handlers.CreateOrder)
 		
+		// 文件类卡密下载(签名链接)
+		api.GET("/downloads/:id", middleware.RateLimit(limiter), handlers.DownloadOrderFile)
+		
 		// 认证相关限流
-		authLimiter := middleware.NewRateLimiter(10, time.Minute)
 		api.POST("/send-verify-code", middleware.RateLimit(authLimiter), handlers.SendVerifyCode)
 		api.POST("/register", middleware.RateLimit(authLimiter), handlers.Register)
 		api.POST("/login", middleware.RateLimit(authLimiter), handlers.Login)
@@ -122,15 +161,30 @@ func main() {
 		
 		// 管理员接口 - 需要管理员权限
 		admin := api.Group("/admin")
-		admin.Use(middleware.AdminAuth())
+		admin.Use(middleware.AdminAuth(), middleware.AuditLog())
 		{
+			// 销售统计
+			admin.GET("/stats", middleware.RequirePermission("order:view"), handlers.GetStatsOverview)
+			admin.GET("/stats/sales", middleware.RequirePermission("order:view"), handlers.GetSalesStats)
+			admin.GET("/stats/products", middleware.RequirePermission("order:view"), handlers.GetTopProducts)
+			admin.GET("/stats/stock", middleware.RequirePermission("order:view"), handlers.GetStockStats)
+
+			// 实时事件 (Server-Sent Events)
+			admin.GET("/events", middleware.RequirePermission("order:view"), handlers.StreamAdminEvents)
+
 			// 订单管理
 			admin.GET("/orders", middleware.RequirePermission("order:view"), handlers.GetAllOrders)
+			admin.GET("/export/orders", middleware.RequirePermission("order:view"), handlers.ExportOrders)
 			admin.PUT("/orders/:id", middleware.RequirePermission("order:manage"), handlers.UpdateOrder)
 			admin.DELETE("/orders/:id", middleware.RequirePermission("order:manage"), handlers.DeleteOrder)
+			admin.POST("/orders/:id/replace-key", middleware.RequirePermission("order:manage"), handlers.ReplaceOrderKey)
+			admin.POST("/orders/:id/refund", middleware.RequirePermission("order:manage"), handlers.RefundOrder)
+			admin.POST("/orders/:id/cancel", middleware.RequirePermission("order:manage"), handlers.CancelOrder)
+			admin.POST("/orders/:id/resend-email", middleware.RequirePermission("order:manage"), handlers.ResendOrderEmail)
 			
 			// 用户管理
 			admin.GET("/users", middleware.RequirePermission("user:manage"), handlers.GetAllUsers)
+			admin.GET("/export/users", middleware.RequirePermission("user:manage"), handlers.ExportUsers)
 			admin.POST("/users", middleware.RequirePermission("user:manage"), handlers.CreateUser)
 			admin.PUT("/users/:id", middleware.RequirePermission("user:manage"), handlers.UpdateUser)
 			admin.DELETE("/users/:id", middleware.RequirePermission("user:manage"), handlers.DeleteUser)
@@ -139,11 +193,32 @@ func main() {
 			admin.POST("/products", middleware.RequirePermission("product:manage"), handlers.CreateProduct)
 			admin.PUT("/products/:id", middleware.RequirePermission("product:manage"), handlers.UpdateProduct)
 			admin.DELETE("/products/:id", middleware.RequirePermission("product:manage"), handlers.DeleteProduct)
+			admin.POST("/products/:id/delivery-preview", middleware.RequirePermission("product:manage"), handlers.PreviewDeliveryTemplate)
 			
 			// 卡密管理
 			admin.GET("/cardkeys", middleware.RequirePermission("cardkey:manage"), handlers.GetCardKeys)
+			admin.GET("/export/cardkeys", middleware.RequirePermission("cardkey:manage"), handlers.ExportCardKeys)
 			admin.POST("/cardkeys", middleware.RequirePermission("cardkey:manage"), handlers.CreateCardKey)
+			admin.POST("/cardkeys/import", middleware.RequirePermission("cardkey:manage"), handlers.ImportCardKeys)
+			admin.POST("/cardkeys/upload", middleware.RequirePermission("cardkey:manage"), handlers.UploadCardKeyFiles)
 			admin.DELETE("/cardkeys/:id", middleware.RequirePermission("cardkey:manage"), handlers.DeleteCardKey)
+			admin.GET("/cardkeys/expiry-reports", middleware.RequirePermission("cardkey:manage"), handlers.GetExpiryReports)
+			admin.POST("/cardkeys/:id/reveal", middleware.RequirePermission("cardkey:reveal"), handlers.RevealCardKey)
+			admin.GET("/cardkeys/reveals", middleware.RequirePermission("audit:view"), handlers.GetKeyReveals)
+
+			// 审计日志
+			admin.GET("/audit-logs", middleware.RequirePermission("audit:view"), handlers.GetAuditLogs)
+			admin.GET("/audit-logs/verify", middleware.RequirePermission("audit:view"), handlers.VerifyAuditLog)
+
+			// 回收站
+			admin.GET("/trash/orders", middleware.RequirePermission("order:manage"), handlers.GetTrashOrders)
+			admin.POST("/trash/orders/:id/restore", middleware.RequirePermission("order:manage"), handlers.RestoreOrder)
+			admin.GET("/trash/users", middleware.RequirePermission("user:manage"), handlers.GetTrashUsers)
+			admin.POST("/trash/users/:id/restore", middleware.RequirePermission("user:manage"), handlers.RestoreUser)
+			admin.GET("/trash/products", middleware.RequirePermission("product:manage"), handlers.GetTrashProducts)
+			admin.POST("/trash/products/:id/restore", middleware.RequirePermission("product:manage"), handlers.RestoreProduct)
+			admin.GET("/trash/cardkeys", middleware.RequirePermission("cardkey:manage"), handlers.GetTrashCardKeys)
+			admin.POST("/trash/cardkeys/:id/restore", middleware.RequirePermission("cardkey:manage"), handlers.RestoreCardKey)
 			
 			// 角色管理
 			admin.GET("/roles", middleware.RequirePermission("role:manage"), handlers.GetAllRoles)
@@ -151,12 +226,41 @@ func main() {
 			admin.PUT("/roles/:id", middleware.RequirePermission("role:manage"), handlers.UpdateRole)
 			admin.DELETE("/roles/:id", middleware.RequirePermission("role:manage"), handlers.DeleteRole)
 			
+			// 数据备份
+			admin.GET("/backups", middleware.RequirePermission("system:manage"), handlers.GetBackups)
+			admin.POST("/backups", middleware.RequirePermission("system:manage"), handlers.CreateBackup)
+			admin.GET("/backups/:name", middleware.RequirePermission("system:manage"), handlers.DownloadBackup)
+
+			// 邮件发送队列
+			admin.GET("/outbox", middleware.RequirePermission("system:manage"), handlers.GetOutbox)
+			admin.POST("/outbox/:id/retry", middleware.RequirePermission("system:manage"), handlers.RetryOutboxMessage)
+			admin.GET("/email-logs", middleware.RequirePermission("order:manage"), handlers.GetEmailLogs)
+
+			// Webhook 事件推送
+			admin.GET("/webhooks", middleware.RequirePermission("system:manage"), handlers.GetWebhooks)
+			admin.POST("/webhooks", middleware.RequirePermission("system:manage"), handlers.CreateWebhook)
+			admin.PUT("/webhooks/:id", middleware.RequirePermission("system:manage"), handlers.UpdateWebhook)
+			admin.DELETE("/webhooks/:id", middleware.RequirePermission("system:manage"), handlers.DeleteWebhook)
+			admin.POST("/webhooks/:id/ping", middleware.RequirePermission("system:manage"), handlers.PingWebhook)
+			admin.GET("/webhooks/deliveries", middleware.RequirePermission("system:manage"), handlers.GetWebhookDeliveries)
+			admin.GET("/webhooks/deliveries/:id", middleware.RequirePermission("system:manage"), handlers.GetWebhookDelivery)
+			admin.POST("/webhooks/deliveries/:id/redeliver", middleware.RequirePermission("system:manage"), handlers.RedeliverWebhook)
+
 			// 系统设置
 			admin.GET("/settings", middleware.RequirePermission("system:manage"), handlers.GetSettings)
 			admin.PUT("/settings/email", middleware.RequirePermission("system:manage"), handlers.UpdateEmailConfig)
 			admin.PUT("/settings/site", middleware.RequirePermission("system:manage"), handlers.UpdateSiteConfig)
 			admin.PUT("/settings/legal", middleware.RequirePermission("system:manage"), handlers.UpdateLegalConfig)
+			admin.PUT("/settings/alerts", middleware.RequirePermission("system:manage"), handlers.UpdateAlertConfig)
 			admin.POST("/settings/test-email", middleware.RequirePermission("system:manage"), handlers.TestEmail)
+			admin.PUT("/settings/notifications", middleware.RequirePermission("system:manage"), handlers.UpdateNotificationConfig)
+			admin.POST("/settings/test-notification", middleware.RequirePermission("system:manage"), handlers.TestNotification)
+
+			// 邮件模板
+			admin.GET("/email-templates", middleware.RequirePermission("system:manage"), handlers.GetEmailTemplates)
+			admin.PUT("/email-templates/:name", middleware.RequirePermission("system:manage"), handlers.UpdateEmailTemplate)
+			admin.POST("/email-templates/:name/preview", middleware.RequirePermission("system:manage"), handlers.PreviewEmailTemplate)
+			admin.POST("/email-templates/:name/reset", middleware.RequirePermission("system:manage"), handlers.ResetEmailTemplate)
 		}
 	}
 
@@ -176,7 +280,40 @@ func main() {
 	router.StaticFile("/admin", "./static/admin.html")
 	router.StaticFile("/admin.html", "./static/admin.html")
 
-	router.Run(":" + cfg.Server.Port)
+	srv := &http.Server{
+		Addr:    ":" + cfg.Server.Port,
+		Handler: router,
+	}
+	// 关闭服务时先结束实时事件的长连接,否则 Shutdown 会一直等待
+	srv.RegisterOnShutdown(utils.CloseAdminEvents)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("启动服务失败: %v", err)
+		}
+	}()
+
+	// 收到 SIGINT/SIGTERM 后停止接收新请求,等待处理中的请求和后台任务完成
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	sig := <-quit
+	timeout := cfg.GetShutdownTimeout()
+	log.Printf("收到信号 %v,正在关闭服务 (最长等待 %v)...", sig, timeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("等待请求完成超时,强制关闭未完成的连接: %v", err)
+		srv.Close()
+	}
+
+	// 停止定时任务,等待邮件、告警等后台任务完成
+	stopJobs()
+	if err := utils.WaitBackground(ctx); err != nil {
+		log.Printf("等待后台任务超时,部分邮件或通知可能未发送: %v", err)
+	}
+
+	log.Println("服务已关闭")
 }
 
 // 初始化数据目录
@@ -192,6 +329,23 @@ func initDataDir() {
 	utils.InitFileIfNotExists("data/roles.json", []models.Role{})
 	utils.InitFileIfNotExists("data/card_keys.json", []models.CardKey{})
 	utils.InitFileIfNotExists("data/settings.json", []models.Setting{})
+	utils.InitFileIfNotExists("data/files.json", []models.DeliveryFile{})
+	utils.InitFileIfNotExists("data/expiry_reports.json", []models.ExpiryReport{})
+	utils.InitFileIfNotExists("data/stock_subscriptions.json", []models.StockSubscription{})
+	utils.InitFileIfNotExists("data/key_reveals.json", []models.KeyReveal{})
+	utils.InitFileIfNotExists("data/outbox.json", []models.OutboxMessage{})
+	utils.InitFileIfNotExists("data/email_log.json", []models.EmailLog{})
+	utils.InitFileIfNotExists("data/webhooks.json", []models.Webhook{})
+	utils.InitFileIfNotExists("data/webhook_deliveries.json", []models.WebhookDelivery{})
+
+	// 执行数据迁移,旧格式的数据无法被正确读取,迁移失败时不启动服务
+	results, err := applyMigrations()
+	if err != nil {
+		log.Fatalf("数据迁移失败: %v\n可执行 migrate -dry-run 查看需要修改的数据", err)
+	}
+	for _, result := range results {
+		log.Printf("数据迁移 %d: %s,%d 处修改", result.Version, result.Name, len(result.Changes))
+	}
 	
 	// 检查并创建超级管理员
 	ensureSuperAdmin()
@@ -220,10 +374,11 @@ func ensureSuperAdmin() {
 		}
 		
 		superAdmin := models.User{
-			ID:       "super_admin_001",
-			Email:    "admin@aihacker.com",
-			Password: hashedPassword,
-			Role:     3,
+			ID:        "super_admin_001",
+			Email:     "admin@aihacker.com",
+			Password:  hashedPassword,
+			Role:      3,
+			CreatedAt: time.Now(),
 		}
 		
 		users = append(users, superAdmin)
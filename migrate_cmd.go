@@ -0,0 +1,110 @@
+package main
+
+import (
+	"ai-hacker/internal/backup"
+	"ai-hacker/internal/handlers"
+	"ai-hacker/internal/migrate"
+	"fmt"
+	"log"
+)
+
+// 每个迁移最多输出的修改条数,-v 时全部输出
+const migrateOutputLimit = 20
+
+// runMigrate 执行数据迁移: ai-hacker migrate [-dry-run] [-v]
+// 服务启动时也会自动执行,命令行适合升级前预览或在服务停止时执行
+func runMigrate(args []string) int {
+	c := newCLI("migrate", "[-dry-run] [-v]")
+	dryRun := c.flags.Bool("dry-run", false, "只列出将要进行的修改,不写入数据")
+	verbose := c.flags.Bool("v", false, "输出全部修改")
+	if !c.parse(args, 0) {
+		return exitUsage
+	}
+
+	_, state, err := migrate.Pending()
+	if err != nil {
+		return c.fail(fmt.Errorf("数据迁移失败: %v", err))
+	}
+
+	limit := migrateOutputLimit
+	if *verbose {
+		limit = -1
+	}
+
+	var results []migrate.Result
+	if *dryRun {
+		results, err = migrate.Plan()
+	} else {
+		results, err = applyMigrations()
+	}
+	if results == nil {
+		results = []migrate.Result{}
+	}
+
+	output := map[string]interface{}{
+		"version":    state.Version,
+		"latest":     migrate.Latest(),
+		"dry_run":    *dryRun,
+		"migrations": results,
+	}
+	if err != nil {
+		output["error"] = err.Error()
+	}
+	c.output(output, func() {
+		fmt.Printf("当前数据版本 %d,程序支持的版本 %d\n", state.Version, migrate.Latest())
+		printMigrateResults(results, limit)
+		if err == nil && len(results) == 0 {
+			fmt.Println("数据已是最新版本")
+		}
+	})
+
+	if err != nil {
+		if !c.json {
+			c.printError("数据迁移失败: " + err.Error())
+		}
+		return exitError
+	}
+	if !*dryRun && len(results) > 0 {
+		c.audit("data.migrate", "data", "", nil, nil, fmt.Sprintf("数据迁移到版本 %d", results[len(results)-1].Version))
+	}
+	return exitOK
+}
+
+// applyMigrations 执行待执行的迁移,有数据需要修改时先备份
+func applyMigrations() ([]migrate.Result, error) {
+	plan, err := migrate.Plan()
+	if err != nil {
+		return nil, err
+	}
+	if len(plan) == 0 {
+		return nil, nil
+	}
+
+	changes := 0
+	for _, result := range plan {
+		changes += len(result.Changes)
+	}
+	if changes > 0 {
+		path, _, err := backup.CreateFile(handlers.BackupDir, handlers.BackupPassphrase())
+		if err != nil {
+			return nil, fmt.Errorf("迁移前备份失败: %v", err)
+		}
+		log.Printf("迁移前已备份数据: %s", path)
+	}
+
+	return migrate.Apply()
+}
+
+// printMigrateResults 输出迁移结果,limit 小于 0 时不限制条数
+func printMigrateResults(results []migrate.Result, limit int) {
+	for _, result := range results {
+		fmt.Printf("迁移 %d: %s,%d 处修改\n", result.Version, result.Name, len(result.Changes))
+		for i, change := range result.Changes {
+			if limit >= 0 && i >= limit {
+				fmt.Printf("  ... 另有 %d 处修改,使用 -v 查看全部\n", len(result.Changes)-limit)
+				break
+			}
+			fmt.Printf("  %s %s: %s\n", change.File, change.ID, change.Message)
+		}
+	}
+}
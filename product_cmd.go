@@ -0,0 +1,247 @@
+package main
+
+import (
+	"ai-hacker/internal/export"
+	"ai-hacker/internal/handlers"
+	"ai-hacker/internal/models"
+	"ai-hacker/internal/utils"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	productsDataFile = "data/products.json"
+	cardKeysDataFile = "data/card_keys.json"
+)
+
+// productItem 商品列表项
+type productItem struct {
+	ID      string  `json:"id"`
+	Name    string  `json:"name"`
+	Price   float64 `json:"price"`
+	Stock   int     `json:"stock"`
+	Deleted bool    `json:"deleted"`
+}
+
+// runProduct 商品管理: ai-hacker product list
+func runProduct(args []string) int {
+	return runSubcommand("product", args, map[string]func(args []string) int{
+		"list": runProductList,
+	})
+}
+
+// runProductList 列出商品和库存
+func runProductList(args []string) int {
+	c := newCLI("product list", "[-all]")
+	all := c.flags.Bool("all", false, "包含回收站中的商品")
+	if !c.parse(args, 0) {
+		return exitUsage
+	}
+
+	var products []models.Product
+	if err := utils.LoadFromFile(productsDataFile, &products); err != nil {
+		return c.fail(fmt.Errorf("读取商品失败: %v", err))
+	}
+
+	items := []productItem{}
+	for _, p := range products {
+		if p.IsDeleted() && !*all {
+			continue
+		}
+		items = append(items, productItem{
+			ID:      p.ID,
+			Name:    p.Name,
+			Price:   p.Price,
+			Stock:   handlers.GetProductStock(p.ID),
+			Deleted: p.IsDeleted(),
+		})
+	}
+
+	c.output(items, func() {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\t名称\t价格\t库存\t")
+		for _, item := range items {
+			name := item.Name
+			if item.Deleted {
+				name += " (已删除)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%.2f\t%d\t\n", item.ID, name, item.Price, item.Stock)
+		}
+		w.Flush()
+	})
+	return exitOK
+}
+
+// runKeys 卡密管理: ai-hacker keys <import|export>
+func runKeys(args []string) int {
+	return runSubcommand("keys", args, map[string]func(args []string) int{
+		"import": runKeysImport,
+		"export": runKeysExport,
+	})
+}
+
+// findProductByID 查找未删除的商品
+func findProductByID(id string) (*models.Product, error) {
+	var products []models.Product
+	if err := utils.LoadFromFile(productsDataFile, &products); err != nil {
+		return nil, fmt.Errorf("读取商品失败: %v", err)
+	}
+	for i := range products {
+		if products[i].ID == id && !products[i].IsDeleted() {
+			return &products[i], nil
+		}
+	}
+	return nil, errors.New("商品不存在: " + id)
+}
+
+// runKeysImport 从 CSV 文件导入卡密,文件为 - 时从标准输入读取
+// 格式与管理后台的批量导入相同,有导入失败的行时退出码为 1
+func runKeysImport(args []string) int {
+	c := newCLI("keys import", "-product <商品 ID> [-columns key,expires_at] [-header] <CSV 文件|->")
+	productID := c.flags.String("product", "", "商品 ID")
+	columns := c.flags.String("columns", "", "每列对应的字段名,逗号分隔,为空时按表头或商品字段匹配")
+	header := c.flags.Bool("header", false, "首行为表头")
+	if !c.parse(args, 1) {
+		return exitUsage
+	}
+	if *productID == "" {
+		return c.usageError("请指定 -product")
+	}
+
+	product, err := findProductByID(*productID)
+	if err != nil {
+		return c.fail(err)
+	}
+
+	var data []byte
+	if c.arg(0) == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(c.arg(0))
+	}
+	if err != nil {
+		return c.fail(fmt.Errorf("读取导入文件失败: %v", err))
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		return c.fail(errors.New("导入内容为空"))
+	}
+
+	var cols []string
+	if *columns != "" {
+		cols = strings.Split(*columns, ",")
+	}
+	// 从无货变为有货时到货通知加入发送队列,由服务发送
+	result, err := handlers.ImportCardKeysCSV(product, string(data), cols, *header)
+	if err != nil {
+		return c.fail(err)
+	}
+	c.audit("cardkeys.import", "cardkeys", "", nil, nil, fmt.Sprintf("商品 %s 导入 %d 个卡密,失败 %d 个", product.ID, result.Imported, result.Failed))
+
+	if result.Errors == nil {
+		result.Errors = []handlers.CardKeyImportError{}
+	}
+	c.output(result, func() {
+		fmt.Printf("成功导入 %d 个卡密,失败 %d 个\n", result.Imported, result.Failed)
+		for _, e := range result.Errors {
+			fmt.Printf("  第 %d 行: %s\n", e.Line, e.Error)
+		}
+	})
+
+	if result.Failed > 0 {
+		return exitError
+	}
+	return exitOK
+}
+
+// runKeysExport 导出卡密到文件或标准输出
+// 默认部分脱敏,-mask none 导出明文并记录审计日志
+func runKeysExport(args []string) int {
+	c := newCLI("keys export", "[-product <商品 ID>] [-status unused] [-format csv|xlsx] [-mask partial|full|none] [-reason 原因] [-o 文件]")
+	productID := c.flags.String("product", "", "只导出该商品的卡密")
+	status := c.flags.String("status", "", "只导出该状态的卡密")
+	format := c.flags.String("format", export.FormatCSV, "导出格式: csv 或 xlsx")
+	mask := c.flags.String("mask", handlers.ExportMaskPartial, "脱敏方式: partial 只保留末尾几位、full 完全隐藏、none 明文")
+	reason := c.flags.String("reason", "", "明文导出的原因,记录到卡密查看记录")
+	out := c.flags.String("o", "", "输出文件,为空时输出到标准输出")
+	if !c.parse(args, 0) {
+		return exitUsage
+	}
+
+	if !export.Supported(*format) {
+		return c.usageError("format 只能是 csv 或 xlsx")
+	}
+	switch *mask {
+	case handlers.ExportMaskPartial, handlers.ExportMaskFull, handlers.ExportMaskNone:
+	default:
+		return c.usageError("mask 只能是 partial、full 或 none")
+	}
+	*reason = strings.TrimSpace(*reason)
+	if *mask == handlers.ExportMaskNone && *reason == "" {
+		return c.usageError("明文导出需要使用 -reason 填写原因")
+	}
+	// JSON 模式下标准输出用于输出结果,导出内容必须写入文件
+	if c.json && *out == "" {
+		return c.usageError("-json 时需要使用 -o 指定输出文件")
+	}
+
+	match := func(ck *models.CardKey) bool {
+		return !ck.IsDeleted() && (*productID == "" || ck.ProductID == *productID) && (*status == "" || ck.Status == *status)
+	}
+	// 明文导出与后台一样计入每日查看配额
+	if *mask == handlers.ExportMaskNone {
+		ids, err := handlers.RevealCardKeysForExport(cliActor(), *reason, *productID, match)
+		if err != nil {
+			c.audit("cardkeys.export", "cardkeys", "", nil, nil, "明文导出超出每日查看配额被拒绝,原因: "+*reason)
+			return c.fail(err)
+		}
+		match = func(ck *models.CardKey) bool { return ids[ck.ID] }
+	}
+
+	var dst io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.OpenFile(*out, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return c.fail(err)
+		}
+		defer f.Close()
+		dst = f
+	}
+
+	w, err := export.New(*format, dst)
+	if err != nil {
+		return c.fail(err)
+	}
+	count := 0
+	err = w.WriteRow(handlers.CardKeyExportHeader...)
+	if err == nil {
+		err = utils.StreamFromFile(cardKeysDataFile, func(ck *models.CardKey) error {
+			if !match(ck) {
+				return nil
+			}
+			count++
+			return w.WriteRow(handlers.CardKeyExportRow(ck, *mask)...)
+		})
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		return c.fail(fmt.Errorf("导出失败: %v", err))
+	}
+	detail := fmt.Sprintf("格式 %s,脱敏 %s,导出 %d 条", *format, *mask, count)
+	if *reason != "" {
+		detail += ",原因: " + *reason
+	}
+	c.audit("cardkeys.export", "cardkeys", "", nil, nil, detail)
+
+	if *out != "" {
+		c.output(map[string]interface{}{"file": *out, "count": count}, func() {
+			fmt.Fprintf(os.Stderr, "已导出 %d 个卡密到 %s\n", count, *out)
+		})
+	}
+	return exitOK
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"ai-hacker/internal/handlers"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+// runSettings 系统设置: ai-hacker settings <get|set>
+func runSettings(args []string) int {
+	return runSubcommand("settings", args, map[string]func(args []string) int{
+		"get": runSettingsGet,
+		"set": runSettingsSet,
+	})
+}
+
+// runSettingsGet 查看全部或单个设置项,密码类设置只显示是否已设置
+func runSettingsGet(args []string) int {
+	c := newCLI("settings get", "[设置项]")
+	if !c.parse(args, -1) {
+		return exitUsage
+	}
+	if len(c.args) > 1 {
+		c.flags.Usage()
+		return exitUsage
+	}
+
+	settings := handlers.LoadSettings()
+	display := func(key string) string {
+		value := settings[key]
+		if handlers.IsSecretSetting(key) && value != "" {
+			return "******"
+		}
+		return value
+	}
+
+	if key := c.arg(0); key != "" {
+		if msg := handlers.ValidateSetting(key, ""); msg != "" {
+			return c.usageError("%s", msg)
+		}
+		c.output(map[string]string{key: display(key)}, func() {
+			fmt.Println(display(key))
+		})
+		return exitOK
+	}
+
+	result := make(map[string]string)
+	for _, key := range handlers.SettingKeys() {
+		result[key] = display(key)
+	}
+	c.output(result, func() {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, key := range handlers.SettingKeys() {
+			fmt.Fprintf(w, "%s\t%s\t\n", key, result[key])
+		}
+		w.Flush()
+	})
+	return exitOK
+}
+
+// runSettingsSet 修改单个设置项,值为空字符串时恢复默认
+func runSettingsSet(args []string) int {
+	c := newCLI("settings set", "<设置项> <值>")
+	if !c.parse(args, 2) {
+		return exitUsage
+	}
+
+	key, value := c.arg(0), c.arg(1)
+	if msg := handlers.ValidateSetting(key, value); msg != "" {
+		return c.usageError("%s: %s", key, msg)
+	}
+
+	before, err := handlers.SaveSetting(key, value)
+	if err != nil {
+		return c.fail(fmt.Errorf("保存设置失败: %v", err))
+	}
+	c.audit("settings.update", "settings", key, map[string]string{key: before}, map[string]string{key: value}, "")
+
+	shown := value
+	if handlers.IsSecretSetting(key) && value != "" {
+		shown = "******"
+	}
+	c.output(map[string]string{"key": key, "value": shown}, func() {
+		fmt.Printf("%s 已更新\n", key)
+	})
+	return exitOK
+}
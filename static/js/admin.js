@@ -47,7 +47,7 @@ function checkPermission(roleId, permission) {
     const rolePermissions = {
         1: [], // 普通用户无后台权限
         2: ['dashboard:view', 'product:manage', 'cardkey:manage', 'order:view'], // 运营人员
-        3: ['dashboard:view', 'product:manage', 'cardkey:manage', 'order:manage', 'user:manage', 'role:manage', 'system:manage'] // 超级管理员
+        3: ['dashboard:view', 'product:manage', 'cardkey:manage', 'cardkey:reveal', 'order:manage', 'user:manage', 'role:manage', 'system:manage', 'audit:view'] // 超级管理员
     };
     
     const permissions = rolePermissions[roleId] || [];
@@ -93,6 +93,8 @@ function showSection(sectionId) {
         'orders': '订单管理',
         'users': '用户管理',
         'cardkeys': '卡密管理',
+        'trash': '回收站',
+        'audit': '审计日志',
         'settings': '系统设置',
         'roles': '权限管理'
     };
@@ -112,6 +114,10 @@ function showSection(sectionId) {
         loadUsers();
     } else if (sectionId === 'cardkeys') {
         loadCardKeys();
+    } else if (sectionId === 'trash') {
+        loadTrash();
+    } else if (sectionId === 'audit') {
+        loadAuditLogs();
     } else if (sectionId === 'settings') {
         loadSettings();
     } else if (sectionId === 'roles') {
@@ -119,48 +125,124 @@ function showSection(sectionId) {
     }
 }
 
+// 请求管理接口,忽略空参数
+// 分页列表接口返回 { items, total, page, page_size, next_cursor }
+async function fetchList(path, params = {}) {
+    const query = new URLSearchParams();
+    Object.keys(params).forEach(key => {
+        if (params[key] !== '' && params[key] !== undefined && params[key] !== null) {
+            query.append(key, params[key]);
+        }
+    });
+    const response = await fetch(`${API_BASE_URL}${path}?${query.toString()}`, { headers: getAuthHeaders() });
+    if (!response.ok) {
+        let message = `HTTP ${response.status}`;
+        try {
+            const data = await response.json();
+            if (data.error) {
+                message = `HTTP ${response.status}: ${data.error}`;
+            }
+        } catch (e) {}
+        throw new Error(message);
+    }
+    return response.json();
+}
+
+// 渲染分页条,onPage 接收目标页码
+function renderPager(containerId, data, onPage) {
+    const container = document.getElementById(containerId);
+    if (!container) {
+        return;
+    }
+    const totalPages = Math.max(1, Math.ceil(data.total / data.page_size));
+    if (totalPages <= 1) {
+        container.innerHTML = '';
+        return;
+    }
+    container.innerHTML = `
+        <div class="p-4 border-t border-gray-200 flex justify-between items-center text-sm text-gray-600">
+            <span>共 ${data.total} 条,第 ${data.page} / ${totalPages} 页</span>
+            <div class="space-x-2">
+                <button data-page="${data.page - 1}" class="px-3 py-1 border border-gray-300 rounded hover:bg-gray-100 disabled:opacity-50" ${data.page <= 1 ? 'disabled' : ''}>上一页</button>
+                <button data-page="${data.page + 1}" class="px-3 py-1 border border-gray-300 rounded hover:bg-gray-100 disabled:opacity-50" ${data.page >= totalPages ? 'disabled' : ''}>下一页</button>
+            </div>
+        </div>
+    `;
+    container.querySelectorAll('button[data-page]').forEach(button => {
+        button.onclick = () => onPage(parseInt(button.dataset.page, 10));
+    });
+}
+
 // 加载仪表盘数据
 async function loadDashboard() {
     try {
-        const headers = getAuthHeaders();
         const user = JSON.parse(localStorage.getItem('user'));
+        const stats = await fetchList('/admin/stats');
+        
+        document.getElementById('totalOrders').textContent = stats.orders;
+        // 只有有用户管理权限的才显示用户数
+        document.getElementById('totalUsers').textContent = checkPermission(user.role, 'user:manage') ? stats.users : '-';
+        document.getElementById('totalProducts').textContent = stats.products;
+        document.getElementById('totalRevenue').textContent = `￥${stats.revenue.toFixed(2)}`;
+        document.getElementById('todayOrders').textContent = stats.today.orders;
+        document.getElementById('todayRevenue').textContent = `￥${stats.today.revenue.toFixed(2)}`;
+        document.getElementById('todayRegistrations').textContent = stats.today.registrations;
+        document.getElementById('conversionRate').textContent = `${(stats.conversion_rate * 100).toFixed(1)}%`;
+        
+        const [topProducts, stock] = await Promise.all([
+            fetchList('/admin/stats/products', { limit: 10 }),
+            fetchList('/admin/stats/stock'),
+            loadSalesStats()
+        ]);
         
-        // 根据权限决定加载哪些数据
-        const promises = [
-            fetch(`${API_BASE_URL}/products`).then(r => r.json()),
-            fetch(`${API_BASE_URL}/admin/orders`, { headers }).then(r => {
-                if (!r.ok) throw new Error(`HTTP ${r.status}`);
-                return r.json();
-            })
-        ];
-        
-        // 只有有用户管理权限的才加载用户数据
-        if (checkPermission(user.role, 'user:manage')) {
-            promises.push(
-                fetch(`${API_BASE_URL}/admin/users`, { headers }).then(r => {
-                    if (!r.ok) throw new Error(`HTTP ${r.status}`);
-                    return r.json();
-                })
-            );
-        }
-        
-        const results = await Promise.all(promises);
-        const products = results[0];
-        const orders = results[1];
-        const users = results[2] || [];
-        
-        document.getElementById('totalOrders').textContent = orders.length;
-        document.getElementById('totalUsers').textContent = users.length || '-';
-        document.getElementById('totalProducts').textContent = products.length;
-        
-        const totalRevenue = orders.reduce((sum, order) => sum + order.amount, 0);
-        document.getElementById('totalRevenue').textContent = `￥${totalRevenue.toFixed(2)}`;
+        document.getElementById('topProductsTable').innerHTML = topProducts.length === 0
+            ? '<tr><td colspan="4" class="px-6 py-8 text-center text-gray-500">暂无销售数据</td></tr>'
+            : topProducts.map(p => `
+                <tr>
+                    <td class="px-6 py-4 text-sm">${escapeHtml(p.product_name || p.product_id)}</td>
+                    <td class="px-6 py-4 text-sm">${p.orders}</td>
+                    <td class="px-6 py-4 text-sm">${p.units}</td>
+                    <td class="px-6 py-4 text-sm">￥${p.revenue.toFixed(2)}</td>
+                </tr>
+            `).join('');
+        
+        document.getElementById('stockStatsTable').innerHTML = stock.length === 0
+            ? '<tr><td colspan="3" class="px-6 py-8 text-center text-gray-500">暂无商品</td></tr>'
+            : stock.map(p => `
+                <tr>
+                    <td class="px-6 py-4 text-sm">${escapeHtml(p.product_name)}</td>
+                    <td class="px-6 py-4 text-sm ${p.remaining === 0 ? 'text-red-600' : ''}">${p.remaining}</td>
+                    <td class="px-6 py-4 text-sm">${p.sold}</td>
+                </tr>
+            `).join('');
     } catch (error) {
         console.error('加载仪表盘数据失败:', error);
         showAlert('错误', '加载数据失败: ' + error.message);
     }
 }
 
+// 加载销售趋势,最近的周期在前
+async function loadSalesStats() {
+    const data = await fetchList('/admin/stats/sales', {
+        period: document.getElementById('statsPeriod').value
+    });
+    const series = data.series.slice().reverse();
+    const maxRevenue = Math.max(...series.map(b => b.revenue), 0);
+    
+    document.getElementById('salesStatsTable').innerHTML = series.map(b => `
+        <tr>
+            <td class="px-6 py-3 text-sm font-mono">${b.period}</td>
+            <td class="px-6 py-3 text-sm">${b.orders}</td>
+            <td class="px-6 py-3 text-sm">${b.units}</td>
+            <td class="px-6 py-3 text-sm">￥${b.revenue.toFixed(2)}</td>
+            <td class="px-6 py-3 text-sm">${b.registrations}</td>
+            <td class="px-6 py-3 w-1/3">
+                <div class="h-2 bg-black rounded" style="width: ${maxRevenue > 0 ? (b.revenue / maxRevenue * 100).toFixed(1) : 0}%"></div>
+            </td>
+        </tr>
+    `).join('');
+}
+
 // 加载商品列表
 async function loadProducts() {
     try {
@@ -191,16 +273,17 @@ async function loadProducts() {
 }
 
 // 加载订单列表
-async function loadOrders() {
+async function loadOrders(page = 1) {
     try {
-        const headers = getAuthHeaders();
-        const response = await fetch(`${API_BASE_URL}/admin/orders`, { headers });
-        
-        if (!response.ok) {
-            throw new Error(`HTTP ${response.status}`);
-        }
-        
-        const orders = await response.json();
+        const data = await fetchList('/admin/orders', {
+            page,
+            email: document.getElementById('orderFilterEmail').value.trim(),
+            status: document.getElementById('orderFilterStatus').value,
+            from: document.getElementById('orderFilterFrom').value,
+            to: document.getElementById('orderFilterTo').value
+        });
+        const orders = data.items;
+        renderPager('ordersPager', data, loadOrders);
         
         const user = JSON.parse(localStorage.getItem('user'));
         const canManage = checkPermission(user.role, 'order:manage');
@@ -217,10 +300,15 @@ async function loadOrders() {
                         ${order.status}
                     </span>
                 </td>
+                <td class="px-6 py-4 text-sm">${renderEmailDelivery(order)}</td>
                 <td class="px-6 py-4 text-sm">${formatDate(order.created_at)}</td>
                 <td class="px-6 py-4 text-sm">
                     ${canManage ? `
                         <button onclick="editOrder('${order.id}')" class="text-blue-600 hover:underline mr-3">编辑</button>
+                        <button onclick="showReplaceKeyModal('${order.id}')" class="text-blue-600 hover:underline mr-3">换卡</button>
+                        <button onclick="resendOrderEmail('${order.id}')" class="text-blue-600 hover:underline mr-3">重发邮件</button>
+                        <button onclick="showRefundModal('${order.id}', 'refund', ${(order.amount - (order.refunded_amount || 0)).toFixed(2)})" class="text-blue-600 hover:underline mr-3">退款</button>
+                        <button onclick="showRefundModal('${order.id}', 'cancel', ${(order.amount - (order.refunded_amount || 0)).toFixed(2)})" class="text-blue-600 hover:underline mr-3">取消</button>
                         <button onclick="deleteOrder('${order.id}')" class="text-red-600 hover:underline">删除</button>
                     ` : '<span class="text-gray-400">仅查看</span>'}
                 </td>
@@ -241,16 +329,14 @@ async function loadOrders() {
 }
 
 // 加载用户列表
-async function loadUsers() {
+async function loadUsers(page = 1) {
     try {
-        const headers = getAuthHeaders();
-        const response = await fetch(`${API_BASE_URL}/admin/users`, { headers });
-        
-        if (!response.ok) {
-            throw new Error(`HTTP ${response.status}`);
-        }
-        
-        const users = await response.json();
+        const data = await fetchList('/admin/users', {
+            page,
+            email: document.getElementById('userFilterEmail').value.trim()
+        });
+        const users = data.items;
+        renderPager('usersPager', data, loadUsers);
         
         const user = JSON.parse(localStorage.getItem('user'));
         const canManage = checkPermission(user.role, 'user:manage');
@@ -299,6 +385,13 @@ function formatDate(dateString) {
     });
 }
 
+// 转义 HTML 特殊字符
+function escapeHtml(text) {
+    const div = document.createElement('div');
+    div.textContent = text;
+    return div.innerHTML;
+}
+
 // 退出登录
 function logout() {
     showConfirm('确认退出', '确定要退出登录吗？', () => {
@@ -352,6 +445,13 @@ document.addEventListener('DOMContentLoaded', async function() {
     }
     
     // 根据权限显示/隐藏菜单
+    if (!checkPermission(user.role, 'audit:view')) {
+        const auditLink = document.querySelector('a[href="#audit"]');
+        if (auditLink) {
+            auditLink.style.display = 'none';
+        }
+    }
+    
     if (!checkPermission(user.role, 'cardkey:manage')) {
         const cardkeysLink = document.querySelector('a[href="#cardkeys"]');
         if (cardkeysLink) {
@@ -384,6 +484,11 @@ document.addEventListener('DOMContentLoaded', async function() {
         if (addBatchCardKeyBtn) {
             addBatchCardKeyBtn.style.display = 'block';
         }
+        
+        const uploadCardKeyFileBtn = document.getElementById('uploadCardKeyFileBtn');
+        if (uploadCardKeyFileBtn) {
+            uploadCardKeyFileBtn.style.display = 'block';
+        }
     }
     
     if (checkPermission(user.role, 'role:manage')) {
@@ -413,6 +518,21 @@ document.addEventListener('DOMContentLoaded', async function() {
         if (saveLegalConfigBtn) {
             saveLegalConfigBtn.style.display = 'block';
         }
+        
+        const saveAlertConfigBtn = document.getElementById('saveAlertConfigBtn');
+        if (saveAlertConfigBtn) {
+            saveAlertConfigBtn.style.display = 'block';
+        }
+        
+        const saveNotificationConfigBtn = document.getElementById('saveNotificationConfigBtn');
+        if (saveNotificationConfigBtn) {
+            saveNotificationConfigBtn.style.display = 'block';
+        }
+        
+        const testTelegramBtn = document.getElementById('testTelegramBtn');
+        if (testTelegramBtn) {
+            testTelegramBtn.style.display = 'block';
+        }
     }
     
     // 恢复上次的页面状态，如果没有则默认显示仪表盘
@@ -441,6 +561,8 @@ document.addEventListener('DOMContentLoaded', async function() {
             'orders': '订单管理',
             'users': '用户管理',
             'cardkeys': '卡密管理',
+            'trash': '回收站',
+            'audit': '审计日志',
             'settings': '系统设置',
             'roles': '权限管理'
         };
@@ -457,14 +579,164 @@ document.addEventListener('DOMContentLoaded', async function() {
             loadUsers();
         } else if (savedSection === 'cardkeys') {
             loadCardKeys();
+        } else if (savedSection === 'trash') {
+            loadTrash();
+        } else if (savedSection === 'audit') {
+            loadAuditLogs();
         } else if (savedSection === 'settings') {
             loadSettings();
         } else if (savedSection === 'roles') {
             loadRoles();
         }
     }
+    
+    // 订阅实时事件
+    if (checkPermission(user.role, 'order:view')) {
+        startEventStream();
+    }
 });
 
+// 实时事件流的最后一个事件 ID 和重连间隔,重连时通过 Last-Event-ID 补发断线期间的事件
+let eventStreamLastId = '';
+let eventStreamRetry = 3000;
+
+// 订阅后台实时事件
+// EventSource 不能设置 Authorization 请求头,因此使用 fetch 读取 SSE 流并自行重连
+async function startEventStream() {
+    while (true) {
+        try {
+            const headers = getAuthHeaders();
+            if (eventStreamLastId) {
+                headers['Last-Event-ID'] = eventStreamLastId;
+            }
+            const response = await fetch(`${API_BASE_URL}/admin/events`, { headers });
+            if (response.status === 401 || response.status === 403) {
+                setLiveStatus(false);
+                return;
+            }
+            if (!response.ok || !response.body) {
+                throw new Error(`HTTP ${response.status}`);
+            }
+            setLiveStatus(true);
+            
+            const reader = response.body.pipeThrough(new TextDecoderStream()).getReader();
+            let buffer = '';
+            while (true) {
+                const { value, done } = await reader.read();
+                if (done) {
+                    break;
+                }
+                buffer += value.replace(/\r\n/g, '\n');
+                let index;
+                while ((index = buffer.indexOf('\n\n')) >= 0) {
+                    parseEventBlock(buffer.slice(0, index));
+                    buffer = buffer.slice(index + 2);
+                }
+            }
+        } catch (error) {
+            console.error('实时事件连接失败:', error);
+        }
+        setLiveStatus(false);
+        await new Promise(resolve => setTimeout(resolve, eventStreamRetry));
+    }
+}
+
+// 解析一个 SSE 事件块
+function parseEventBlock(block) {
+    let type = 'message';
+    const data = [];
+    block.split('\n').forEach(line => {
+        if (line.startsWith(':')) {
+            return; // 心跳
+        }
+        const colon = line.indexOf(':');
+        const field = colon >= 0 ? line.slice(0, colon) : line;
+        const value = colon >= 0 ? line.slice(colon + 1).replace(/^ /, '') : '';
+        if (field === 'id') {
+            eventStreamLastId = value;
+        } else if (field === 'event') {
+            type = value;
+        } else if (field === 'data') {
+            data.push(value);
+        } else if (field === 'retry' && /^\d+$/.test(value)) {
+            eventStreamRetry = parseInt(value, 10);
+        }
+    });
+    if (data.length === 0) {
+        return;
+    }
+    try {
+        handleAdminEvent(type, JSON.parse(data.join('\n')).data || {});
+    } catch (error) {
+        console.error('处理实时事件失败:', error);
+    }
+}
+
+// 最近一个新订单事件的订单 ID,避免同一订单的 order.created 和 order.paid 重复提示
+let lastCreatedOrderId = '';
+
+// 处理实时事件: 提示并刷新受影响的页面
+function handleAdminEvent(type, data) {
+    if (type === 'order.created') {
+        lastCreatedOrderId = data.order_id;
+        showLiveToast(`新订单: ${escapeHtml(data.product_name)} ￥${Number(data.amount).toFixed(2)}<br><span class="text-gray-500">${escapeHtml(data.email)}</span>`);
+        refreshLiveSection(['dashboard', 'orders']);
+    } else if (type === 'order.paid') {
+        if (data.order_id !== lastCreatedOrderId) {
+            showLiveToast(`订单已完成: ${escapeHtml(data.order_id)}`);
+        }
+        refreshLiveSection(['dashboard', 'orders']);
+    } else if (type === 'stock.changed') {
+        if (data.stock === 0) {
+            showLiveToast(`商品已售罄: ${escapeHtml(data.product_name || data.product_id)}`, true);
+        }
+        refreshLiveSection(['dashboard', 'products', 'cardkeys']);
+    } else if (type === 'email.failed') {
+        const target = data.order_id ? `订单 ${escapeHtml(data.order_id)} 的邮件` : '邮件';
+        const retry = data.status === 'retrying' ? `第 ${data.attempts} 次发送失败,稍后重试` : '不再重试';
+        showLiveToast(`${target}发送失败<br><span class="text-gray-500">${retry}</span>`, true);
+        refreshLiveSection(['orders']);
+    } else if (type === 'resync') {
+        // 断线期间的事件无法补发,重新加载当前页面
+        refreshLiveSection(['dashboard', 'products', 'orders', 'cardkeys']);
+    }
+}
+
+// 当前页面受影响时重新加载,短时间内的多个事件只刷新一次
+let liveRefreshTimer = null;
+function refreshLiveSection(sections) {
+    const current = localStorage.getItem('adminCurrentSection') || 'dashboard';
+    if (!sections.includes(current)) {
+        return;
+    }
+    clearTimeout(liveRefreshTimer);
+    liveRefreshTimer = setTimeout(() => {
+        const loaders = { dashboard: loadDashboard, products: loadProducts, orders: loadOrders, cardkeys: loadCardKeys };
+        loaders[current]();
+    }, 500);
+}
+
+// 显示实时事件提示,几秒后自动消失
+function showLiveToast(html, warning = false) {
+    const container = document.getElementById('liveToasts');
+    if (!container) {
+        return;
+    }
+    const toast = document.createElement('div');
+    toast.className = `px-4 py-3 bg-white border rounded shadow text-sm ${warning ? 'border-red-300' : 'border-gray-200'}`;
+    toast.innerHTML = html;
+    container.appendChild(toast);
+    setTimeout(() => toast.remove(), 6000);
+}
+
+// 显示实时事件的连接状态
+function setLiveStatus(connected) {
+    const status = document.getElementById('liveStatus');
+    if (status) {
+        status.textContent = connected ? '● 实时' : '○ 实时连接中断';
+    }
+}
+
 
 // 加载角色权限列表
 async function loadRoles() {
@@ -824,6 +1096,9 @@ function showAlert(title, message, callback) {
     overlay.querySelector('.modal-button').addEventListener('click', closeAlert);
 }
 
+// 当前编辑中的商品,保存时保留未在表单中展示的字段
+let editingProduct = null;
+
 // 编辑商品
 async function editProduct(productId) {
     try {
@@ -868,6 +1143,29 @@ async function editProduct(productId) {
                         <input type="number" id="editProductStock" value="${product.stock}" disabled class="w-full px-3 py-2 border border-gray-300 rounded bg-gray-100">
                         <p class="text-xs text-gray-500 mt-1">库存由卡密数量自动计算</p>
                     </div>
+                    <div>
+                        <label class="block text-sm font-medium text-gray-700 mb-2">库存告警阈值</label>
+                        <input type="number" id="editProductLowStock" value="${product.low_stock_threshold || 0}" min="0" class="w-full px-3 py-2 border border-gray-300 rounded focus:outline-none focus:ring-1 focus:ring-black">
+                        <p class="text-xs text-gray-500 mt-1">售出后库存低于该值时通知管理员，0 表示不告警</p>
+                    </div>
+                    <div>
+                        <label class="block text-sm font-medium text-gray-700 mb-2">文件最大下载次数</label>
+                        <input type="number" id="editProductMaxDownloads" value="${product.max_downloads || 0}" min="0" class="w-full px-3 py-2 border border-gray-300 rounded focus:outline-none focus:ring-1 focus:ring-black">
+                        <p class="text-xs text-gray-500 mt-1">仅对文件类卡密生效，0 表示不限</p>
+                    </div>
+                    <div>
+                        <label class="block text-sm font-medium text-gray-700 mb-2">卡密字段</label>
+                        <textarea id="editProductKeyFields" class="w-full px-3 py-2 border border-gray-300 rounded focus:outline-none focus:ring-1 focus:ring-black" rows="3" placeholder="每行一个, 格式: 标识:名称&#10;例如:&#10;account:账号&#10;password:密码"></textarea>
+                        <p class="text-xs text-gray-500 mt-1">留空表示单行卡密</p>
+                    </div>
+                    <div>
+                        <label class="block text-sm font-medium text-gray-700 mb-2">发货说明模板</label>
+                        <textarea id="editProductDeliveryTemplate" class="w-full px-3 py-2 border border-gray-300 rounded focus:outline-none focus:ring-1 focus:ring-black" rows="4" placeholder="例如: 请在 X 兑换, 订单号 {order_id}, 卡密 {card_key}"></textarea>
+                        <div class="flex justify-between items-center mt-1">
+                            <p class="text-xs text-gray-500">可用占位符: {order_id} {card_key} {product_name} {date}</p>
+                            <button onclick="previewDeliveryTemplate('${productId}')" class="text-xs text-blue-600 hover:underline">预览</button>
+                        </div>
+                    </div>
                 </div>
                 <div class="flex justify-end space-x-3 mt-6">
                     <button onclick="this.closest('.fixed').remove()" class="px-4 py-2 text-gray-700 hover:bg-gray-100 rounded">
@@ -881,17 +1179,50 @@ async function editProduct(productId) {
         `;
         
         document.body.appendChild(modal);
+        document.getElementById('editProductDeliveryTemplate').value = product.delivery_template || '';
+        document.getElementById('editProductKeyFields').value = (product.key_fields || [])
+            .map(f => `${f.name}:${f.label}`)
+            .join('\n');
+        editingProduct = product;
     } catch (error) {
         console.error('加载商品失败:', error);
         showAlert('错误', '加载商品失败');
     }
 }
 
+// 预览发货说明模板
+async function previewDeliveryTemplate(productId) {
+    const template = document.getElementById('editProductDeliveryTemplate').value;
+    
+    try {
+        const headers = getAuthHeaders();
+        const response = await fetch(`${API_BASE_URL}/admin/products/${productId}/delivery-preview`, {
+            method: 'POST',
+            headers: headers,
+            body: JSON.stringify({ template })
+        });
+        
+        const data = await response.json();
+        if (!response.ok) {
+            throw new Error(data.error || '预览失败');
+        }
+        
+        showAlert('发货说明预览', data.html || '(模板为空)');
+    } catch (error) {
+        console.error('预览发货说明失败:', error);
+        showAlert('错误', '预览失败: ' + error.message);
+    }
+}
+
 // 保存商品
 async function saveProduct(productId) {
     const name = document.getElementById('editProductName').value.trim();
     const description = document.getElementById('editProductDesc').value.trim();
     const price = parseFloat(document.getElementById('editProductPrice').value);
+    const deliveryTemplate = document.getElementById('editProductDeliveryTemplate').value;
+    const keyFields = parseKeyFields(document.getElementById('editProductKeyFields').value);
+    const maxDownloads = parseInt(document.getElementById('editProductMaxDownloads').value) || 0;
+    const lowStockThreshold = parseInt(document.getElementById('editProductLowStock').value) || 0;
     
     if (!name || !description || isNaN(price)) {
         showAlert('提示', '请填写完整信息');
@@ -904,10 +1235,15 @@ async function saveProduct(productId) {
             method: 'PUT',
             headers: headers,
             body: JSON.stringify({
+                ...(editingProduct || {}),
                 id: productId,
                 name: name,
                 description: description,
-                price: price
+                price: price,
+                delivery_template: deliveryTemplate,
+                key_fields: keyFields,
+                max_downloads: maxDownloads,
+                low_stock_threshold: lowStockThreshold
             })
         });
         
@@ -926,9 +1262,34 @@ async function saveProduct(productId) {
     }
 }
 
+// 解析卡密字段定义, 每行格式为 标识:名称
+function parseKeyFields(text) {
+    return text.split('\n')
+        .map(line => line.trim())
+        .filter(line => line.length > 0)
+        .map(line => {
+            const index = line.indexOf(':');
+            if (index === -1) {
+                return { name: line, label: line };
+            }
+            return {
+                name: line.substring(0, index).trim(),
+                label: line.substring(index + 1).trim()
+            };
+        });
+}
+
+// 渲染结构化卡密字段
+function renderCardKeyFields(fields, keyFields) {
+    return Object.entries(fields).map(([name, value]) => {
+        const field = (keyFields || []).find(f => f.name === name);
+        return `<div><span class="text-gray-500">${field ? field.label : name}:</span> ${value}</div>`;
+    }).join('');
+}
+
 // 删除商品
 async function deleteProduct(productId, productName) {
-    showConfirm('确认删除', `确定要删除商品 "${productName}" 吗？`, async () => {
+    showConfirm('确认删除', `确定要删除商品 "${productName}" 吗？\n\n商品及其未售出的卡密将移入回收站。`, async () => {
         try {
             const headers = getAuthHeaders();
             const response = await fetch(`${API_BASE_URL}/admin/products/${productId}`, {
@@ -954,26 +1315,22 @@ async function deleteProduct(productId, productName) {
 // 编辑订单
 async function editOrder(orderId) {
     try {
-        const headers = getAuthHeaders();
-        const response = await fetch(`${API_BASE_URL}/admin/orders`, { headers });
-        
-        if (!response.ok) {
-            throw new Error(`HTTP ${response.status}`);
-        }
-        
-        const orders = await response.json();
-        const order = orders.find(o => o.id === orderId);
+        const data = await fetchList('/admin/orders', { id: orderId });
+        const order = data.items[0];
         
         if (!order) {
             showAlert('错误', '订单不存在');
             return;
         }
         
+        // 退款和取消通过订单列表中的操作完成
         const statusOptions = [
             { value: '已完成', label: '已完成' },
-            { value: '处理中', label: '处理中' },
-            { value: '已取消', label: '已取消' }
+            { value: '处理中', label: '处理中' }
         ];
+        if (!statusOptions.some(o => o.value === order.status)) {
+            statusOptions.push({ value: order.status, label: order.status });
+        }
         
         let selectedStatus = order.status;
         
@@ -1014,6 +1371,20 @@ async function editOrder(orderId) {
                         <label class="block text-sm font-medium text-gray-700 mb-2">卡密</label>
                         <textarea id="editOrderCardKey" class="w-full px-3 py-2 border border-gray-300 rounded focus:outline-none focus:ring-1 focus:ring-black" rows="3">${order.card_key || ''}</textarea>
                     </div>
+                    ${order.replacements && order.replacements.length > 0 ? `
+                    <div>
+                        <label class="block text-sm font-medium text-gray-700 mb-2">换卡记录</label>
+                        <div class="text-xs text-gray-600 space-y-2 max-h-40 overflow-y-auto">
+                            ${order.replacements.map(r => `
+                                <div class="bg-gray-50 p-2 rounded">
+                                    <div>${formatDate(r.created_at)} · ${r.operator}</div>
+                                    <div class="font-mono">${r.old_key} → ${r.new_key}</div>
+                                    <div>原因: ${r.reason}</div>
+                                </div>
+                            `).join('')}
+                        </div>
+                    </div>
+                    ` : ''}
                 </div>
                 <div class="flex justify-end space-x-3 mt-6">
                     <button onclick="this.closest('.fixed').remove()" class="px-4 py-2 text-gray-700 hover:bg-gray-100 rounded">
@@ -1070,59 +1441,144 @@ async function saveOrderWithDropdown(orderId) {
     }
 }
 
-// 删除订单
-async function deleteOrder(orderId) {
-    showConfirm('确认删除', `确定要删除订单 ${orderId} 吗？`, async () => {
-        try {
-            const headers = getAuthHeaders();
-            const response = await fetch(`${API_BASE_URL}/admin/orders/${orderId}`, {
-                method: 'DELETE',
-                headers: headers
-            });
-            
-            if (!response.ok) {
-                const data = await response.json();
-                throw new Error(data.error || '删除失败');
-            }
-            
-            showAlert('成功', '订单删除成功', () => {
-                loadOrders();
-            });
-        } catch (error) {
-            console.error('删除订单失败:', error);
-            showAlert('错误', '删除失败: ' + error.message);
+// 显示换卡对话框
+function showReplaceKeyModal(orderId) {
+    const modal = document.createElement('div');
+    modal.className = 'fixed inset-0 bg-black bg-opacity-50 flex items-center justify-center z-50';
+    modal.onclick = function(e) {
+        if (e.target === modal) {
+            modal.remove();
         }
-    });
+    };
+    modal.innerHTML = `
+        <div class="bg-white rounded-lg p-6 max-w-md w-full mx-4">
+            <h3 class="text-xl font-medium mb-4">更换卡密</h3>
+            <div class="space-y-4">
+                <p class="text-sm text-gray-600">原卡密将标记为失效，系统会从同一商品分配新卡密并重新发送邮件给用户。</p>
+                <div>
+                    <label class="block text-sm font-medium text-gray-700 mb-2">换卡原因</label>
+                    <textarea id="replaceKeyReason" class="w-full px-3 py-2 border border-gray-300 rounded focus:outline-none focus:ring-1 focus:ring-black" rows="3" placeholder="例如: 用户反馈卡密无法兑换"></textarea>
+                </div>
+            </div>
+            <div class="flex justify-end space-x-3 mt-6">
+                <button onclick="this.closest('.fixed').remove()" class="px-4 py-2 text-gray-700 hover:bg-gray-100 rounded">
+                    取消
+                </button>
+                <button onclick="replaceOrderKey('${orderId}')" class="px-4 py-2 bg-black text-white rounded hover:bg-gray-800">
+                    确认更换
+                </button>
+            </div>
+        </div>
+    `;
+    
+    document.body.appendChild(modal);
 }
 
-// 删除用户
-async function deleteUser(userId, userEmail) {
-    showConfirm('确认删除', `确定要删除用户 "${userEmail}" 吗？`, async () => {
+// 更换订单卡密
+async function replaceOrderKey(orderId) {
+    const reason = document.getElementById('replaceKeyReason').value.trim();
+    
+    if (!reason) {
+        showAlert('提示', '请填写换卡原因');
+        return;
+    }
+    
+    try {
+        const headers = getAuthHeaders();
+        const response = await fetch(`${API_BASE_URL}/admin/orders/${orderId}/replace-key`, {
+            method: 'POST',
+            headers: headers,
+            body: JSON.stringify({ reason })
+        });
+        
+        const data = await response.json();
+        if (!response.ok) {
+            throw new Error(data.error || '换卡失败');
+        }
+        
+        document.querySelector('.fixed').remove();
+        showAlert('成功', '卡密更换成功，已重新发送邮件', () => {
+            loadOrders();
+        });
+    } catch (error) {
+        console.error('更换卡密失败:', error);
+        showAlert('错误', '换卡失败: ' + error.message);
+    }
+}
+
+// 邮件发送状态的显示名称和样式
+const EMAIL_DELIVERY_STATUS = {
+    queued: ['等待发送', 'bg-gray-100 text-gray-800'],
+    sent: ['已发送', 'bg-green-100 text-green-800'],
+    retrying: ['等待重试', 'bg-yellow-100 text-yellow-800'],
+    failed: ['发送失败', 'bg-red-100 text-red-800']
+};
+
+// 订单列表中的发货邮件状态,点击查看发送日志
+function renderEmailDelivery(order) {
+    const delivery = order.email_delivery;
+    if (!delivery) {
+        return '<span class="text-gray-400">-</span>';
+    }
+    const [label, style] = EMAIL_DELIVERY_STATUS[delivery.status] || [delivery.status, 'bg-gray-100 text-gray-800'];
+    const title = escapeHtml(delivery.error || delivery.response || '');
+    return `<button onclick="showOrderEmailLogs('${order.id}')" title="${title}" class="px-2 py-1 text-xs rounded ${style}">${label}</button>`;
+}
+
+// 查看订单的邮件发送日志
+async function showOrderEmailLogs(orderId) {
+    try {
+        const data = await fetchList('/admin/email-logs', { order_id: orderId, page_size: 50 });
+        if (data.items.length === 0) {
+            showAlert('发送日志', '没有发送记录');
+            return;
+        }
+        const rows = data.items.map(l => {
+            const [label] = EMAIL_DELIVERY_STATUS[l.status] || [l.status];
+            const detail = l.error || l.response || '';
+            return `<div class="text-left text-sm mb-2">${formatDate(l.updated_at)} ${escapeHtml(l.to)} <strong>${label}</strong>` +
+                (l.attempts ? ` (第 ${l.attempts} 次)` : '') +
+                (detail ? `<br><span class="text-gray-500 break-all">${escapeHtml(detail)}</span>` : '') + '</div>';
+        }).join('');
+        showAlert('发送日志', rows);
+    } catch (error) {
+        console.error('加载发送日志失败:', error);
+        showAlert('错误', '加载发送日志失败');
+    }
+}
+
+// 重新发送订单发货邮件
+async function resendOrderEmail(orderId) {
+    showConfirm('确认重发', `确定要重新发送订单 ${orderId} 的发货邮件吗？`, async () => {
         try {
             const headers = getAuthHeaders();
-            const response = await fetch(`${API_BASE_URL}/admin/users/${userId}`, {
-                method: 'DELETE',
+            const response = await fetch(`${API_BASE_URL}/admin/orders/${orderId}/resend-email`, {
+                method: 'POST',
                 headers: headers
             });
             
+            const data = await response.json();
             if (!response.ok) {
-                const data = await response.json();
-                throw new Error(data.error || '删除失败');
+                throw new Error(data.error || '重发失败');
             }
             
-            showAlert('成功', '用户删除成功', () => {
-                loadUsers();
-            });
+            showAlert('成功', '邮件已加入发送队列');
         } catch (error) {
-            console.error('删除用户失败:', error);
-            showAlert('错误', '删除失败: ' + error.message);
+            console.error('重发邮件失败:', error);
+            showAlert('错误', '重发失败: ' + error.message);
         }
     });
 }
 
-
-// 显示添加商品对话框
-function showAddProductModal() {
+// 显示退款/取消对话框
+function showRefundModal(orderId, type, remaining) {
+    const isCancel = type === 'cancel';
+    let keyAction = 'restock';
+    const keyActionOptions = [
+        { value: 'restock', label: '退回库存' },
+        { value: 'void', label: '作废卡密' }
+    ];
+    
     const modal = document.createElement('div');
     modal.className = 'fixed inset-0 bg-black bg-opacity-50 flex items-center justify-center z-50';
     modal.onclick = function(e) {
@@ -1132,30 +1588,34 @@ function showAddProductModal() {
     };
     modal.innerHTML = `
         <div class="bg-white rounded-lg p-6 max-w-md w-full mx-4">
-            <h3 class="text-xl font-medium mb-4">添加商品</h3>
+            <h3 class="text-xl font-medium mb-4">${isCancel ? '取消订单' : '订单退款'}</h3>
             <div class="space-y-4">
+                ${isCancel ? `
+                <p class="text-sm text-gray-600">取消订单将退还剩余金额 ￥${remaining.toFixed(2)}</p>
+                ` : `
                 <div>
-                    <label class="block text-sm font-medium text-gray-700 mb-2">商品名称</label>
-                    <input type="text" id="newProductName" class="w-full px-3 py-2 border border-gray-300 rounded focus:outline-none focus:ring-1 focus:ring-black" placeholder="请输入商品名称">
+                    <label class="block text-sm font-medium text-gray-700 mb-2">退款金额</label>
+                    <input type="number" id="refundAmount" value="${remaining.toFixed(2)}" step="0.01" min="0" max="${remaining}" class="w-full px-3 py-2 border border-gray-300 rounded focus:outline-none focus:ring-1 focus:ring-black">
+                    <p class="text-xs text-gray-500 mt-1">可退金额 ￥${remaining.toFixed(2)}，部分退款时卡密保留给用户</p>
                 </div>
+                `}
                 <div>
-                    <label class="block text-sm font-medium text-gray-700 mb-2">商品描述</label>
-                    <textarea id="newProductDesc" class="w-full px-3 py-2 border border-gray-300 rounded focus:outline-none focus:ring-1 focus:ring-black" rows="3" placeholder="请输入商品描述"></textarea>
+                    <label class="block text-sm font-medium text-gray-700 mb-2">卡密处理</label>
+                    ${createCustomDropdown(keyActionOptions, keyAction, (value) => {
+                        keyAction = value;
+                    })}
                 </div>
                 <div>
-                    <label class="block text-sm font-medium text-gray-700 mb-2">价格</label>
-                    <input type="number" id="newProductPrice" step="0.01" class="w-full px-3 py-2 border border-gray-300 rounded focus:outline-none focus:ring-1 focus:ring-black" placeholder="请输入价格">
-                </div>
-                <div class="bg-gray-50 p-3 rounded">
-                    <p class="text-xs text-gray-600">提示: 商品创建后,请前往"卡密管理"添加卡密,库存将自动计算</p>
+                    <label class="block text-sm font-medium text-gray-700 mb-2">原因</label>
+                    <textarea id="refundReason" class="w-full px-3 py-2 border border-gray-300 rounded focus:outline-none focus:ring-1 focus:ring-black" rows="3"></textarea>
                 </div>
             </div>
             <div class="flex justify-end space-x-3 mt-6">
                 <button onclick="this.closest('.fixed').remove()" class="px-4 py-2 text-gray-700 hover:bg-gray-100 rounded">
-                    取消
+                    关闭
                 </button>
-                <button onclick="createProduct()" class="px-4 py-2 bg-black text-white rounded hover:bg-gray-800">
-                    创建
+                <button onclick="submitRefund('${orderId}', '${type}')" class="px-4 py-2 bg-black text-white rounded hover:bg-gray-800">
+                    确认
                 </button>
             </div>
         </div>
@@ -1164,25 +1624,160 @@ function showAddProductModal() {
     document.body.appendChild(modal);
 }
 
-// 创建商品
-async function createProduct() {
-    const name = document.getElementById('newProductName').value.trim();
-    const description = document.getElementById('newProductDesc').value.trim();
-    const price = parseFloat(document.getElementById('newProductPrice').value);
+// 提交退款/取消
+async function submitRefund(orderId, type) {
+    const modal = document.querySelector('.fixed');
+    const dropdown = modal.querySelector('.custom-dropdown');
+    const keyAction = getDropdownValue(dropdown.id);
+    const reason = document.getElementById('refundReason').value.trim();
+    const amountInput = document.getElementById('refundAmount');
     
-    if (!name || !description || isNaN(price)) {
-        showAlert('提示', '请填写完整信息');
+    if (!reason) {
+        showAlert('提示', '请填写原因');
         return;
     }
     
-    if (price <= 0) {
-        showAlert('提示', '价格必须大于0');
-        return;
+    const body = { reason, key_action: keyAction };
+    if (amountInput) {
+        body.amount = parseFloat(amountInput.value) || 0;
     }
     
     try {
         const headers = getAuthHeaders();
-        const response = await fetch(`${API_BASE_URL}/admin/products`, {
+        const response = await fetch(`${API_BASE_URL}/admin/orders/${orderId}/${type}`, {
+            method: 'POST',
+            headers: headers,
+            body: JSON.stringify(body)
+        });
+        
+        const data = await response.json();
+        if (!response.ok) {
+            throw new Error(data.error || '操作失败');
+        }
+        
+        modal.remove();
+        showAlert('成功', data.message, () => {
+            loadOrders();
+        });
+    } catch (error) {
+        console.error('退款失败:', error);
+        showAlert('错误', '操作失败: ' + error.message);
+    }
+}
+
+// 删除订单
+async function deleteOrder(orderId) {
+    showConfirm('确认删除', `确定要删除订单 ${orderId} 吗？\n\n删除后可在回收站中恢复。`, async () => {
+        try {
+            const headers = getAuthHeaders();
+            const response = await fetch(`${API_BASE_URL}/admin/orders/${orderId}`, {
+                method: 'DELETE',
+                headers: headers
+            });
+            
+            if (!response.ok) {
+                const data = await response.json();
+                throw new Error(data.error || '删除失败');
+            }
+            
+            showAlert('成功', '订单删除成功', () => {
+                loadOrders();
+            });
+        } catch (error) {
+            console.error('删除订单失败:', error);
+            showAlert('错误', '删除失败: ' + error.message);
+        }
+    });
+}
+
+// 删除用户
+async function deleteUser(userId, userEmail) {
+    showConfirm('确认删除', `确定要删除用户 "${userEmail}" 吗？\n\n删除后可在回收站中恢复。`, async () => {
+        try {
+            const headers = getAuthHeaders();
+            const response = await fetch(`${API_BASE_URL}/admin/users/${userId}`, {
+                method: 'DELETE',
+                headers: headers
+            });
+            
+            if (!response.ok) {
+                const data = await response.json();
+                throw new Error(data.error || '删除失败');
+            }
+            
+            showAlert('成功', '用户删除成功', () => {
+                loadUsers();
+            });
+        } catch (error) {
+            console.error('删除用户失败:', error);
+            showAlert('错误', '删除失败: ' + error.message);
+        }
+    });
+}
+
+
+// 显示添加商品对话框
+function showAddProductModal() {
+    const modal = document.createElement('div');
+    modal.className = 'fixed inset-0 bg-black bg-opacity-50 flex items-center justify-center z-50';
+    modal.onclick = function(e) {
+        if (e.target === modal) {
+            modal.remove();
+        }
+    };
+    modal.innerHTML = `
+        <div class="bg-white rounded-lg p-6 max-w-md w-full mx-4">
+            <h3 class="text-xl font-medium mb-4">添加商品</h3>
+            <div class="space-y-4">
+                <div>
+                    <label class="block text-sm font-medium text-gray-700 mb-2">商品名称</label>
+                    <input type="text" id="newProductName" class="w-full px-3 py-2 border border-gray-300 rounded focus:outline-none focus:ring-1 focus:ring-black" placeholder="请输入商品名称">
+                </div>
+                <div>
+                    <label class="block text-sm font-medium text-gray-700 mb-2">商品描述</label>
+                    <textarea id="newProductDesc" class="w-full px-3 py-2 border border-gray-300 rounded focus:outline-none focus:ring-1 focus:ring-black" rows="3" placeholder="请输入商品描述"></textarea>
+                </div>
+                <div>
+                    <label class="block text-sm font-medium text-gray-700 mb-2">价格</label>
+                    <input type="number" id="newProductPrice" step="0.01" class="w-full px-3 py-2 border border-gray-300 rounded focus:outline-none focus:ring-1 focus:ring-black" placeholder="请输入价格">
+                </div>
+                <div class="bg-gray-50 p-3 rounded">
+                    <p class="text-xs text-gray-600">提示: 商品创建后,请前往"卡密管理"添加卡密,库存将自动计算</p>
+                </div>
+            </div>
+            <div class="flex justify-end space-x-3 mt-6">
+                <button onclick="this.closest('.fixed').remove()" class="px-4 py-2 text-gray-700 hover:bg-gray-100 rounded">
+                    取消
+                </button>
+                <button onclick="createProduct()" class="px-4 py-2 bg-black text-white rounded hover:bg-gray-800">
+                    创建
+                </button>
+            </div>
+        </div>
+    `;
+    
+    document.body.appendChild(modal);
+}
+
+// 创建商品
+async function createProduct() {
+    const name = document.getElementById('newProductName').value.trim();
+    const description = document.getElementById('newProductDesc').value.trim();
+    const price = parseFloat(document.getElementById('newProductPrice').value);
+    
+    if (!name || !description || isNaN(price)) {
+        showAlert('提示', '请填写完整信息');
+        return;
+    }
+    
+    if (price <= 0) {
+        showAlert('提示', '价格必须大于0');
+        return;
+    }
+    
+    try {
+        const headers = getAuthHeaders();
+        const response = await fetch(`${API_BASE_URL}/admin/products`, {
             method: 'POST',
             headers: headers,
             body: JSON.stringify({
@@ -1321,13 +1916,12 @@ async function editUser(userId) {
     try {
         const headers = getAuthHeaders();
         const [usersResponse, rolesResponse] = await Promise.all([
-            fetch(`${API_BASE_URL}/admin/users`, { headers }),
+            fetchList('/admin/users', { id: userId }),
             fetch(`${API_BASE_URL}/admin/roles`, { headers })
         ]);
         
-        const users = await usersResponse.json();
         const roles = await rolesResponse.json();
-        const user = users.find(u => u.id === userId);
+        const user = usersResponse.items[0];
         
         if (!user) {
             showAlert('错误', '用户不存在');
@@ -1544,20 +2138,29 @@ function getDropdownValue(dropdownId) {
 
 // 卡密管理相关功能
 let currentFilterProductId = '';
+// 各商品的卡密字段定义
+let productKeyFields = {};
+
+// 卡密状态名称
+const CARD_KEY_STATUS_NAMES = {
+    'unused': '未使用',
+    'used': '已使用',
+    'expired': '已过期',
+    'defective': '已失效',
+    'void': '已作废'
+};
 
 // 加载卡密列表
-async function loadCardKeys(productId = '') {
+async function loadCardKeys(productId = '', page = 1) {
     try {
-        const headers = getAuthHeaders();
-        const url = productId ? `${API_BASE_URL}/admin/cardkeys?product_id=${productId}` : `${API_BASE_URL}/admin/cardkeys`;
-        const response = await fetch(url, { headers });
-        
-        if (!response.ok) {
-            throw new Error(`HTTP ${response.status}`);
-        }
-        
-        const cardKeys = await response.json();
+        const data = await fetchList('/admin/cardkeys', {
+            page,
+            product_id: productId,
+            status: document.getElementById('cardKeyFilterStatus').value
+        });
+        const cardKeys = data.items;
         currentFilterProductId = productId;
+        renderPager('cardKeysPager', data, p => loadCardKeys(productId, p));
         
         // 加载商品列表用于筛选
         await loadProductFilter();
@@ -1568,20 +2171,27 @@ async function loadCardKeys(productId = '') {
             return;
         }
         
+        const user = JSON.parse(localStorage.getItem('user') || '{}');
+        const canReveal = checkPermission(user.role, 'cardkey:reveal');
+        
         tbody.innerHTML = cardKeys.map(ck => `
             <tr>
                 <td class="px-6 py-4 text-sm font-mono">${ck.id}</td>
                 <td class="px-6 py-4 text-sm">${ck.product_id}</td>
-                <td class="px-6 py-4 text-sm font-mono">${ck.key}</td>
+                <td class="px-6 py-4 text-sm font-mono">
+                    ${ck.fields ? renderCardKeyFields(ck.fields, productKeyFields[ck.product_id]) : ck.key}
+                    ${ck.expires_at ? `<div class="text-xs text-gray-500 font-sans">有效期至 ${ck.expires_at}</div>` : ''}
+                </td>
                 <td class="px-6 py-4 text-sm">
-                    <span class="px-2 py-1 text-xs rounded ${ck.status === 'unused' ? 'bg-green-100 text-green-800' : 'bg-gray-100 text-gray-800'}">
-                        ${ck.status === 'unused' ? '未使用' : '已使用'}
+                    <span class="px-2 py-1 text-xs rounded ${ck.status === 'unused' ? 'bg-green-100 text-green-800' : ck.status === 'expired' ? 'bg-red-100 text-red-800' : 'bg-gray-100 text-gray-800'}">
+                        ${CARD_KEY_STATUS_NAMES[ck.status] || ck.status}
                     </span>
                 </td>
                 <td class="px-6 py-4 text-sm">${ck.order_id || '-'}</td>
                 <td class="px-6 py-4 text-sm">${ck.used_at ? formatDate(ck.used_at) : '-'}</td>
                 <td class="px-6 py-4 text-sm">
-                    ${ck.status === 'unused' ? `<button onclick="deleteCardKey('${ck.id}')" class="text-red-600 hover:underline">删除</button>` : '<span class="text-gray-400">已使用</span>'}
+                    ${canReveal && !ck.file_id ? `<button onclick="showRevealCardKeyModal('${ck.id}')" class="text-black hover:underline mr-3">查看</button>` : ''}
+                    ${ck.status !== 'used' ? `<button onclick="deleteCardKey('${ck.id}')" class="text-red-600 hover:underline">删除</button>` : '<span class="text-gray-400">已使用</span>'}
                 </td>
             </tr>
         `).join('');
@@ -1595,12 +2205,84 @@ async function loadCardKeys(productId = '') {
     }
 }
 
+// 显示查看卡密明文对话框
+function showRevealCardKeyModal(cardKeyId) {
+    const modal = document.createElement('div');
+    modal.className = 'fixed inset-0 bg-black bg-opacity-50 flex items-center justify-center z-50';
+    modal.onclick = function(e) {
+        if (e.target === modal) {
+            modal.remove();
+        }
+    };
+    modal.innerHTML = `
+        <div class="bg-white rounded-lg p-6 max-w-md w-full mx-4">
+            <h3 class="text-xl font-medium mb-4">查看卡密</h3>
+            <div class="space-y-4">
+                <p class="text-sm text-gray-600">查看卡密明文会记录操作人和原因。</p>
+                <div>
+                    <label class="block text-sm font-medium text-gray-700 mb-2">查看原因</label>
+                    <textarea id="revealReason" class="w-full px-3 py-2 border border-gray-300 rounded focus:outline-none focus:ring-1 focus:ring-black" rows="3" placeholder="例如: 核对用户反馈的卡密"></textarea>
+                </div>
+            </div>
+            <div class="flex justify-end space-x-3 mt-6">
+                <button onclick="this.closest('.fixed').remove()" class="px-4 py-2 text-gray-700 hover:bg-gray-100 rounded">
+                    取消
+                </button>
+                <button onclick="revealCardKey('${cardKeyId}')" class="px-4 py-2 bg-black text-white rounded hover:bg-gray-800">
+                    查看
+                </button>
+            </div>
+        </div>
+    `;
+    
+    document.body.appendChild(modal);
+}
+
+// 查看卡密明文
+async function revealCardKey(cardKeyId) {
+    const reason = document.getElementById('revealReason').value.trim();
+    if (!reason) {
+        showAlert('提示', '请填写查看原因');
+        return;
+    }
+    
+    try {
+        const headers = getAuthHeaders();
+        const response = await fetch(`${API_BASE_URL}/admin/cardkeys/${cardKeyId}/reveal`, {
+            method: 'POST',
+            headers: headers,
+            body: JSON.stringify({ reason: reason })
+        });
+        
+        const data = await response.json();
+        if (!response.ok) {
+            throw new Error(data.error || '查看失败');
+        }
+        
+        document.querySelector('.fixed').remove();
+        
+        const content = data.fields
+            ? Object.entries(data.fields).map(([name, value]) => `${escapeHtml(name)}: ${escapeHtml(value)}`).join('<br>')
+            : escapeHtml(data.key);
+        const remaining = data.remaining >= 0 ? `<div class="text-xs text-gray-500 mt-2">今日剩余查看次数: ${data.remaining}</div>` : '';
+        showAlert('卡密明文', `<div class="font-mono break-all">${content}</div>${remaining}`);
+    } catch (error) {
+        console.error('查看卡密失败:', error);
+        showAlert('错误', '查看失败: ' + error.message);
+    }
+}
+
 // 加载商品筛选器
 async function loadProductFilter() {
     try {
         const response = await fetch(`${API_BASE_URL}/products`);
         const products = await response.json();
         
+        productKeyFields = {};
+        products.forEach(p => {
+            productKeyFields[p.id] = p.key_fields || [];
+        });
+        
         const options = [
             { value: '', label: '全部商品' },
             ...products.map(p => ({ value: p.id, label: `${p.name} (${p.id})` }))
@@ -1654,6 +2336,10 @@ async function showAddCardKeyModal() {
                         <label class="block text-sm font-medium text-gray-700 mb-2">卡密</label>
                         <input type="text" id="newCardKey" class="w-full px-3 py-2 border border-gray-300 rounded focus:outline-none focus:ring-1 focus:ring-black" placeholder="请输入卡密">
                     </div>
+                    <div>
+                        <label class="block text-sm font-medium text-gray-700 mb-2">有效期 (可选)</label>
+                        <input type="date" id="newCardKeyExpiresAt" class="w-full px-3 py-2 border border-gray-300 rounded focus:outline-none focus:ring-1 focus:ring-black">
+                    </div>
                 </div>
                 <div class="flex justify-end space-x-3 mt-6">
                     <button onclick="this.closest('.fixed').remove()" class="px-4 py-2 text-gray-700 hover:bg-gray-100 rounded">
@@ -1679,6 +2365,7 @@ async function createCardKey() {
     const dropdown = modal.querySelector('.custom-dropdown');
     const productId = getDropdownValue(dropdown.id);
     const key = document.getElementById('newCardKey').value.trim();
+    const expiresAt = document.getElementById('newCardKeyExpiresAt').value;
     
     if (!key) {
         showAlert('提示', '请输入卡密');
@@ -1693,7 +2380,8 @@ async function createCardKey() {
             body: JSON.stringify({
                 id: 'CK' + Date.now(),
                 product_id: productId,
-                key: key
+                key: key,
+                expires_at: expiresAt
             })
         });
         
@@ -1748,10 +2436,14 @@ async function showBatchAddCardKeyModal() {
                         })}
                     </div>
                     <div>
-                        <label class="block text-sm font-medium text-gray-700 mb-2">卡密列表 (每行一个)</label>
+                        <label class="block text-sm font-medium text-gray-700 mb-2">卡密列表 (每行一个, CSV 格式)</label>
                         <textarea id="batchCardKeys" class="w-full px-3 py-2 border border-gray-300 rounded focus:outline-none focus:ring-1 focus:ring-black" rows="10" placeholder="请输入卡密，每行一个&#10;例如：&#10;ABCD-1234-EFGH&#10;IJKL-5678-MNOP&#10;QRST-9012-UVWX"></textarea>
-                        <p class="text-xs text-gray-500 mt-1">每行一个卡密，空行将被忽略</p>
+                        <p class="text-xs text-gray-500 mt-1">每行一个卡密，空行将被忽略；多字段卡密按商品字段顺序用逗号分隔各列；使用表头时可增加"有效期"列</p>
                     </div>
+                    <label class="flex items-center text-sm text-gray-700">
+                        <input type="checkbox" id="batchHasHeader" class="mr-2">
+                        首行为表头 (按表头匹配字段)
+                    </label>
                 </div>
                 <div class="flex justify-end space-x-3 mt-6">
                     <button onclick="this.closest('.fixed').remove()" class="px-4 py-2 text-gray-700 hover:bg-gray-100 rounded">
@@ -1790,37 +2482,24 @@ async function batchCreateCardKeys() {
     
     try {
         const headers = getAuthHeaders();
-        let successCount = 0;
-        let failCount = 0;
-        
-        // 逐个创建卡密
-        for (const key of keys) {
-            try {
-                const response = await fetch(`${API_BASE_URL}/admin/cardkeys`, {
-                    method: 'POST',
-                    headers: headers,
-                    body: JSON.stringify({
-                        id: 'CK' + Date.now() + '_' + Math.random().toString(36).substr(2, 9),
-                        product_id: productId,
-                        key: key
-                    })
-                });
-                
-                if (response.ok) {
-                    successCount++;
-                } else {
-                    failCount++;
-                }
-                
-                // 添加小延迟避免ID冲突
-                await new Promise(resolve => setTimeout(resolve, 10));
-            } catch (error) {
-                failCount++;
-            }
+        const response = await fetch(`${API_BASE_URL}/admin/cardkeys/import`, {
+            method: 'POST',
+            headers: headers,
+            body: JSON.stringify({
+                product_id: productId,
+                csv: keys.join('\n'),
+                has_header: document.getElementById('batchHasHeader').checked
+            })
+        });
+        
+        const data = await response.json();
+        if (!response.ok) {
+            throw new Error(data.error || '导入失败');
         }
         
         modal.remove();
-        showAlert('完成', `成功创建 ${successCount} 个卡密${failCount > 0 ? `，失败 ${failCount} 个` : ''}`, () => {
+        const failures = (data.errors || []).map(e => `第 ${e.line} 行: ${e.error}`).join('<br>');
+        showAlert('完成', `成功创建 ${data.imported} 个卡密${data.failed > 0 ? `，失败 ${data.failed} 个<br>${failures}` : ''}`, () => {
             loadCardKeys(currentFilterProductId);
         });
     } catch (error) {
@@ -1829,69 +2508,366 @@ async function batchCreateCardKeys() {
     }
 }
 
-// 删除卡密
-async function deleteCardKey(cardKeyId) {
-    showConfirm('确认删除', '确定要删除这个卡密吗？', async () => {
-        try {
-            const headers = getAuthHeaders();
-            const response = await fetch(`${API_BASE_URL}/admin/cardkeys/${cardKeyId}`, {
-                method: 'DELETE',
-                headers: headers
-            });
-            
-            if (!response.ok) {
-                const data = await response.json();
-                throw new Error(data.error || '删除失败');
-            }
-            
-            showAlert('成功', '卡密删除成功', () => {
-                loadCardKeys(currentFilterProductId);
-            });
-        } catch (error) {
-            console.error('删除卡密失败:', error);
-            showAlert('错误', '删除失败: ' + error.message);
-        }
-    });
-}
-
-
-// 系统设置相关功能
-
-// 加载系统设置
-async function loadSettings() {
+// 显示上传文件类卡密对话框
+async function showUploadCardKeyFileModal() {
     try {
-        const headers = getAuthHeaders();
-        const response = await fetch(`${API_BASE_URL}/admin/settings`, { headers });
+        const response = await fetch(`${API_BASE_URL}/products`);
+        const products = await response.json();
         
-        if (!response.ok) {
-            throw new Error(`HTTP ${response.status}`);
+        if (products.length === 0) {
+            showAlert('提示', '请先添加商品');
+            return;
         }
         
-        const settings = await response.json();
-        
-        // 填充网站配置
-        if (settings.site) {
-            document.getElementById('siteName').value = settings.site.name || 'AI HACKER';
-            document.getElementById('siteAnnouncement').value = settings.site.announcement || '';
-            document.getElementById('footerCopyright').value = settings.site.footer_copyright || '';
-            document.getElementById('purchaseInterval').value = settings.site.purchase_interval || '5';
-            document.getElementById('enableRegister').checked = settings.site.enable_register !== 'false';
-        }
+        const productOptions = products.map(p => ({
+            value: p.id,
+            label: `${p.name} (${p.id})`
+        }));
         
-        // 填充邮件配置
-        if (settings.email) {
-            document.getElementById('smtpHost').value = settings.email.smtp_host || '';
-            document.getElementById('smtpPort').value = settings.email.smtp_port || 587;
-            document.getElementById('smtpUsername').value = settings.email.username || '';
-            document.getElementById('smtpPassword').value = ''; // 不显示密码
-            document.getElementById('smtpFrom').value = settings.email.from || '';
-        }
+        let selectedProduct = currentFilterProductId || products[0].id;
         
-        // 填充法律文档
-        if (settings.legal) {
+        const modal = document.createElement('div');
+        modal.className = 'fixed inset-0 bg-black bg-opacity-50 flex items-center justify-center z-50';
+        modal.onclick = function(e) {
+            if (e.target === modal) {
+                modal.remove();
+            }
+        };
+        modal.innerHTML = `
+            <div class="bg-white rounded-lg p-6 max-w-md w-full mx-4">
+                <h3 class="text-xl font-medium mb-4">上传文件卡密</h3>
+                <div class="space-y-4">
+                    <div>
+                        <label class="block text-sm font-medium text-gray-700 mb-2">选择商品</label>
+                        ${createCustomDropdown(productOptions, selectedProduct, (value) => {
+                            selectedProduct = value;
+                        })}
+                    </div>
+                    <div>
+                        <label class="block text-sm font-medium text-gray-700 mb-2">文件</label>
+                        <input type="file" id="cardKeyFiles" multiple class="w-full text-sm">
+                        <p class="text-xs text-gray-500 mt-1">每个文件生成一个卡密，购买后通过限时链接下载</p>
+                    </div>
+                </div>
+                <div class="flex justify-end space-x-3 mt-6">
+                    <button onclick="this.closest('.fixed').remove()" class="px-4 py-2 text-gray-700 hover:bg-gray-100 rounded">
+                        取消
+                    </button>
+                    <button onclick="uploadCardKeyFiles()" class="px-4 py-2 bg-black text-white rounded hover:bg-gray-800">
+                        上传
+                    </button>
+                </div>
+            </div>
+        `;
+        
+        document.body.appendChild(modal);
+    } catch (error) {
+        console.error('加载商品列表失败:', error);
+        showAlert('错误', '加载商品列表失败');
+    }
+}
+
+// 上传文件类卡密
+async function uploadCardKeyFiles() {
+    const modal = document.querySelector('.fixed');
+    const dropdown = modal.querySelector('.custom-dropdown');
+    const productId = getDropdownValue(dropdown.id);
+    const files = document.getElementById('cardKeyFiles').files;
+    
+    if (files.length === 0) {
+        showAlert('提示', '请选择要上传的文件');
+        return;
+    }
+    
+    const formData = new FormData();
+    formData.append('product_id', productId);
+    for (const file of files) {
+        formData.append('file', file);
+    }
+    
+    try {
+        // 由浏览器设置 multipart 边界
+        const headers = getAuthHeaders();
+        delete headers['Content-Type'];
+        
+        const response = await fetch(`${API_BASE_URL}/admin/cardkeys/upload`, {
+            method: 'POST',
+            headers: headers,
+            body: formData
+        });
+        
+        const data = await response.json();
+        if (!response.ok) {
+            throw new Error(data.error || '上传失败');
+        }
+        
+        modal.remove();
+        showAlert('成功', data.message, () => {
+            loadCardKeys(currentFilterProductId);
+        });
+    } catch (error) {
+        console.error('上传文件失败:', error);
+        showAlert('错误', '上传失败: ' + error.message);
+    }
+}
+
+// 删除卡密
+async function deleteCardKey(cardKeyId) {
+    showConfirm('确认删除', '确定要删除这个卡密吗？\n\n删除后可在回收站中恢复。', async () => {
+        try {
+            const headers = getAuthHeaders();
+            const response = await fetch(`${API_BASE_URL}/admin/cardkeys/${cardKeyId}`, {
+                method: 'DELETE',
+                headers: headers
+            });
+            
+            if (!response.ok) {
+                const data = await response.json();
+                throw new Error(data.error || '删除失败');
+            }
+            
+            showAlert('成功', '卡密删除成功', () => {
+                loadCardKeys(currentFilterProductId);
+            });
+        } catch (error) {
+            console.error('删除卡密失败:', error);
+            showAlert('错误', '删除失败: ' + error.message);
+        }
+    });
+}
+
+
+// 系统设置相关功能
+
+// 回收站各类记录的权限和展示方式
+const TRASH_ENTITIES = {
+    orders: {
+        permission: 'order:manage',
+        summary: item => `${item.product_name} / ${item.email} / ¥${item.amount}`
+    },
+    users: {
+        permission: 'user:manage',
+        summary: item => item.email
+    },
+    products: {
+        permission: 'product:manage',
+        summary: item => `${item.name} / ¥${item.price}`
+    },
+    cardkeys: {
+        permission: 'cardkey:manage',
+        summary: item => `${item.product_id} / ${item.key}`
+    }
+};
+
+let currentTrashEntity = '';
+
+// 加载回收站
+async function loadTrash(entity, page = 1) {
+    const user = JSON.parse(localStorage.getItem('user') || '{}');
+    const allowed = Object.keys(TRASH_ENTITIES).filter(e => checkPermission(user.role, TRASH_ENTITIES[e].permission));
+    
+    // 只显示有权限的分类
+    document.querySelectorAll('.trash-tab').forEach(tab => {
+        tab.style.display = allowed.includes(tab.dataset.entity) ? '' : 'none';
+    });
+    
+    entity = entity || currentTrashEntity || allowed[0];
+    if (!allowed.includes(entity)) {
+        entity = allowed[0];
+    }
+    currentTrashEntity = entity;
+    
+    document.querySelectorAll('.trash-tab').forEach(tab => {
+        tab.classList.toggle('bg-black', tab.dataset.entity === entity);
+        tab.classList.toggle('text-white', tab.dataset.entity === entity);
+    });
+    
+    const tbody = document.getElementById('trashTable');
+    if (!entity) {
+        tbody.innerHTML = '<tr><td colspan="5" class="px-6 py-8 text-center text-gray-500">暂无权限</td></tr>';
+        return;
+    }
+    
+    try {
+        const data = await fetchList(`/admin/trash/${entity}`, { page });
+        const items = data.items;
+        renderPager('trashPager', data, p => loadTrash(entity, p));
+        
+        if (items.length === 0) {
+            tbody.innerHTML = '<tr><td colspan="5" class="px-6 py-8 text-center text-gray-500">回收站为空</td></tr>';
+            return;
+        }
+        
+        tbody.innerHTML = items.map(item => `
+            <tr>
+                <td class="px-6 py-4 text-sm font-mono">${item.id}</td>
+                <td class="px-6 py-4 text-sm">${escapeHtml(TRASH_ENTITIES[entity].summary(item))}</td>
+                <td class="px-6 py-4 text-sm">${escapeHtml(item.deleted_by || '-')}</td>
+                <td class="px-6 py-4 text-sm text-gray-500">${formatDate(item.deleted_at)}</td>
+                <td class="px-6 py-4 text-sm">
+                    <button onclick="restoreTrashItem('${entity}', '${item.id}')" class="text-black hover:underline">恢复</button>
+                </td>
+            </tr>
+        `).join('');
+    } catch (error) {
+        console.error('加载回收站失败:', error);
+        tbody.innerHTML = '<tr><td colspan="5" class="px-6 py-8 text-center text-red-500">加载失败</td></tr>';
+    }
+}
+
+// 从回收站恢复
+async function restoreTrashItem(entity, id) {
+    try {
+        const headers = getAuthHeaders();
+        const response = await fetch(`${API_BASE_URL}/admin/trash/${entity}/${id}/restore`, {
+            method: 'POST',
+            headers: headers
+        });
+        
+        const data = await response.json();
+        if (!response.ok) {
+            throw new Error(data.error || '恢复失败');
+        }
+        
+        showAlert('成功', data.message);
+        loadTrash(entity);
+    } catch (error) {
+        console.error('恢复失败:', error);
+        showAlert('错误', '恢复失败: ' + error.message);
+    }
+}
+
+// 加载审计日志
+async function loadAuditLogs(page = 1) {
+    const tbody = document.getElementById('auditTable');
+    try {
+        const data = await fetchList('/admin/audit-logs', {
+            page,
+            actor: document.getElementById('auditActor').value.trim(),
+            entity: document.getElementById('auditEntity').value.trim(),
+            from: document.getElementById('auditFrom').value,
+            to: document.getElementById('auditTo').value
+        });
+        const entries = data.items;
+        renderPager('auditPager', data, loadAuditLogs);
+        
+        if (entries.length === 0) {
+            tbody.innerHTML = '<tr><td colspan="6" class="px-6 py-8 text-center text-gray-500">暂无记录</td></tr>';
+            return;
+        }
+        
+        tbody.innerHTML = entries.map(entry => {
+            const diff = entry.diff ? Object.keys(entry.diff).map(field => {
+                const change = entry.diff[field];
+                return `${escapeHtml(field)}: ${escapeHtml(JSON.stringify(change.before))} → ${escapeHtml(JSON.stringify(change.after))}`;
+            }).join('<br>') : '';
+            const detail = entry.detail ? `<div class="text-gray-500">${escapeHtml(entry.detail)}</div>` : '';
+            return `
+                <tr>
+                    <td class="px-6 py-4 text-sm text-gray-500 whitespace-nowrap">${formatDate(entry.time)}</td>
+                    <td class="px-6 py-4 text-sm">${escapeHtml(entry.actor)}</td>
+                    <td class="px-6 py-4 text-sm font-mono">${escapeHtml(entry.action)}</td>
+                    <td class="px-6 py-4 text-sm font-mono">${escapeHtml(entry.target_id || '-')}</td>
+                    <td class="px-6 py-4 text-xs break-all">${diff}${detail}</td>
+                    <td class="px-6 py-4 text-sm text-gray-500">${escapeHtml(entry.ip)} / ${entry.status}</td>
+                </tr>
+            `;
+        }).join('');
+    } catch (error) {
+        console.error('加载审计日志失败:', error);
+        tbody.innerHTML = `<tr><td colspan="6" class="px-6 py-8 text-center text-red-500">加载失败: ${escapeHtml(error.message)}</td></tr>`;
+    }
+}
+
+// 校验审计日志完整性
+async function verifyAuditLog() {
+    try {
+        const headers = getAuthHeaders();
+        const response = await fetch(`${API_BASE_URL}/admin/audit-logs/verify`, { headers });
+        const data = await response.json();
+        
+        if (!response.ok) {
+            throw new Error(data.error || '校验失败');
+        }
+        
+        if (data.valid) {
+            showAlert('校验通过', `共 ${data.verified} 条记录，哈希链完整`);
+        } else {
+            showAlert('校验失败', `前 ${data.verified} 条记录完整，${escapeHtml(data.error)}`);
+        }
+    } catch (error) {
+        console.error('校验审计日志失败:', error);
+        showAlert('错误', '校验失败: ' + error.message);
+    }
+}
+
+// 加载系统设置
+async function loadSettings() {
+    try {
+        const headers = getAuthHeaders();
+        const response = await fetch(`${API_BASE_URL}/admin/settings`, { headers });
+        
+        if (!response.ok) {
+            throw new Error(`HTTP ${response.status}`);
+        }
+        
+        const settings = await response.json();
+        
+        // 填充网站配置
+        if (settings.site) {
+            document.getElementById('siteName').value = settings.site.name || 'AI HACKER';
+            document.getElementById('siteAnnouncement').value = settings.site.announcement || '';
+            document.getElementById('footerCopyright').value = settings.site.footer_copyright || '';
+            document.getElementById('purchaseInterval').value = settings.site.purchase_interval || '5';
+            document.getElementById('trashRetentionDays').value = settings.site.trash_retention_days || '30';
+            document.getElementById('deletePolicy').value = settings.site.delete_policy || 'cascade';
+            document.getElementById('backupIntervalHours').value = settings.site.backup_interval_hours || '24';
+            document.getElementById('backupRetention').value = settings.site.backup_retention || '7';
+            document.getElementById('enableRegister').checked = settings.site.enable_register !== 'false';
+        }
+        
+        // 填充邮件配置
+        if (settings.email) {
+            document.getElementById('smtpHost').value = settings.email.smtp_host || '';
+            document.getElementById('smtpPort').value = settings.email.smtp_port || 587;
+            document.getElementById('smtpUsername').value = settings.email.username || '';
+            document.getElementById('smtpPassword').value = ''; // 不显示密码
+            document.getElementById('smtpFrom').value = settings.email.from || '';
+            document.getElementById('mailTransport').value = settings.email.transport || 'smtp';
+            document.getElementById('smtpSecurity').value = settings.email.security || '';
+            document.getElementById('mailFilePath').value = settings.email.file_path || '';
+            document.getElementById('mailApiProvider').value = settings.email.api_provider || 'sendgrid';
+            document.getElementById('mailApiKey').value = ''; // 不显示密钥
+            document.getElementById('mailApiKey').placeholder = settings.email.api_key_set ? '已设置,留空则不修改' : '输入 API 密钥';
+            document.getElementById('mailApiBaseURL').value = settings.email.api_base_url || '';
+            document.getElementById('mailApiDomain').value = settings.email.api_domain || '';
+            toggleMailTransport();
+        }
+        
+        // 填充告警配置
+        if (settings.alerts) {
+            document.getElementById('alertWebhookUrl').value = settings.alerts.webhook_url || '';
+            document.getElementById('revealDailyQuota').value = settings.alerts.reveal_daily_quota || '0';
+        }
+        
+        // 填充通知配置
+        if (settings.notifications) {
+            document.getElementById('telegramBotToken').value = ''; // 不显示令牌
+            document.getElementById('telegramBotToken').placeholder = settings.notifications.telegram_bot_token_set ? '已设置,留空则不修改' : '123456:ABC-DEF...';
+            document.getElementById('telegramChatId').value = settings.notifications.telegram_chat_id || '';
+            document.getElementById('telegramApiBaseUrl').value = settings.notifications.telegram_api_base_url || '';
+            renderNotifyRoutes(settings.notifications);
+        }
+        
+        // 填充法律文档
+        if (settings.legal) {
             document.getElementById('termsOfService').value = settings.legal.terms || '';
             document.getElementById('privacyPolicy').value = settings.legal.privacy || '';
         }
+        
+        loadBackups();
+        loadEmailTemplates();
+        loadWebhooks();
     } catch (error) {
         console.error('加载系统设置失败:', error);
         if (error.message.includes('401')) {
@@ -1912,6 +2888,10 @@ async function saveSiteConfig() {
     const announcement = document.getElementById('siteAnnouncement').value.trim();
     const footerCopyright = document.getElementById('footerCopyright').value.trim();
     const purchaseInterval = document.getElementById('purchaseInterval').value.trim();
+    const trashRetentionDays = document.getElementById('trashRetentionDays').value.trim();
+    const deletePolicy = document.getElementById('deletePolicy').value;
+    const backupIntervalHours = document.getElementById('backupIntervalHours').value.trim();
+    const backupRetention = document.getElementById('backupRetention').value.trim();
     const enableRegister = document.getElementById('enableRegister').checked ? 'true' : 'false';
     
     if (!siteName) {
@@ -1924,6 +2904,21 @@ async function saveSiteConfig() {
         return;
     }
     
+    if (trashRetentionDays && (isNaN(trashRetentionDays) || parseInt(trashRetentionDays) < 1)) {
+        showAlert('提示', '回收站保留天数必须是大于0的整数');
+        return;
+    }
+    
+    if (backupIntervalHours && (isNaN(backupIntervalHours) || parseInt(backupIntervalHours) < 0)) {
+        showAlert('提示', '定时备份间隔必须是大于等于0的整数，0表示关闭');
+        return;
+    }
+    
+    if (backupRetention && (isNaN(backupRetention) || parseInt(backupRetention) < 1)) {
+        showAlert('提示', '保留备份数量必须是大于0的整数');
+        return;
+    }
+    
     try {
         const headers = getAuthHeaders();
         const response = await fetch(`${API_BASE_URL}/admin/settings/site`, {
@@ -1934,6 +2929,10 @@ async function saveSiteConfig() {
                 announcement: announcement,
                 footer_copyright: footerCopyright,
                 purchase_interval: purchaseInterval || '5',
+                trash_retention_days: trashRetentionDays || '30',
+                delete_policy: deletePolicy,
+                backup_interval_hours: backupIntervalHours || '24',
+                backup_retention: backupRetention || '7',
                 enable_register: enableRegister
             })
         });
@@ -1950,30 +2949,555 @@ async function saveSiteConfig() {
     }
 }
 
+// 邮件模板列表
+let emailTemplates = [];
+
+// 加载邮件模板
+async function loadEmailTemplates() {
+    try {
+        const response = await fetch(`${API_BASE_URL}/admin/email-templates`, { headers: getAuthHeaders() });
+        const data = await response.json();
+        if (!response.ok) {
+            throw new Error(data.error || `HTTP ${response.status}`);
+        }
+        
+        emailTemplates = data.templates;
+        const select = document.getElementById('emailTemplateName');
+        const current = select.value;
+        select.innerHTML = emailTemplates.map(t => `
+            <option value="${escapeHtml(t.name)}">${escapeHtml(t.title)}${t.customized ? ' (已修改)' : ''}</option>
+        `).join('');
+        if (current && emailTemplates.some(t => t.name === current)) {
+            select.value = current;
+        }
+        selectEmailTemplate();
+    } catch (error) {
+        console.error('加载邮件模板失败:', error);
+    }
+}
+
+// 显示选中的邮件模板
+function selectEmailTemplate() {
+    const name = document.getElementById('emailTemplateName').value;
+    const tpl = emailTemplates.find(t => t.name === name);
+    if (!tpl) {
+        return;
+    }
+    
+    document.getElementById('emailTemplateSubject').value = tpl.subject;
+    document.getElementById('emailTemplateHtml').value = tpl.html;
+    document.getElementById('emailTemplateText').value = tpl.text;
+    document.getElementById('emailTemplateVars').innerHTML = '<div class="font-medium mb-1">可用变量</div>' + tpl.variables.map(v => `
+        <div><code>${escapeHtml(v.name)}</code> ${escapeHtml(v.description)}</div>
+    `).join('');
+    document.getElementById('emailTemplatePreview').classList.add('hidden');
+}
+
+// 编辑中的邮件模板内容
+function emailTemplateForm() {
+    return {
+        subject: document.getElementById('emailTemplateSubject').value,
+        html: document.getElementById('emailTemplateHtml').value,
+        text: document.getElementById('emailTemplateText').value
+    };
+}
+
+// 保存邮件模板
+async function saveEmailTemplate() {
+    const name = document.getElementById('emailTemplateName').value;
+    try {
+        const response = await fetch(`${API_BASE_URL}/admin/email-templates/${encodeURIComponent(name)}`, {
+            method: 'PUT',
+            headers: getAuthHeaders(),
+            body: JSON.stringify(emailTemplateForm())
+        });
+        
+        const data = await response.json();
+        if (!response.ok) {
+            throw new Error(data.error || '保存失败');
+        }
+        
+        showAlert('成功', '邮件模板已保存');
+        loadEmailTemplates();
+    } catch (error) {
+        console.error('保存邮件模板失败:', error);
+        showAlert('错误', '保存失败: ' + escapeHtml(error.message));
+    }
+}
+
+// 使用示例数据预览邮件模板
+async function previewEmailTemplate() {
+    const name = document.getElementById('emailTemplateName').value;
+    try {
+        const response = await fetch(`${API_BASE_URL}/admin/email-templates/${encodeURIComponent(name)}/preview`, {
+            method: 'POST',
+            headers: getAuthHeaders(),
+            body: JSON.stringify(emailTemplateForm())
+        });
+        
+        const data = await response.json();
+        if (!response.ok) {
+            throw new Error(data.error || '预览失败');
+        }
+        
+        document.getElementById('emailTemplatePreviewSubject').textContent = data.subject;
+        document.getElementById('emailTemplatePreviewHtml').srcdoc = data.html;
+        document.getElementById('emailTemplatePreviewText').textContent = data.text;
+        document.getElementById('emailTemplatePreview').classList.remove('hidden');
+    } catch (error) {
+        console.error('预览邮件模板失败:', error);
+        showAlert('错误', '预览失败: ' + escapeHtml(error.message));
+    }
+}
+
+// 恢复默认邮件模板
+async function resetEmailTemplate() {
+    const name = document.getElementById('emailTemplateName').value;
+    showConfirm('确认恢复', '确定要将该模板恢复为默认内容吗？', async () => {
+        try {
+            const response = await fetch(`${API_BASE_URL}/admin/email-templates/${encodeURIComponent(name)}/reset`, {
+                method: 'POST',
+                headers: getAuthHeaders()
+            });
+            
+            const data = await response.json();
+            if (!response.ok) {
+                throw new Error(data.error || '恢复失败');
+            }
+            
+            showAlert('成功', '已恢复默认模板');
+            loadEmailTemplates();
+        } catch (error) {
+            console.error('恢复默认模板失败:', error);
+            showAlert('错误', '恢复失败: ' + escapeHtml(error.message));
+        }
+    });
+}
+
+// 格式化文件大小
+function formatFileSize(bytes) {
+    if (bytes < 1024) {
+        return `${bytes} B`;
+    }
+    if (bytes < 1024 * 1024) {
+        return `${(bytes / 1024).toFixed(1)} KB`;
+    }
+    return `${(bytes / 1024 / 1024).toFixed(1)} MB`;
+}
+
+// Webhook 推送状态的显示名称
+const WEBHOOK_DELIVERY_STATUS = {
+    pending: '等待推送',
+    sending: '推送中',
+    delivered: '已送达',
+    dead: '已停止重试'
+};
+
+// 加载 Webhook 列表和最近的推送记录
+async function loadWebhooks() {
+    const list = document.getElementById('webhookList');
+    try {
+        const data = await fetchList('/admin/webhooks');
+        
+        const events = document.getElementById('webhookEvents');
+        if (!events.children.length) {
+            events.innerHTML = data.events.map(e => `
+                <label class="flex items-center gap-1"><input type="checkbox" value="${e}" class="webhook-event"> ${e}</label>
+            `).join('');
+        }
+        
+        if (data.webhooks.length === 0) {
+            list.innerHTML = '<div class="px-4 py-3 text-gray-500">暂无 Webhook</div>';
+        } else {
+            list.innerHTML = data.webhooks.map(h => `
+                <div class="px-4 py-3 flex justify-between items-center">
+                    <div>
+                        <div class="font-mono break-all">${escapeHtml(h.url)}${h.active ? '' : ' <span class="text-xs text-gray-500">(已停用)</span>'}</div>
+                        <div class="text-xs text-gray-500">${h.description ? escapeHtml(h.description) + ' · ' : ''}${h.events.map(escapeHtml).join(', ')}</div>
+                    </div>
+                    <div class="whitespace-nowrap">
+                        <button onclick="pingWebhook('${h.id}')" class="text-blue-600 hover:underline mr-3">测试</button>
+                        <button onclick="updateWebhook('${h.id}', {active: ${!h.active}})" class="text-blue-600 hover:underline mr-3">${h.active ? '停用' : '启用'}</button>
+                        <button onclick="updateWebhook('${h.id}', {rotate_secret: true})" class="text-blue-600 hover:underline mr-3">重新生成密钥</button>
+                        <button onclick="deleteWebhook('${h.id}')" class="text-red-600 hover:underline">删除</button>
+                    </div>
+                </div>
+            `).join('');
+        }
+    } catch (error) {
+        console.error('加载 Webhook 失败:', error);
+        list.innerHTML = `<div class="px-4 py-3 text-red-500">加载失败: ${escapeHtml(error.message)}</div>`;
+        return;
+    }
+    loadWebhookDeliveries();
+}
+
+// 加载最近的推送记录
+async function loadWebhookDeliveries() {
+    const list = document.getElementById('webhookDeliveryList');
+    try {
+        const data = await fetchList('/admin/webhooks/deliveries', { page_size: 20 });
+        if (data.items.length === 0) {
+            list.innerHTML = '<div class="px-4 py-3 text-gray-500">暂无推送记录</div>';
+            return;
+        }
+        list.innerHTML = data.items.map(d => {
+            const attempts = d.attempts || [];
+            const last = attempts[attempts.length - 1];
+            const detail = last ? (last.error || `HTTP ${last.status_code}`) + ` · ${last.duration_ms}ms` : '';
+            return `
+                <div class="px-4 py-3 flex justify-between items-center">
+                    <div>
+                        <div><span class="font-mono">${escapeHtml(d.event)}</span> · ${WEBHOOK_DELIVERY_STATUS[d.status] || escapeHtml(d.status)}${attempts.length ? ` (${attempts.length} 次)` : ''}</div>
+                        <div class="text-xs text-gray-500 break-all">${formatDate(d.created_at)} · ${escapeHtml(d.url)}${detail ? ' · ' + escapeHtml(detail) : ''}</div>
+                    </div>
+                    <button onclick="redeliverWebhook('${d.id}')" class="text-blue-600 hover:underline whitespace-nowrap">重新推送</button>
+                </div>
+            `;
+        }).join('');
+    } catch (error) {
+        console.error('加载推送记录失败:', error);
+        list.innerHTML = `<div class="px-4 py-3 text-red-500">加载失败: ${escapeHtml(error.message)}</div>`;
+    }
+}
+
+// 发送 Webhook 管理请求,返回响应内容
+async function webhookRequest(method, path, body) {
+    const options = { method, headers: getAuthHeaders() };
+    if (body) {
+        options.body = JSON.stringify(body);
+    }
+    const response = await fetch(`${API_BASE_URL}/admin/webhooks${path}`, options);
+    const data = await response.json();
+    if (!response.ok) {
+        throw new Error(data.error || `HTTP ${response.status}`);
+    }
+    return data;
+}
+
+// 添加 Webhook,签名密钥只显示一次
+async function createWebhook() {
+    const events = Array.from(document.querySelectorAll('.webhook-event:checked')).map(el => el.value);
+    try {
+        const data = await webhookRequest('POST', '', {
+            url: document.getElementById('webhookUrl').value.trim(),
+            description: document.getElementById('webhookDescription').value.trim(),
+            events
+        });
+        document.getElementById('webhookUrl').value = '';
+        document.getElementById('webhookDescription').value = '';
+        document.querySelectorAll('.webhook-event').forEach(el => { el.checked = false; });
+        showAlert('成功', `Webhook 已添加，签名密钥只显示一次，请妥善保存:<br><span class="font-mono break-all">${escapeHtml(data.webhook.secret)}</span>`);
+        loadWebhooks();
+    } catch (error) {
+        showAlert('错误', '添加失败: ' + escapeHtml(error.message));
+    }
+}
+
+// 修改 Webhook,重新生成密钥时显示新密钥
+async function updateWebhook(id, changes) {
+    const run = async () => {
+        try {
+            const data = await webhookRequest('PUT', `/${id}`, changes);
+            if (changes.rotate_secret) {
+                showAlert('成功', `新的签名密钥只显示一次，请妥善保存:<br><span class="font-mono break-all">${escapeHtml(data.webhook.secret)}</span>`);
+            }
+            loadWebhooks();
+        } catch (error) {
+            showAlert('错误', '修改失败: ' + escapeHtml(error.message));
+        }
+    };
+    if (changes.rotate_secret) {
+        showConfirm('重新生成密钥', '旧密钥将立即失效，接收方需要使用新密钥校验签名，确定继续吗？', run);
+    } else {
+        run();
+    }
+}
+
+// 删除 Webhook
+async function deleteWebhook(id) {
+    showConfirm('确认删除', '删除后不再推送事件，未完成的推送也会停止，确定删除吗？', async () => {
+        try {
+            await webhookRequest('DELETE', `/${id}`);
+            loadWebhooks();
+        } catch (error) {
+            showAlert('错误', '删除失败: ' + escapeHtml(error.message));
+        }
+    });
+}
+
+// 发送测试推送
+async function pingWebhook(id) {
+    try {
+        await webhookRequest('POST', `/${id}/ping`);
+        showAlert('成功', '测试推送已加入队列');
+        setTimeout(loadWebhookDeliveries, 1500);
+    } catch (error) {
+        showAlert('错误', '测试失败: ' + escapeHtml(error.message));
+    }
+}
+
+// 使用相同内容重新推送
+async function redeliverWebhook(id) {
+    try {
+        await webhookRequest('POST', `/deliveries/${id}/redeliver`);
+        showAlert('成功', '已重新加入推送队列');
+        setTimeout(loadWebhookDeliveries, 1500);
+    } catch (error) {
+        showAlert('错误', '重新推送失败: ' + escapeHtml(error.message));
+    }
+}
+
+// 加载备份列表
+async function loadBackups() {
+    const list = document.getElementById('backupList');
+    try {
+        const data = await fetchList('/admin/backups');
+        
+        document.getElementById('backupStatus').textContent = (data.interval_hours > 0
+            ? `每 ${data.interval_hours} 小时自动备份，保留最近 ${data.retention} 个`
+            : `定时备份已关闭，保留最近 ${data.retention} 个`) + (data.encrypted ? '，备份已加密' : '，备份未加密');
+        
+        if (data.backups.length === 0) {
+            list.innerHTML = '<div class="px-4 py-3 text-gray-500">暂无备份</div>';
+            return;
+        }
+        
+        list.innerHTML = data.backups.map(b => `
+            <div class="px-4 py-3 flex justify-between items-center">
+                <div>
+                    <div class="font-mono">${escapeHtml(b.name)}</div>
+                    <div class="text-xs text-gray-500">${formatDate(b.created_at)} · ${formatFileSize(b.size)}${b.encrypted ? ' · 已加密' : ''}</div>
+                </div>
+                <button onclick="downloadBackup('${escapeHtml(b.name)}')" class="text-black hover:underline">下载</button>
+            </div>
+        `).join('');
+    } catch (error) {
+        console.error('加载备份列表失败:', error);
+        list.innerHTML = `<div class="px-4 py-3 text-red-500">加载失败: ${escapeHtml(error.message)}</div>`;
+    }
+}
+
+// 立即备份
+async function createBackup() {
+    try {
+        const response = await fetch(`${API_BASE_URL}/admin/backups`, {
+            method: 'POST',
+            headers: getAuthHeaders()
+        });
+        
+        const data = await response.json();
+        if (!response.ok) {
+            throw new Error(data.error || '备份失败');
+        }
+        
+        showAlert('成功', `备份成功: ${escapeHtml(data.name)}`);
+        loadBackups();
+    } catch (error) {
+        console.error('备份失败:', error);
+        showAlert('错误', '备份失败: ' + escapeHtml(error.message));
+    }
+}
+
+// 下载备份文件
+async function downloadBackup(name) {
+    try {
+        const response = await fetch(`${API_BASE_URL}/admin/backups/${encodeURIComponent(name)}`, {
+            headers: getAuthHeaders()
+        });
+        
+        if (!response.ok) {
+            const data = await response.json();
+            throw new Error(data.error || `HTTP ${response.status}`);
+        }
+        
+        const blob = await response.blob();
+        const url = URL.createObjectURL(blob);
+        const link = document.createElement('a');
+        link.href = url;
+        link.download = name;
+        document.body.appendChild(link);
+        link.click();
+        link.remove();
+        URL.revokeObjectURL(url);
+    } catch (error) {
+        console.error('下载备份失败:', error);
+        showAlert('错误', '下载失败: ' + escapeHtml(error.message));
+    }
+}
+
+// 保存告警配置
+async function saveAlertConfig() {
+    const webhookUrl = document.getElementById('alertWebhookUrl').value.trim();
+    const revealDailyQuota = document.getElementById('revealDailyQuota').value.trim();
+    
+    if (revealDailyQuota && (isNaN(revealDailyQuota) || parseInt(revealDailyQuota) < 0)) {
+        showAlert('提示', '每日卡密查看上限必须是大于等于0的整数，0表示不限制');
+        return;
+    }
+    
+    try {
+        const headers = getAuthHeaders();
+        const response = await fetch(`${API_BASE_URL}/admin/settings/alerts`, {
+            method: 'PUT',
+            headers: headers,
+            body: JSON.stringify({
+                webhook_url: webhookUrl,
+                reveal_daily_quota: revealDailyQuota || '0'
+            })
+        });
+        
+        if (!response.ok) {
+            const data = await response.json();
+            throw new Error(data.error || '保存失败');
+        }
+        
+        showAlert('成功', '告警配置保存成功');
+    } catch (error) {
+        console.error('保存告警配置失败:', error);
+        showAlert('错误', '保存失败: ' + error.message);
+    }
+}
+
+// 通知渠道名称
+const notifyChannelNames = { email: '邮件', webhook: 'Webhook', telegram: 'Telegram' };
+
+// 渲染通知规则表格,每行一个事件,每列一个渠道
+function renderNotifyRoutes(notifications) {
+    const channels = notifications.channels || [];
+    const routes = notifications.routes || {};
+    
+    document.getElementById('notifyRouteHead').innerHTML = '<th class="px-3 py-2 text-left font-medium">事件</th>' +
+        channels.map(ch => `<th class="px-3 py-2 text-center font-medium">${escapeHtml(notifyChannelNames[ch] || ch)}</th>`).join('');
+    
+    document.getElementById('notifyRouteBody').innerHTML = (notifications.events || []).map(event => {
+        const enabled = routes[event.name] || [];
+        const cells = channels.map(ch => `
+            <td class="px-3 py-2 text-center">
+                <input type="checkbox" class="notify-route" data-event="${escapeHtml(event.name)}" data-channel="${escapeHtml(ch)}" ${enabled.includes(ch) ? 'checked' : ''}>
+            </td>`).join('');
+        return `<tr><td class="px-3 py-2">${escapeHtml(event.title)} <span class="text-xs text-gray-400">${escapeHtml(event.name)}</span></td>${cells}</tr>`;
+    }).join('');
+}
+
+// 保存通知配置
+async function saveNotificationConfig() {
+    const routes = {};
+    document.querySelectorAll('#notifyRouteBody .notify-route').forEach(box => {
+        const event = box.dataset.event;
+        routes[event] = routes[event] || [];
+        if (box.checked) {
+            routes[event].push(box.dataset.channel);
+        }
+    });
+    
+    const config = {
+        telegram_chat_id: document.getElementById('telegramChatId').value.trim(),
+        telegram_api_base_url: document.getElementById('telegramApiBaseUrl').value.trim(),
+        routes: routes
+    };
+    
+    // 如果填写了令牌,则更新
+    const token = document.getElementById('telegramBotToken').value.trim();
+    if (token) {
+        config.telegram_bot_token = token;
+    }
+    
+    try {
+        const headers = getAuthHeaders();
+        const response = await fetch(`${API_BASE_URL}/admin/settings/notifications`, {
+            method: 'PUT',
+            headers: headers,
+            body: JSON.stringify(config)
+        });
+        
+        if (!response.ok) {
+            const data = await response.json();
+            throw new Error(data.error || '保存失败');
+        }
+        
+        showAlert('成功', '通知配置保存成功', () => {
+            loadSettings();
+        });
+    } catch (error) {
+        console.error('保存通知配置失败:', error);
+        showAlert('错误', '保存失败: ' + escapeHtml(error.message));
+    }
+}
+
+// 通过指定渠道发送测试通知,需先保存配置
+async function testNotification(channel) {
+    try {
+        const headers = getAuthHeaders();
+        const response = await fetch(`${API_BASE_URL}/admin/settings/test-notification`, {
+            method: 'POST',
+            headers: headers,
+            body: JSON.stringify({ channel: channel })
+        });
+        
+        const data = await response.json();
+        if (!response.ok) {
+            throw new Error(data.error || '测试失败');
+        }
+        
+        showAlert('成功', '测试通知已发送，请查收');
+    } catch (error) {
+        console.error('测试通知失败:', error);
+        showAlert('错误', '测试失败: ' + escapeHtml(error.message));
+    }
+}
+
+// 按发送方式显示对应的配置项
+function toggleMailTransport() {
+    const transport = document.getElementById('mailTransport').value;
+    document.getElementById('smtpSettings').style.display = transport === 'smtp' ? 'block' : 'none';
+    document.getElementById('httpMailSettings').style.display = transport === 'http' ? 'block' : 'none';
+    document.getElementById('fileMailSettings').style.display = transport === 'file' ? 'block' : 'none';
+    const provider = document.getElementById('mailApiProvider').value;
+    document.getElementById('mailApiDomainField').style.display = provider === 'mailgun' ? 'block' : 'none';
+}
+
 // 保存邮件配置
 async function saveEmailConfig() {
+    const transport = document.getElementById('mailTransport').value;
     const smtpHost = document.getElementById('smtpHost').value.trim();
-    const smtpPort = parseInt(document.getElementById('smtpPort').value);
+    const smtpPort = parseInt(document.getElementById('smtpPort').value) || 0;
     const smtpUsername = document.getElementById('smtpUsername').value.trim();
     const smtpPassword = document.getElementById('smtpPassword').value;
     const smtpFrom = document.getElementById('smtpFrom').value.trim();
+    const apiProvider = document.getElementById('mailApiProvider').value;
+    const apiKey = document.getElementById('mailApiKey').value.trim();
+    const apiDomain = document.getElementById('mailApiDomain').value.trim();
     
-    if (!smtpHost || !smtpPort || !smtpUsername || !smtpFrom) {
+    if (transport === 'smtp' && (!smtpHost || !smtpPort || !smtpUsername || !smtpFrom)) {
         showAlert('提示', '请填写完整的邮件配置信息');
         return;
     }
+    if (transport === 'http' && (!smtpFrom || (apiProvider === 'mailgun' && !apiDomain))) {
+        showAlert('提示', '请填写发件人' + (apiProvider === 'mailgun' ? '和发信域名' : ''));
+        return;
+    }
     
     const emailConfig = {
+        transport: transport,
         smtp_host: smtpHost,
         smtp_port: smtpPort,
+        security: document.getElementById('smtpSecurity').value,
         username: smtpUsername,
-        from: smtpFrom
+        from: smtpFrom,
+        file_path: document.getElementById('mailFilePath').value.trim(),
+        api_provider: transport === 'http' ? apiProvider : '',
+        api_base_url: document.getElementById('mailApiBaseURL').value.trim(),
+        api_domain: apiDomain
     };
     
-    // 如果填写了密码,则更新密码
+    // 如果填写了密码或密钥,则更新
     if (smtpPassword) {
         emailConfig.password = smtpPassword;
     }
+    if (apiKey) {
+        emailConfig.api_key = apiKey;
+    }
     
     try {
         const headers = getAuthHeaders();
@@ -1991,6 +3515,7 @@ async function saveEmailConfig() {
         showAlert('成功', '邮件配置保存成功', () => {
             // 清空密码输入框
             document.getElementById('smtpPassword').value = '';
+            document.getElementById('mailApiKey').value = '';
         });
     } catch (error) {
         console.error('保存邮件配置失败:', error);
@@ -2016,15 +3541,15 @@ async function testEmailConfig() {
             })
         });
         
+        const data = await response.json();
         if (!response.ok) {
-            const data = await response.json();
             throw new Error(data.error || '测试失败');
         }
         
-        showAlert('成功', `测试邮件已发送到 ${user.email}，请查收`);
+        showAlert('成功', `测试邮件已发送到 ${user.email}，请查收<br>发送方式: ${escapeHtml(data.transport)}<br>服务器响应: ${escapeHtml(data.response || '-')}`);
     } catch (error) {
         console.error('测试邮件失败:', error);
-        showAlert('错误', '测试失败: ' + error.message);
+        showAlert('错误', '测试失败: ' + escapeHtml(error.message));
     }
 }
 
@@ -2055,3 +3580,134 @@ async function saveLegalConfig() {
         showAlert('错误', '保存失败: ' + error.message);
     }
 }
+
+// 导出时附带的当前筛选条件
+const EXPORT_FILTERS = {
+    orders: () => ({
+        email: document.getElementById('orderFilterEmail').value.trim(),
+        status: document.getElementById('orderFilterStatus').value,
+        from: document.getElementById('orderFilterFrom').value,
+        to: document.getElementById('orderFilterTo').value
+    }),
+    users: () => ({
+        email: document.getElementById('userFilterEmail').value.trim()
+    }),
+    cardkeys: () => ({
+        product_id: currentFilterProductId,
+        status: document.getElementById('cardKeyFilterStatus').value
+    })
+};
+
+// 显示导出对话框,按当前筛选条件导出
+function showExportModal(entity) {
+    const user = JSON.parse(localStorage.getItem('user') || '{}');
+    const canReveal = checkPermission(user.role, 'cardkey:reveal');
+    
+    const modal = document.createElement('div');
+    modal.className = 'fixed inset-0 bg-black bg-opacity-50 flex items-center justify-center z-50';
+    modal.onclick = function(e) {
+        if (e.target === modal) {
+            modal.remove();
+        }
+    };
+    modal.innerHTML = `
+        <div class="bg-white rounded-lg p-6 max-w-md w-full mx-4">
+            <h3 class="text-xl font-medium mb-4">导出</h3>
+            <div class="space-y-4">
+                <p class="text-sm text-gray-600">按列表当前的筛选条件导出,导出操作会记录到审计日志。</p>
+                <div>
+                    <label class="block text-sm font-medium text-gray-700 mb-2">格式</label>
+                    <select id="exportFormat" class="w-full px-3 py-2 border border-gray-300 rounded focus:outline-none focus:ring-1 focus:ring-black">
+                        <option value="csv">CSV</option>
+                        <option value="xlsx">Excel (xlsx)</option>
+                    </select>
+                </div>
+                ${entity === 'cardkeys' ? `
+                <div>
+                    <label class="block text-sm font-medium text-gray-700 mb-2">卡密脱敏</label>
+                    <select id="exportMask" class="w-full px-3 py-2 border border-gray-300 rounded focus:outline-none focus:ring-1 focus:ring-black">
+                        <option value="partial">部分隐藏</option>
+                        <option value="full">完全隐藏</option>
+                        ${canReveal ? '<option value="none">明文</option>' : ''}
+                    </select>
+                </div>
+                ${canReveal ? `
+                <div id="exportReasonGroup" class="hidden">
+                    <label class="block text-sm font-medium text-gray-700 mb-2">明文导出原因</label>
+                    <input type="text" id="exportReason" class="w-full px-3 py-2 border border-gray-300 rounded focus:outline-none focus:ring-1 focus:ring-black" placeholder="记录到卡密查看记录,每个卡密计入每日查看配额">
+                </div>
+                ` : ''}
+                ` : ''}
+            </div>
+            <div class="flex justify-end space-x-3 mt-6">
+                <button onclick="this.closest('.fixed').remove()" class="px-4 py-2 text-gray-700 hover:bg-gray-100 rounded">
+                    取消
+                </button>
+                <button onclick="exportData('${entity}')" class="px-4 py-2 bg-black text-white rounded hover:bg-gray-800">
+                    导出
+                </button>
+            </div>
+        </div>
+    `;
+    
+    document.body.appendChild(modal);
+    
+    const maskSelect = document.getElementById('exportMask');
+    const reasonGroup = document.getElementById('exportReasonGroup');
+    if (maskSelect && reasonGroup) {
+        maskSelect.onchange = () => reasonGroup.classList.toggle('hidden', maskSelect.value !== 'none');
+    }
+}
+
+// 下载导出文件
+async function exportData(entity) {
+    const params = new URLSearchParams();
+    const filters = {
+        ...EXPORT_FILTERS[entity](),
+        format: document.getElementById('exportFormat').value
+    };
+    const mask = document.getElementById('exportMask');
+    if (mask) {
+        filters.mask = mask.value;
+        if (mask.value === 'none') {
+            filters.reason = document.getElementById('exportReason').value.trim();
+            if (!filters.reason) {
+                showAlert('错误', '请填写明文导出原因');
+                return;
+            }
+        }
+    }
+    Object.keys(filters).forEach(key => {
+        if (filters[key]) {
+            params.append(key, filters[key]);
+        }
+    });
+    
+    try {
+        const response = await fetch(`${API_BASE_URL}/admin/export/${entity}?${params.toString()}`, {
+            headers: getAuthHeaders()
+        });
+        
+        if (!response.ok) {
+            const data = await response.json();
+            throw new Error(data.error || `HTTP ${response.status}`);
+        }
+        
+        const disposition = response.headers.get('Content-Disposition') || '';
+        const match = disposition.match(/filename="([^"]+)"/);
+        const blob = await response.blob();
+        const url = URL.createObjectURL(blob);
+        const link = document.createElement('a');
+        link.href = url;
+        link.download = match ? match[1] : `${entity}.${filters.format}`;
+        document.body.appendChild(link);
+        link.click();
+        link.remove();
+        URL.revokeObjectURL(url);
+        
+        document.querySelector('.fixed').remove();
+    } catch (error) {
+        console.error('导出失败:', error);
+        showAlert('错误', '导出失败: ' + error.message);
+    }
+}
@@ -90,8 +90,13 @@ function displayProducts(products) {
             <p class="text-gray-500 text-sm mb-6 flex-grow">${product.description}</p>
             <div class="flex items-center justify-between mt-auto pt-6 border-t border-gray-50">
                 <span class="price-text text-xl">￥${product.price.toFixed(2)}</span>
+                ${product.stock > 0 ? `
                 <button class="text-sm bg-black text-white px-6 py-2 rounded hover:bg-gray-800" 
                         onclick="buyProduct('${product.id}')">立即购买</button>
+                ` : `
+                <button class="text-sm border border-black text-black px-6 py-2 rounded hover:bg-gray-100" 
+                        onclick="showRestockModal('${product.id}')">到货通知</button>
+                `}
             </div>
         </div>
     `).join('');
@@ -226,12 +231,41 @@ function displayOrders(orders) {
                     </button>
                 </div>
             </div>
+            ${order.card_key_fields && order.card_key_fields.length > 0 ? `
+            <div class="pt-4 mt-4 border-t border-gray-100 text-sm space-y-1">
+                ${order.card_key_fields.map(f => `
+                <div>
+                    <span class="text-gray-500">${escapeHtml(f.label)}:</span>
+                    <span class="ml-2 font-mono">${escapeHtml(f.value)}</span>
+                </div>
+                `).join('')}
+            </div>
+            ` : ''}
+            ${order.download_url ? `
+            <div class="pt-4 mt-4 border-t border-gray-100 text-sm">
+                <a href="${order.download_url}" class="inline-block bg-black text-white px-4 py-2 rounded hover:bg-gray-800">下载文件</a>
+                <span class="text-gray-500 ml-2">已下载 ${order.download_count || 0} 次</span>
+            </div>
+            ` : ''}
+            ${order.instructions ? `
+            <div class="pt-4 mt-4 border-t border-gray-100">
+                <div class="text-sm text-gray-500 mb-1">使用说明:</div>
+                <div class="text-sm bg-gray-50 p-3 rounded whitespace-pre-line">${escapeHtml(order.instructions)}</div>
+            </div>
+            ` : ''}
         </div>
     `).join('');
     
     orderList.innerHTML = title + orderCards;
 }
 
+// 转义 HTML 特殊字符
+function escapeHtml(text) {
+    const div = document.createElement('div');
+    div.textContent = text;
+    return div.innerHTML;
+}
+
 // 脱敏显示卡密
 function maskCardKey(cardKey) {
     if (cardKey.length <= 8) {
@@ -600,6 +634,73 @@ async function confirmPurchase(productId) {
     await processPurchase(productId, email);
 }
 
+// 显示到货通知订阅对话框
+function showRestockModal(productId) {
+    const user = checkLoginStatus();
+    const overlay = document.createElement('div');
+    overlay.className = 'modal-overlay';
+    overlay.onclick = function(e) {
+        if (e.target === overlay) {
+            overlay.classList.remove('show');
+            setTimeout(() => document.body.removeChild(overlay), 200);
+        }
+    };
+    overlay.innerHTML = `
+        <div class="modal-content" style="max-width: 400px;">
+            <div class="modal-title">到货通知</div>
+            <div class="modal-message">商品补货后将通过邮件通知您</div>
+            <input type="email" id="restockEmail" placeholder="your@email.com" value="${user ? user.email : ''}" class="input-field" style="margin: 20px 0;">
+            <div style="display: flex; gap: 10px;">
+                <button class="flex-1 px-4 py-2 text-gray-700 hover:bg-gray-100 rounded" onclick="this.closest('.modal-overlay').remove()">
+                    取消
+                </button>
+                <button class="flex-1 px-4 py-2 bg-black text-white rounded hover:bg-gray-800" onclick="subscribeRestock('${productId}')">
+                    订阅
+                </button>
+            </div>
+        </div>
+    `;
+    
+    document.body.appendChild(overlay);
+    setTimeout(() => overlay.classList.add('show'), 10);
+}
+
+// 订阅到货通知
+async function subscribeRestock(productId) {
+    const email = document.getElementById('restockEmail').value.trim();
+    
+    const emailRegex = /^[^\s@]+@[^\s@]+\.[^\s@]+$/;
+    if (!emailRegex.test(email)) {
+        showModal('提示', '请输入有效的邮箱地址');
+        return;
+    }
+    
+    const overlay = document.querySelector('.modal-overlay');
+    if (overlay) {
+        overlay.remove();
+    }
+    
+    try {
+        const response = await fetch(`${API_BASE_URL}/products/${productId}/subscribe`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({ email })
+        });
+        
+        const data = await response.json();
+        if (!response.ok) {
+            throw new Error(data.error || '订阅失败');
+        }
+        
+        showModal('成功', data.message);
+    } catch (error) {
+        console.error('订阅到货通知失败:', error);
+        showModal('错误', error.message);
+    }
+}
+
 // 处理购买逻辑
 async function processPurchase(productId, email) {
     try {
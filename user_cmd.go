@@ -0,0 +1,193 @@
+package main
+
+import (
+	"ai-hacker/internal/models"
+	"ai-hacker/internal/utils"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const usersDataFile = "data/users.json"
+
+// 密码最短长度,与注册和重置密码接口一致
+const minPasswordLength = 6
+
+// runUser 用户管理: ai-hacker user <create|reset-password|set-role>
+func runUser(args []string) int {
+	return runSubcommand("user", args, map[string]func(args []string) int{
+		"create":         runUserCreate,
+		"reset-password": runUserResetPassword,
+		"set-role":       runUserSetRole,
+	})
+}
+
+// runUserCreate 创建用户,未指定密码时生成随机密码并输出
+func runUserCreate(args []string) int {
+	c := newCLI("user create", "-email <邮箱> [-password <密码>] [-role 1]")
+	email := c.flags.String("email", "", "邮箱")
+	password := c.flags.String("password", "", "密码,为空时生成随机密码")
+	role := c.flags.Int("role", 1, "角色 ID: 1 普通用户 2 管理员 3 超级管理员")
+	if !c.parse(args, 0) {
+		return exitUsage
+	}
+
+	*email = strings.TrimSpace(*email)
+	if !strings.Contains(*email, "@") {
+		return c.usageError("邮箱格式错误")
+	}
+	if !utils.RoleExists(*role) {
+		return c.usageError("角色不存在: %d", *role)
+	}
+	plain, generated, err := resolvePassword(*password)
+	if err != nil {
+		return c.usageError("%v", err)
+	}
+
+	var users []models.User
+	if err := utils.LoadFromFile(usersDataFile, &users); err != nil {
+		return c.fail(fmt.Errorf("读取用户失败: %v", err))
+	}
+	for _, u := range users {
+		if strings.EqualFold(u.Email, *email) && !u.IsDeleted() {
+			return c.fail(errors.New("邮箱已被注册"))
+		}
+	}
+
+	hashed, err := utils.HashPassword(plain)
+	if err != nil {
+		return c.fail(errors.New("密码加密失败"))
+	}
+	user := models.User{
+		ID:        "U" + utils.GenerateID(),
+		Email:     *email,
+		Password:  hashed,
+		Role:      *role,
+		CreatedAt: time.Now(),
+	}
+	users = append(users, user)
+	if err := utils.SaveToFile(usersDataFile, users); err != nil {
+		return c.fail(fmt.Errorf("保存用户失败: %v", err))
+	}
+	c.audit("users.create", "users", user.ID, nil, user, "")
+
+	result := map[string]interface{}{"id": user.ID, "email": user.Email, "role": user.Role}
+	if generated {
+		result["password"] = plain
+	}
+	c.output(result, func() {
+		fmt.Printf("用户已创建: %s (%s),角色 %d\n", user.Email, user.ID, user.Role)
+		if generated {
+			fmt.Printf("随机密码: %s\n", plain)
+		}
+	})
+	return exitOK
+}
+
+// runUserResetPassword 重置用户密码,未指定密码时生成随机密码并输出
+func runUserResetPassword(args []string) int {
+	c := newCLI("user reset-password", "-email <邮箱> [-password <密码>]")
+	email := c.flags.String("email", "", "邮箱")
+	password := c.flags.String("password", "", "新密码,为空时生成随机密码")
+	if !c.parse(args, 0) {
+		return exitUsage
+	}
+
+	plain, generated, err := resolvePassword(*password)
+	if err != nil {
+		return c.usageError("%v", err)
+	}
+	hashed, err := utils.HashPassword(plain)
+	if err != nil {
+		return c.fail(errors.New("密码加密失败"))
+	}
+
+	user, err := updateUser(*email, func(u *models.User) {
+		u.Password = hashed
+	})
+	if err != nil {
+		return c.fail(err)
+	}
+	c.audit("users.reset_password", "users", user.ID, nil, nil, "命令行重置密码")
+
+	result := map[string]interface{}{"id": user.ID, "email": user.Email}
+	if generated {
+		result["password"] = plain
+	}
+	c.output(result, func() {
+		fmt.Printf("已重置 %s 的密码\n", user.Email)
+		if generated {
+			fmt.Printf("随机密码: %s\n", plain)
+		}
+	})
+	return exitOK
+}
+
+// runUserSetRole 修改用户角色
+func runUserSetRole(args []string) int {
+	c := newCLI("user set-role", "-email <邮箱> -role <角色 ID>")
+	email := c.flags.String("email", "", "邮箱")
+	role := c.flags.Int("role", 0, "角色 ID")
+	if !c.parse(args, 0) {
+		return exitUsage
+	}
+	if !utils.RoleExists(*role) {
+		return c.usageError("角色不存在: %d", *role)
+	}
+
+	var before models.User
+	user, err := updateUser(*email, func(u *models.User) {
+		before = *u
+		u.Role = *role
+	})
+	if err != nil {
+		return c.fail(err)
+	}
+	c.audit("users.update", "users", user.ID, before, user, "命令行修改角色")
+
+	c.output(map[string]interface{}{"id": user.ID, "email": user.Email, "role": user.Role}, func() {
+		fmt.Printf("%s 的角色已改为 %d\n", user.Email, user.Role)
+	})
+	return exitOK
+}
+
+// updateUser 按邮箱查找用户并修改,返回修改后的用户
+func updateUser(email string, update func(u *models.User)) (models.User, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return models.User{}, errors.New("请指定 -email")
+	}
+
+	var users []models.User
+	if err := utils.LoadFromFile(usersDataFile, &users); err != nil {
+		return models.User{}, fmt.Errorf("读取用户失败: %v", err)
+	}
+	for i := range users {
+		if strings.EqualFold(users[i].Email, email) && !users[i].IsDeleted() {
+			update(&users[i])
+			if err := utils.SaveToFile(usersDataFile, users); err != nil {
+				return models.User{}, fmt.Errorf("保存用户失败: %v", err)
+			}
+			return users[i], nil
+		}
+	}
+	return models.User{}, errors.New("用户不存在: " + email)
+}
+
+// resolvePassword 校验密码长度,为空时生成随机密码
+func resolvePassword(password string) (string, bool, error) {
+	if password == "" {
+		b := make([]byte, 12)
+		if _, err := rand.Read(b); err != nil {
+			return "", false, err
+		}
+		return base64.RawURLEncoding.EncodeToString(b), true, nil
+	}
+	if len(password) < minPasswordLength {
+		return "", false, fmt.Errorf("密码长度不能少于 %d 位", minPasswordLength)
+	}
+	return password, false, nil
+}